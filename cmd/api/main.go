@@ -9,14 +9,18 @@ import (
 	"strings"
 	"time"
 
+	"github.com/AQADIL/JudGO/internal/repository/filestore"
 	firebaseRepo "github.com/AQADIL/JudGO/internal/repository/firebase"
 	"github.com/AQADIL/JudGO/internal/service"
 	"github.com/AQADIL/JudGO/internal/transport/rest"
 	firebaseClient "github.com/AQADIL/JudGO/pkg/client/firebase"
+	"github.com/AQADIL/JudGO/pkg/sandbox"
 	"github.com/joho/godotenv"
 )
 
 func main() {
+	// The judge re-executes this binary as its sandbox init helper.
+	sandbox.MaybeInit()
 	printBanner()
 	_ = godotenv.Load()
 
@@ -50,12 +54,24 @@ func main() {
 	practiceRepo := firebaseRepo.NewFirebasePracticeRepository(db)
 	matchService := service.NewMatchService(matchRepo)
 	roomService := service.NewRoomService(roomRepo)
-	problemService := service.NewProblemService(problemRepo)
+	// Testcases stay inline in the problem documents unless a test data
+	// directory is configured.
+	var testData service.TestDataStore
+	if dir := strings.TrimSpace(os.Getenv("JUDGE_TESTDATA_DIR")); dir != "" {
+		store, err := filestore.NewFileTestDataStore(dir)
+		if err != nil {
+			log.Fatalf("[ERROR] Unable to init test data store: %v", err)
+		}
+		testData = store
+	}
+	problemService := service.NewProblemService(problemRepo, testData)
 	judgeService := service.NewJudgeService(problemService)
 	opsService := service.NewOpsService(userRepo, practiceRepo, roomService, problemService, judgeService)
+	rejudgeService := service.NewRejudgeService(practiceRepo, judgeService)
+	testGenService := service.NewTestGenService(problemService, judgeService)
 	roomGameService := service.NewRoomGameService(roomGameRepo, problemService, judgeService)
 	authService := service.NewAuthService(userRepo)
-	handler := rest.NewHandler(matchService, roomService, roomGameService, problemService, judgeService, opsService, authService, fbAuth, userRepo, practiceRepo)
+	handler := rest.NewHandler(matchService, roomService, roomGameService, problemService, judgeService, rejudgeService, testGenService, opsService, authService, fbAuth, userRepo, practiceRepo)
 	mux := http.NewServeMux()
 	rest.RegisterRoutes(mux, handler)
 	mux.HandleFunc("/{$}", func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/AQADIL/JudGO/internal/service"
+)
+
+// errUnknownWorker is the API's 404 on a worker route: the worker has to
+// register again.
+var errUnknownWorker = errors.New("unknown judge worker")
+
+// errJobLost is the API's 409 on a result: the job was taken back and went
+// to another worker.
+var errJobLost = errors.New("job is no longer leased to this worker")
+
+// apiClient speaks the judge worker protocol served under /judge-workers/.
+type apiClient struct {
+	baseURL string
+	token   string
+	http    *http.Client
+	// files downloads test data, which can take longer than any fixed
+	// timeout; the job's context bounds it instead.
+	files *http.Client
+}
+
+func newAPIClient(baseURL, token string) *apiClient {
+	// Long enough for a job poll, which the API holds open for up to 25s.
+	return &apiClient{baseURL: baseURL, token: token, http: &http.Client{Timeout: 60 * time.Second}, files: &http.Client{}}
+}
+
+func (c *apiClient) register(ctx context.Context, reg service.WorkerRegistration) (*service.WorkerSession, error) {
+	var sess service.WorkerSession
+	if _, err := c.post(ctx, "/judge-workers/register", reg, &sess); err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+func (c *apiClient) heartbeat(ctx context.Context, workerID string, hb service.WorkerHeartbeat) error {
+	_, err := c.post(ctx, "/judge-workers/"+workerID+"/heartbeat", hb, nil)
+	return err
+}
+
+// next returns nil without an error when the poll timed out.
+func (c *apiClient) next(ctx context.Context, workerID string) (*service.WorkerJob, error) {
+	var job service.WorkerJob
+	status, err := c.post(ctx, "/judge-workers/"+workerID+"/next", nil, &job)
+	if err != nil || status == http.StatusNoContent {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// complete returns errJobLost when the API no longer leases the job to this
+// worker.
+func (c *apiClient) complete(ctx context.Context, workerID, jobID string, res service.WorkerResult) error {
+	status, err := c.post(ctx, "/judge-workers/"+workerID+"/jobs/"+jobID+"/result", res, nil)
+	if status == http.StatusConflict {
+		return errJobLost
+	}
+	return err
+}
+
+// testData streams one stored test file; the caller closes it.
+func (c *apiClient) testData(ctx context.Context, problemID, version, checksum string) (io.ReadCloser, error) {
+	path := "/judge-workers/testdata/" + url.PathEscape(problemID) + "/" + url.PathEscape(version) + "/" + url.PathEscape(checksum)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := c.files.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return nil, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return resp.Body, nil
+}
+
+// post sends body as JSON and decodes a 200 response into out.
+func (c *apiClient) post(ctx context.Context, path string, body, out interface{}) (int, error) {
+	var payload io.Reader = http.NoBody
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		payload = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, payload)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return resp.StatusCode, errUnknownWorker
+	case resp.StatusCode >= 300:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return resp.StatusCode, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	case resp.StatusCode == http.StatusOK && out != nil:
+		return resp.StatusCode, json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,238 @@
+// Command judge-worker judges submissions for an API started with
+// JUDGE_REMOTE_WORKERS=1. It registers with the API, pulls jobs, heartbeats
+// while it runs them in its own sandbox and posts the results back.
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joho/godotenv"
+
+	"github.com/AQADIL/JudGO/internal/repository/filestore"
+	"github.com/AQADIL/JudGO/internal/service"
+	"github.com/AQADIL/JudGO/pkg/sandbox"
+)
+
+func main() {
+	// The judge re-executes this binary as its sandbox init helper.
+	sandbox.MaybeInit()
+	_ = godotenv.Load()
+
+	apiURL := strings.TrimRight(strings.TrimSpace(os.Getenv("JUDGE_API_URL")), "/")
+	if apiURL == "" {
+		log.Fatal("[ERROR] JUDGE_API_URL is required")
+	}
+	token := strings.TrimSpace(os.Getenv("JUDGE_WORKER_TOKEN"))
+	if token == "" {
+		log.Fatal("[ERROR] JUDGE_WORKER_TOKEN is required")
+	}
+	name := strings.TrimSpace(os.Getenv("JUDGE_WORKER_NAME"))
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+	capacity := runtime.NumCPU()
+	if raw := strings.TrimSpace(os.Getenv("JUDGE_WORKER_CONCURRENCY")); raw != "" {
+		if v, err := strconv.Atoi(raw); err == nil && v > 0 {
+			capacity = v
+		}
+	}
+
+	// The worker's judge runs jobs as they are leased; its own queue stays
+	// unused.
+	judge := service.NewJudgeService(nil)
+	if !judge.MetricsSnapshot().Enabled {
+		log.Fatal("[ERROR] judge is disabled: sandbox isolation is unavailable (set JUDGE_DEV=1 to run unsandboxed)")
+	}
+	client := newAPIClient(apiURL, token)
+	// Tests the API keeps in its test data store are downloaded on first
+	// use and cached here, out of sight of the submissions.
+	cacheDir := strings.TrimSpace(os.Getenv("JUDGE_TESTDATA_DIR"))
+	if cacheDir == "" {
+		cacheDir = filepath.Join(os.TempDir(), "judgo-testdata")
+	}
+	cache, err := filestore.NewFileTestDataStore(cacheDir)
+	if err != nil {
+		log.Fatalf("[ERROR] Unable to init test data cache: %v", err)
+	}
+	judge.SetTestDataStore(&apiTestData{client: client, cache: cache})
+
+	langs := make([]service.JudgeLanguage, 0)
+	for _, l := range judge.Languages() {
+		langs = append(langs, l.ID)
+	}
+
+	w := &worker{
+		client:   client,
+		judge:    judge,
+		reg:      service.WorkerRegistration{Name: name, Languages: langs, Capacity: capacity},
+		running:  map[string]service.JudgeJobState{},
+		capacity: capacity,
+	}
+	log.Printf("[READY] judge worker %s: %d slots, languages %v, API %s", name, capacity, langs, apiURL)
+	w.run(context.Background())
+}
+
+type worker struct {
+	client   *apiClient
+	judge    *service.JudgeService
+	reg      service.WorkerRegistration
+	capacity int
+
+	mu      sync.Mutex
+	session *service.WorkerSession
+	// running is reported with every heartbeat.
+	running map[string]service.JudgeJobState
+}
+
+func (w *worker) run(ctx context.Context) {
+	w.register(ctx)
+	go w.heartbeat(ctx)
+	var wg sync.WaitGroup
+	for i := 0; i < w.capacity; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.poll(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// register (re)registers with the API, retrying until it succeeds.
+func (w *worker) register(ctx context.Context) {
+	backoff := time.Second
+	for {
+		sess, err := w.client.register(ctx, w.reg)
+		if err == nil {
+			w.mu.Lock()
+			w.session = sess
+			w.mu.Unlock()
+			log.Printf("[WORKER] registered as %s", sess.WorkerID)
+			return
+		}
+		log.Printf("[WORKER] register failed: %v", err)
+		time.Sleep(backoff)
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// reregister replaces a session the API no longer knows, unless another
+// goroutine already did.
+func (w *worker) reregister(ctx context.Context, stale string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.session.WorkerID != stale {
+		return
+	}
+	for {
+		sess, err := w.client.register(ctx, w.reg)
+		if err == nil {
+			w.session = sess
+			log.Printf("[WORKER] registered again as %s", sess.WorkerID)
+			return
+		}
+		log.Printf("[WORKER] register failed: %v", err)
+		time.Sleep(2 * time.Second)
+	}
+}
+
+func (w *worker) sessionID() (string, time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.session.WorkerID, time.Duration(w.session.HeartbeatIntervalMs) * time.Millisecond
+}
+
+func (w *worker) heartbeat(ctx context.Context) {
+	for {
+		id, interval := w.sessionID()
+		time.Sleep(interval)
+		w.mu.Lock()
+		jobs := make(map[string]service.JudgeJobState, len(w.running))
+		for k, v := range w.running {
+			jobs[k] = v
+		}
+		w.mu.Unlock()
+		err := w.client.heartbeat(ctx, id, service.WorkerHeartbeat{Jobs: jobs})
+		switch {
+		case err == errUnknownWorker:
+			w.reregister(ctx, id)
+		case err != nil:
+			log.Printf("[WORKER] heartbeat failed: %v", err)
+		}
+	}
+}
+
+func (w *worker) setState(jobID string, state service.JudgeJobState) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if state == service.JudgeJobStateDone {
+		delete(w.running, jobID)
+		return
+	}
+	w.running[jobID] = state
+}
+
+// poll pulls and judges one job at a time.
+func (w *worker) poll(ctx context.Context) {
+	for {
+		id, _ := w.sessionID()
+		job, err := w.client.next(ctx, id)
+		if err == errUnknownWorker {
+			w.reregister(ctx, id)
+			continue
+		}
+		if err != nil {
+			log.Printf("[WORKER] poll failed: %v", err)
+			time.Sleep(2 * time.Second)
+			continue
+		}
+		if job == nil {
+			continue
+		}
+
+		w.setState(job.JobID, service.JudgeJobStateCompiling)
+		res, err := w.judge.RunWorkerJob(ctx, job, func(state service.JudgeJobState) {
+			w.setState(job.JobID, state)
+		})
+		out := service.WorkerResult{Result: res}
+		if err != nil {
+			out = service.WorkerResult{Error: err.Error()}
+		}
+		w.complete(ctx, id, job.JobID, out)
+		w.setState(job.JobID, service.JudgeJobStateDone)
+	}
+}
+
+// complete posts a job's result, retrying while the API cannot be reached.
+// The job stays in the heartbeats meanwhile, so the API keeps it leased
+// here. A result is only accepted from the worker that leased the job:
+// once the API has given it to another one, or dropped this worker, there
+// is nothing left to report.
+func (w *worker) complete(ctx context.Context, workerID, jobID string, out service.WorkerResult) {
+	backoff := time.Second
+	for {
+		err := w.client.complete(ctx, workerID, jobID, out)
+		switch {
+		case err == nil:
+			return
+		case err == errJobLost || err == errUnknownWorker:
+			log.Printf("[WORKER] dropped result of job %s: %v", jobID, err)
+			return
+		}
+		log.Printf("[WORKER] failed to report job %s: %v", jobID, err)
+		time.Sleep(backoff)
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
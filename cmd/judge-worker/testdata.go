@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/AQADIL/JudGO/internal/repository/filestore"
+)
+
+// apiTestData serves the test data a job references from a local cache,
+// downloading what is missing from the API first. Versions are never
+// rewritten, so a cached file stays valid for as long as it is kept.
+type apiTestData struct {
+	client *apiClient
+	cache  *filestore.FileTestDataStore
+}
+
+func (s *apiTestData) Open(ctx context.Context, problemID, version, checksum string) (io.ReadCloser, error) {
+	if !s.cache.Has(problemID, version, checksum) {
+		if err := s.fetch(ctx, problemID, version, checksum); err != nil {
+			return nil, err
+		}
+	}
+	return s.cache.Open(ctx, problemID, version, checksum)
+}
+
+// fetch downloads one file into the cache. Two jobs fetching the same file
+// both write it; the rename in Put keeps either copy whole.
+func (s *apiTestData) fetch(ctx context.Context, problemID, version, checksum string) error {
+	body, err := s.client.testData(ctx, problemID, version, checksum)
+	if err != nil {
+		return fmt.Errorf("failed to download test data %s: %w", checksum, err)
+	}
+	defer body.Close()
+	sum, _, err := s.cache.Put(ctx, problemID, version, body)
+	if err != nil {
+		return fmt.Errorf("failed to download test data %s: %w", checksum, err)
+	}
+	if sum != checksum {
+		return fmt.Errorf("test data %s arrived with checksum %s", checksum, sum)
+	}
+	return nil
+}
+
+func (s *apiTestData) Put(ctx context.Context, problemID, version string, r io.Reader) (string, int64, error) {
+	return s.cache.Put(ctx, problemID, version, r)
+}
+
+func (s *apiTestData) Prune(ctx context.Context, problemID string, keep ...string) error {
+	return s.cache.Prune(ctx, problemID, keep...)
+}
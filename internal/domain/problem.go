@@ -18,10 +18,80 @@ const (
 	ProblemStatusArchived  ProblemStatus = "ARCHIVED"
 )
 
+// ProblemType selects how the judge runs a submission.
+type ProblemType string
+
+const (
+	// ProblemTypeStandard feeds each testcase input on stdin and compares the
+	// output, or hands it to the checker.
+	ProblemTypeStandard ProblemType = "STANDARD"
+	// ProblemTypeInteractive connects the submission's stdin and stdout to
+	// the interactor instead.
+	ProblemTypeInteractive ProblemType = "INTERACTIVE"
+)
+
 type ProblemTestCase struct {
 	Input    string `json:"input"`
 	Output   string `json:"output"`
 	IsHidden bool   `json:"isHidden"`
+	// InputSHA256 and OutputSHA256 reference the test's data in the test
+	// data store, under the problem's TestDataVersion. Hidden tests then
+	// leave Input and Output empty; visible ones keep them, since every view
+	// of the problem shows them.
+	InputSHA256  string `json:"inputSha256,omitempty"`
+	OutputSHA256 string `json:"outputSha256,omitempty"`
+	InputBytes   int64  `json:"inputBytes,omitempty"`
+	OutputBytes  int64  `json:"outputBytes,omitempty"`
+}
+
+// ProblemSubtask is a group of testcases worth Points. The points are earned
+// only when every test in the group passes and every subtask it depends on is
+// earned as well.
+type ProblemSubtask struct {
+	Name   string `json:"name,omitempty"`
+	Points int    `json:"points"`
+	// Tests are indices into Problem.TestCases; a test may be shared by
+	// several subtasks.
+	Tests []int `json:"tests"`
+	// DependsOn lists earlier subtasks by index.
+	DependsOn []int `json:"dependsOn,omitempty"`
+}
+
+// ProblemGeneratorTest is one testcase to generate: the generator is run as
+// `generator <args...>` and its stdout becomes the input.
+type ProblemGeneratorTest struct {
+	Args     []string `json:"args"`
+	IsHidden bool     `json:"isHidden"`
+}
+
+// ProblemProgram is a judge-side program written in any judge language.
+type ProblemProgram struct {
+	Language string `json:"language"`
+	Code     string `json:"code"`
+}
+
+// PolicyAction is what the judge does with a submission that breaks the
+// import policy.
+type PolicyAction string
+
+const (
+	// PolicyActionReject judges the submission as a policy violation
+	// without compiling it.
+	PolicyActionReject PolicyAction = "REJECT"
+	// PolicyActionFlag judges it as usual and reports the violations.
+	PolicyActionFlag PolicyAction = "FLAG"
+	// PolicyActionOff skips the check.
+	PolicyActionOff PolicyAction = "OFF"
+)
+
+// ProblemPolicy adjusts the import check submissions go through before they
+// are compiled. Allow and Deny are keyed by judge language ("go", "py"); an
+// entry is an import path or module name and covers its sub-packages too.
+// Allow lifts entries of the judge's default deny list, Deny adds to it.
+type ProblemPolicy struct {
+	Action PolicyAction        `json:"action,omitempty"`
+	Allow  map[string][]string `json:"allow,omitempty"`
+	Deny   map[string][]string `json:"deny,omitempty"`
 }
 
 type Problem struct {
@@ -33,9 +103,48 @@ type Problem struct {
 	Difficulty   ProblemDifficulty `json:"difficulty"`
 	Tags         []string          `json:"tags"`
 	Status       ProblemStatus     `json:"status"`
+	Type         ProblemType       `json:"type,omitempty"`
 
 	StarterCode map[string]string `json:"starterCode"`
 	TestCases   []ProblemTestCase `json:"testCases"`
+	// TestDataVersion is the version of the test data store the testcases'
+	// checksums refer to; it changes whenever their data does.
+	TestDataVersion string `json:"testDataVersion,omitempty"`
+	// Subtasks enable partial scoring. Without them a problem is worth 100
+	// points, all or nothing.
+	Subtasks []ProblemSubtask `json:"subtasks,omitempty"`
+
+	// TimeLimitMs is the per-testcase time limit before the language
+	// multiplier; zero means the judge default.
+	TimeLimitMs int `json:"timeLimitMs,omitempty"`
+	// MemoryLimitMB caps the peak resident memory of a single testcase run;
+	// zero means the judge default.
+	MemoryLimitMB int `json:"memoryLimitMb,omitempty"`
+	// OutputLimitKB caps what a single run may write to stdout or stderr;
+	// zero means the judge default.
+	OutputLimitKB int `json:"outputLimitKb,omitempty"`
+
+	// Checker replaces exact output comparison when set. It is run as
+	// `checker <input> <expected> <output>`.
+	Checker *ProblemProgram `json:"checker,omitempty"`
+	// Interactor drives INTERACTIVE problems. It is run as
+	// `interactor <input> <expected>` with its stdin and stdout wired to the
+	// submission. Neither program is exposed through the public views.
+	Interactor *ProblemProgram `json:"interactor,omitempty"`
+
+	// Generator and Reference let the judge produce TestCases: each of
+	// GeneratorTests is generated in order, and the reference solution's
+	// output on it, under the problem's limits, is the expected output.
+	// Generating replaces TestCases. Neither program is public.
+	Generator      *ProblemProgram        `json:"generator,omitempty"`
+	GeneratorTests []ProblemGeneratorTest `json:"generatorTests,omitempty"`
+	Reference      *ProblemProgram        `json:"reference,omitempty"`
+	// Validator rejects hack inputs; problems without one cannot be hacked.
+	Validator *ProblemProgram `json:"validator,omitempty"`
+
+	// Policy overrides the default import policy; nil means the defaults,
+	// rejecting violations.
+	Policy *ProblemPolicy `json:"policy,omitempty"`
 
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
@@ -15,8 +15,21 @@ const (
 )
 
 const (
-	RoomLanguageGo     RoomLanguage = "GO"
-	RoomLanguagePython RoomLanguage = "PY"
+	RoomLanguageGo         RoomLanguage = "GO"
+	RoomLanguagePython     RoomLanguage = "PY"
+	RoomLanguageCPP        RoomLanguage = "CPP"
+	RoomLanguageJava       RoomLanguage = "JAVA"
+	RoomLanguageRust       RoomLanguage = "RUST"
+	RoomLanguageJavaScript RoomLanguage = "JS"
+)
+
+// RoomRanking decides how room game players are ordered and who wins when
+// time runs out.
+type RoomRanking string
+
+const (
+	RoomRankingSolved RoomRanking = "SOLVED"
+	RoomRankingPoints RoomRanking = "POINTS"
 )
 
 const (
@@ -39,6 +52,9 @@ type RoomSettings struct {
 	TaskDifficulties []RoomDifficulty `json:"taskDifficulties,omitempty"`
 	MaxPlayers       int              `json:"maxPlayers"`
 	ProblemSetName   string           `json:"problemSetName,omitempty"`
+	Ranking          RoomRanking      `json:"ranking,omitempty"`
+	// HackPhaseMin adds a hack phase of that many minutes after coding ends.
+	HackPhaseMin int `json:"hackPhaseMin,omitempty"`
 }
 
 type Room struct {
@@ -5,7 +5,11 @@ import "time"
 type RoomGameStatus string
 
 const (
-	RoomGameStatusRunning  RoomGameStatus = "RUNNING"
+	RoomGameStatusRunning RoomGameStatus = "RUNNING"
+	// RoomGameStatusHacking follows the coding phase when the room has a
+	// hack phase: submissions are closed and players may challenge each
+	// other's accepted solutions.
+	RoomGameStatusHacking  RoomGameStatus = "HACKING"
 	RoomGameStatusFinished RoomGameStatus = "FINISHED"
 )
 
@@ -17,15 +21,23 @@ type RoomProblem struct {
 	InputFormat  string            `json:"inputFormat"`
 	OutputFormat string            `json:"outputFormat"`
 	Samples      []ProblemTestCase `json:"samples"`
+	MaxPoints    int               `json:"maxPoints,omitempty"`
 }
 
+// RoomSubmission is a player's latest attempt at a room problem. While it is
+// being judged Pending is set and SubmissionID can be polled for progress.
 type RoomSubmission struct {
 	UserID       string    `json:"userId"`
 	DisplayName  string    `json:"displayName"`
 	ProblemID    string    `json:"problemId"`
 	Code         string    `json:"code"`
 	SubmittedAt  time.Time `json:"submittedAt"`
+	SubmissionID string    `json:"submissionId,omitempty"`
+	Pending      bool      `json:"pending,omitempty"`
 	Correct      bool      `json:"correct"`
+	Verdict      Verdict   `json:"verdict,omitempty"`
+	Score        int       `json:"score"`
+	MaxScore     int       `json:"maxScore,omitempty"`
 	ErrorMessage string    `json:"errorMessage,omitempty"`
 }
 
@@ -34,19 +46,63 @@ type RoomUserProgress struct {
 	DisplayName string                    `json:"displayName"`
 	Solved      map[string]bool           `json:"solved,omitempty"`
 	LastSubmit  map[string]RoomSubmission `json:"lastSubmit,omitempty"`
+	// Accepted is the latest accepted submission per problem; it is the one
+	// opponents may hack.
+	Accepted map[string]RoomSubmission `json:"accepted,omitempty"`
+	// Points holds the best score per problem; TotalPoints is their sum plus
+	// HackPoints.
+	Points      map[string]int `json:"points,omitempty"`
+	HackPoints  int            `json:"hackPoints,omitempty"`
+	TotalPoints int            `json:"totalPoints"`
+}
+
+type RoomHackStatus string
+
+const (
+	RoomHackStatusPending RoomHackStatus = "PENDING"
+	// RoomHackStatusSuccessful: the target's solution fails on the input.
+	RoomHackStatusSuccessful RoomHackStatus = "SUCCESSFUL"
+	// RoomHackStatusUnsuccessful: the target's solution passes the input.
+	RoomHackStatusUnsuccessful RoomHackStatus = "UNSUCCESSFUL"
+	// RoomHackStatusInvalid: the reference solution fails on the input, so
+	// it is not a valid test. It costs the hacker nothing.
+	RoomHackStatusInvalid RoomHackStatus = "INVALID"
+	// RoomHackStatusError: the hack could not be judged.
+	RoomHackStatusError RoomHackStatus = "ERROR"
+)
+
+// RoomHack is a challenge of an opponent's accepted solution with an input
+// the hacker wrote. Points is what it earned or cost the hacker.
+type RoomHack struct {
+	ID            string         `json:"id"`
+	HackerID      string         `json:"hackerId"`
+	TargetID      string         `json:"targetId"`
+	ProblemID     string         `json:"problemId"`
+	Input         string         `json:"input"`
+	Status        RoomHackStatus `json:"status"`
+	TargetVerdict Verdict        `json:"targetVerdict,omitempty"`
+	Message       string         `json:"message,omitempty"`
+	Points        int            `json:"points"`
+	CreatedAt     time.Time      `json:"createdAt"`
+	JudgedAt      *time.Time     `json:"judgedAt,omitempty"`
 }
 
 type RoomGame struct {
-	ID           string                      `json:"id"`
-	RoomCode     string                      `json:"roomCode"`
-	Status       RoomGameStatus              `json:"status"`
-	Language     RoomLanguage                `json:"language"`
-	DurationMin  int                         `json:"durationMin"`
-	StartedAt    time.Time                   `json:"startedAt"`
-	EndsAt       time.Time                   `json:"endsAt"`
+	ID          string         `json:"id"`
+	RoomCode    string         `json:"roomCode"`
+	Status      RoomGameStatus `json:"status"`
+	Language    RoomLanguage   `json:"language"`
+	Ranking     RoomRanking    `json:"ranking,omitempty"`
+	DurationMin int            `json:"durationMin"`
+	StartedAt   time.Time      `json:"startedAt"`
+	EndsAt      time.Time      `json:"endsAt"`
+	// HackPhaseMin is the length of the hack phase; zero means none.
+	HackPhaseMin int                         `json:"hackPhaseMin,omitempty"`
+	HackEndsAt   time.Time                   `json:"hackEndsAt"`
 	FinishedAt   *time.Time                  `json:"finishedAt,omitempty"`
 	WinnerUserID string                      `json:"winnerUserId,omitempty"`
 	Problems     []RoomProblem               `json:"problems"`
 	Progress     map[string]RoomUserProgress `json:"progress,omitempty"`
+	Hacks        map[string]RoomHack         `json:"hacks,omitempty"`
 	MyUserID     string                      `json:"myUserId,omitempty"`
 }
@@ -0,0 +1,44 @@
+package domain
+
+// Verdict is the judge outcome of a single testcase or of a whole submission.
+type Verdict string
+
+const (
+	VerdictAccepted            Verdict = "AC"
+	VerdictWrongAnswer         Verdict = "WA"
+	VerdictTimeLimitExceeded   Verdict = "TLE"
+	VerdictMemoryLimitExceeded Verdict = "MLE"
+	VerdictRuntimeError        Verdict = "RE"
+	VerdictCompileError        Verdict = "CE"
+	VerdictOutputLimitExceeded Verdict = "OLE"
+	VerdictInternalError       Verdict = "IE"
+	// VerdictPolicyViolation rejects a submission before it is compiled
+	// because it imports something the problem does not allow.
+	VerdictPolicyViolation Verdict = "PV"
+)
+
+// Description returns the lower-case phrase used in user-facing messages.
+func (v Verdict) Description() string {
+	switch v {
+	case VerdictAccepted:
+		return "accepted"
+	case VerdictWrongAnswer:
+		return "wrong answer"
+	case VerdictTimeLimitExceeded:
+		return "time limit exceeded"
+	case VerdictMemoryLimitExceeded:
+		return "memory limit exceeded"
+	case VerdictRuntimeError:
+		return "runtime error"
+	case VerdictCompileError:
+		return "compile error"
+	case VerdictOutputLimitExceeded:
+		return "output limit exceeded"
+	case VerdictInternalError:
+		return "internal error"
+	case VerdictPolicyViolation:
+		return "policy violation"
+	default:
+		return string(v)
+	}
+}
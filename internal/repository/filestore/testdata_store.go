@@ -0,0 +1,154 @@
+// Package filestore keeps testcase data on the local filesystem.
+package filestore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileTestDataStore stores test data as root/<problem>/<version>/<sha256>.
+// Files are written to a temporary name and renamed once complete, so a
+// reader never sees a partial file.
+type FileTestDataStore struct {
+	root string
+}
+
+func NewFileTestDataStore(root string) (*FileTestDataStore, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create test data dir: %w", err)
+	}
+	return &FileTestDataStore{root: root}, nil
+}
+
+// Root is the directory the store keeps its files under.
+func (s *FileTestDataStore) Root() string {
+	return s.root
+}
+
+func (s *FileTestDataStore) Put(ctx context.Context, problemID, version string, r io.Reader) (string, int64, error) {
+	dir, err := s.versionDir(problemID, version)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", 0, err
+	}
+	f, err := os.CreateTemp(dir, ".put-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(f.Name())
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	if err := os.Rename(f.Name(), filepath.Join(dir, sum)); err != nil {
+		return "", 0, err
+	}
+	return sum, n, nil
+}
+
+func (s *FileTestDataStore) Open(ctx context.Context, problemID, version, checksum string) (io.ReadCloser, error) {
+	path, err := s.path(problemID, version, checksum)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("test data %s of problem %s version %s not found", checksum, problemID, version)
+	}
+	return f, err
+}
+
+func (s *FileTestDataStore) Prune(ctx context.Context, problemID string, keep ...string) error {
+	dir, err := s.versionDir(problemID, "")
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	kept := make(map[string]bool, len(keep))
+	for _, v := range keep {
+		kept[v] = true
+	}
+	for _, e := range entries {
+		if !kept[e.Name()] {
+			if err := os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Has reports whether the data is already stored, for callers that fill the
+// store from elsewhere.
+func (s *FileTestDataStore) Has(problemID, version, checksum string) bool {
+	path, err := s.path(problemID, version, checksum)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+func (s *FileTestDataStore) path(problemID, version, checksum string) (string, error) {
+	dir, err := s.versionDir(problemID, version)
+	if err != nil {
+		return "", err
+	}
+	if !validChecksum(checksum) {
+		return "", fmt.Errorf("invalid test data checksum %q", checksum)
+	}
+	return filepath.Join(dir, checksum), nil
+}
+
+// versionDir is the directory of one version of a problem's data, or of the
+// problem itself when version is empty. IDs come from clients, so anything
+// that could leave root is refused.
+func (s *FileTestDataStore) versionDir(problemID, version string) (string, error) {
+	if !validName(problemID) {
+		return "", fmt.Errorf("invalid problem id %q", problemID)
+	}
+	if version == "" {
+		return filepath.Join(s.root, problemID), nil
+	}
+	if !validName(version) {
+		return "", fmt.Errorf("invalid test data version %q", version)
+	}
+	return filepath.Join(s.root, problemID, version), nil
+}
+
+func validName(s string) bool {
+	return s != "" && s != "." && s != ".." && !strings.HasPrefix(s, ".") && !strings.ContainsAny(s, `/\`+"\x00")
+}
+
+func validChecksum(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,119 @@
+package filestore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileTestDataStore(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	s, err := NewFileTestDataStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := "1 2\n3 4\n"
+	sum, n, err := s.Put(ctx, "sum", "v1", strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	want := sha256.Sum256([]byte(data))
+	if sum != hex.EncodeToString(want[:]) || n != int64(len(data)) {
+		t.Fatalf("put returned %s, %d", sum, n)
+	}
+	if !s.Has("sum", "v1", sum) || s.Has("sum", "v2", sum) {
+		t.Fatal("Has does not match what was stored")
+	}
+
+	rc, err := s.Open(ctx, "sum", "v1", sum)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	got, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil || string(got) != data {
+		t.Fatalf("read %q, %v", got, err)
+	}
+	if _, ok := rc.(*os.File); !ok {
+		t.Fatalf("Open returned a %T, not an *os.File", rc)
+	}
+
+	// No temporary file is left behind.
+	entries, err := os.ReadDir(filepath.Join(root, "sum", "v1"))
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("version dir holds %d entries (%v)", len(entries), err)
+	}
+
+	if _, _, err := s.Put(ctx, "sum", "v2", strings.NewReader(data)); err != nil {
+		t.Fatalf("put v2: %v", err)
+	}
+	if _, _, err := s.Put(ctx, "sum", "v3", strings.NewReader(data)); err != nil {
+		t.Fatalf("put v3: %v", err)
+	}
+	if err := s.Prune(ctx, "sum", "v3", "v1"); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	for _, tt := range []struct {
+		version string
+		kept    bool
+	}{{"v1", true}, {"v2", false}, {"v3", true}} {
+		if got := s.Has("sum", tt.version, sum); got != tt.kept {
+			t.Errorf("after prune, %s kept = %v, want %v", tt.version, got, tt.kept)
+		}
+	}
+	if err := s.Prune(ctx, "unknown", "v1"); err != nil {
+		t.Errorf("prune of a problem without data: %v", err)
+	}
+}
+
+func TestFileTestDataStoreRefusesBadNames(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewFileTestDataStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := strings.Repeat("ab", sha256.Size)
+	tests := []struct {
+		name      string
+		problemID string
+		version   string
+		checksum  string
+	}{
+		{"empty problem", "", "v1", valid},
+		{"parent problem", "..", "v1", valid},
+		{"problem with a slash", "a/b", "v1", valid},
+		{"problem with a backslash", `a\b`, "v1", valid},
+		{"hidden problem", ".git", "v1", valid},
+		{"problem with a nul", "a\x00", "v1", valid},
+		{"parent version", "sum", "..", valid},
+		{"version with a slash", "sum", "../other", valid},
+		{"short checksum", "sum", "v1", "abcd"},
+		{"checksum not hex", "sum", "v1", strings.Repeat("zz", sha256.Size)},
+		{"checksum as a path", "sum", "v1", "../../" + valid[:58]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.Open(ctx, tt.problemID, tt.version, tt.checksum); err == nil || strings.Contains(err.Error(), "not found") {
+				t.Fatalf("open: %v, want the name refused", err)
+			}
+			if s.Has(tt.problemID, tt.version, tt.checksum) {
+				t.Fatal("Has reported a refused name as stored")
+			}
+			if tt.checksum == valid {
+				if _, _, err := s.Put(ctx, tt.problemID, tt.version, strings.NewReader("x")); err == nil {
+					t.Fatal("put accepted the name")
+				}
+			}
+		})
+	}
+	if err := s.Prune(ctx, "..", "v1"); err == nil {
+		t.Fatal("prune accepted a parent problem id")
+	}
+}
@@ -14,6 +14,8 @@ type RoomGameRepository interface {
 	Create(ctx context.Context, g *domain.RoomGame) error
 	Get(ctx context.Context, id string) (*domain.RoomGame, error)
 	Update(ctx context.Context, g *domain.RoomGame) error
+	UpdateProgress(ctx context.Context, gameID, userID string, fn func(pr *domain.RoomUserProgress) error) (*domain.RoomUserProgress, error)
+	Transact(ctx context.Context, id string, fn func(g *domain.RoomGame) error) (*domain.RoomGame, error)
 	Delete(ctx context.Context, id string) error
 }
 
@@ -58,6 +60,58 @@ func (r *FirebaseRoomGameRepository) Update(ctx context.Context, g *domain.RoomG
 	return r.gameRef(g.ID).Set(ctx, g)
 }
 
+// UpdateProgress applies fn to one player's progress in a transaction on
+// that path alone, so writes to the rest of the game are not lost. fn may be
+// called more than once; an error from it aborts the update.
+func (r *FirebaseRoomGameRepository) UpdateProgress(ctx context.Context, gameID, userID string, fn func(pr *domain.RoomUserProgress) error) (*domain.RoomUserProgress, error) {
+	if gameID == "" || userID == "" {
+		return nil, fmt.Errorf("game id and user id are required")
+	}
+	var out domain.RoomUserProgress
+	err := r.gameRef(gameID).Child("progress").Child(userID).Transaction(ctx, func(tn db.TransactionNode) (interface{}, error) {
+		var pr domain.RoomUserProgress
+		if err := tn.Unmarshal(&pr); err != nil {
+			return nil, err
+		}
+		if err := fn(&pr); err != nil {
+			return nil, err
+		}
+		out = pr
+		return pr, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Transact applies fn to the game in a transaction. fn may be called more
+// than once; an error from it aborts the update.
+func (r *FirebaseRoomGameRepository) Transact(ctx context.Context, id string, fn func(g *domain.RoomGame) error) (*domain.RoomGame, error) {
+	if id == "" {
+		return nil, fmt.Errorf("game id is required")
+	}
+	var out domain.RoomGame
+	err := r.gameRef(id).Transaction(ctx, func(tn db.TransactionNode) (interface{}, error) {
+		var g domain.RoomGame
+		if err := tn.Unmarshal(&g); err != nil {
+			return nil, err
+		}
+		if g.ID == "" {
+			return nil, fmt.Errorf("game %s not found", id)
+		}
+		if err := fn(&g); err != nil {
+			return nil, err
+		}
+		out = g
+		return g, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
 func (r *FirebaseRoomGameRepository) Delete(ctx context.Context, id string) error {
 	id = strings.TrimSpace(id)
 	if id == "" {
@@ -8,18 +8,26 @@ import (
 	"time"
 
 	"firebase.google.com/go/v4/db"
+
+	"github.com/AQADIL/JudGO/internal/domain"
 )
 
 type PracticeSubmission struct {
-	UserID        string    `json:"userId"`
-	ProblemID     string    `json:"problemId"`
-	Language      string    `json:"language"`
-	Code          string    `json:"code"`
-	AttemptNumber int       `json:"attemptNumber"`
-	Passed        bool      `json:"passed"`
-	PassedCount   int       `json:"passedCount"`
-	TotalCount    int       `json:"totalCount"`
-	CreatedAt     time.Time `json:"createdAt"`
+	// ID is the submission's key under its user and problem. It is not
+	// stored in the record itself.
+	ID            string         `json:"-"`
+	UserID        string         `json:"userId"`
+	ProblemID     string         `json:"problemId"`
+	Language      string         `json:"language"`
+	Code          string         `json:"code"`
+	AttemptNumber int            `json:"attemptNumber"`
+	Passed        bool           `json:"passed"`
+	Verdict       domain.Verdict `json:"verdict,omitempty"`
+	PassedCount   int            `json:"passedCount"`
+	TotalCount    int            `json:"totalCount"`
+	Score         int            `json:"score"`
+	MaxScore      int            `json:"maxScore"`
+	CreatedAt     time.Time      `json:"createdAt"`
 }
 
 type PracticeSolved struct {
@@ -35,6 +43,9 @@ type PracticeRepository interface {
 	MarkSolvedIfFirst(ctx context.Context, userID, problemID string, attemptsToSolve int) error
 	ListSolved(ctx context.Context, userID string) (map[string]PracticeSolved, error)
 	ListSubmissions(ctx context.Context, userID string) ([]PracticeSubmission, error)
+	ListProblemSubmissions(ctx context.Context, problemID string) ([]PracticeSubmission, error)
+	UpdateSubmission(ctx context.Context, s *PracticeSubmission) error
+	ReplaceSolved(ctx context.Context, userID, problemID string, rec *PracticeSolved) error
 }
 
 type FirebasePracticeRepository struct {
@@ -171,6 +182,94 @@ func (r *FirebasePracticeRepository) ListSubmissions(ctx context.Context, userID
 	if raw == nil {
 		return []PracticeSubmission{}, nil
 	}
+	res := make([]PracticeSubmission, 0)
+	var walk func(node interface{})
+	walk = func(node interface{}) {
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return
+		}
+		if _, hasUser := m["userId"]; hasUser {
+			if _, hasProb := m["problemId"]; hasProb {
+				res = append(res, submissionFromMap(m))
+				return
+			}
+		}
+		for _, v := range m {
+			walk(v)
+		}
+	}
+	walk(raw)
+	return res, nil
+}
+
+// ListProblemSubmissions returns every user's submissions for one problem,
+// with their IDs set.
+func (r *FirebasePracticeRepository) ListProblemSubmissions(ctx context.Context, problemID string) ([]PracticeSubmission, error) {
+	problemID = strings.TrimSpace(problemID)
+	if problemID == "" {
+		return nil, fmt.Errorf("problemID is required")
+	}
+	var users map[string]interface{}
+	if err := r.submissionsRoot().GetShallow(ctx, &users); err != nil {
+		return nil, err
+	}
+	res := make([]PracticeSubmission, 0)
+	for userID := range users {
+		var items map[string]interface{}
+		if err := r.submissionsRoot().Child(userID).Child(problemID).Get(ctx, &items); err != nil {
+			return nil, err
+		}
+		for id, v := range items {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			s := submissionFromMap(m)
+			s.ID = id
+			if s.UserID == "" {
+				s.UserID = userID
+			}
+			if s.ProblemID == "" {
+				s.ProblemID = problemID
+			}
+			res = append(res, s)
+		}
+	}
+	return res, nil
+}
+
+// UpdateSubmission overwrites a stored submission, found by its ID.
+func (r *FirebasePracticeRepository) UpdateSubmission(ctx context.Context, s *PracticeSubmission) error {
+	if s == nil {
+		return fmt.Errorf("submission is required")
+	}
+	if s.UserID == "" || s.ProblemID == "" || s.ID == "" {
+		return fmt.Errorf("userId, problemId and id are required")
+	}
+	return r.submissionRef(s.UserID, s.ProblemID, s.ID).Set(ctx, s)
+}
+
+// ReplaceSolved sets the user's solved marker for a problem, or removes it
+// when rec is nil.
+func (r *FirebasePracticeRepository) ReplaceSolved(ctx context.Context, userID, problemID string, rec *PracticeSolved) error {
+	userID = strings.TrimSpace(userID)
+	problemID = strings.TrimSpace(problemID)
+	if userID == "" {
+		return fmt.Errorf("userID is required")
+	}
+	if problemID == "" {
+		return fmt.Errorf("problemID is required")
+	}
+	if rec == nil {
+		return r.solvedRef(userID, problemID).Delete(ctx)
+	}
+	return r.solvedRef(userID, problemID).Set(ctx, rec)
+}
+
+// submissionFromMap decodes a submission record loosely, so older records
+// with missing or differently typed fields still load.
+func submissionFromMap(m map[string]interface{}) PracticeSubmission {
 	toInt := func(v interface{}) int {
 		switch n := v.(type) {
 		case int:
@@ -207,34 +306,18 @@ func (r *FirebasePracticeRepository) ListSubmissions(ctx context.Context, userID
 		return t
 	}
 
-	res := make([]PracticeSubmission, 0)
-	var walk func(node interface{})
-	walk = func(node interface{}) {
-		m, ok := node.(map[string]interface{})
-		if !ok {
-			return
-		}
-		if _, hasUser := m["userId"]; hasUser {
-			if _, hasProb := m["problemId"]; hasProb {
-				s := PracticeSubmission{
-					UserID:        toStr(m["userId"]),
-					ProblemID:     toStr(m["problemId"]),
-					Language:      toStr(m["language"]),
-					Code:          toStr(m["code"]),
-					AttemptNumber: toInt(m["attemptNumber"]),
-					Passed:        toBool(m["passed"]),
-					PassedCount:   toInt(m["passedCount"]),
-					TotalCount:    toInt(m["totalCount"]),
-					CreatedAt:     toTime(m["createdAt"]),
-				}
-				res = append(res, s)
-				return
-			}
-		}
-		for _, v := range m {
-			walk(v)
-		}
+	return PracticeSubmission{
+		UserID:        toStr(m["userId"]),
+		ProblemID:     toStr(m["problemId"]),
+		Language:      toStr(m["language"]),
+		Code:          toStr(m["code"]),
+		AttemptNumber: toInt(m["attemptNumber"]),
+		Passed:        toBool(m["passed"]),
+		Verdict:       domain.Verdict(toStr(m["verdict"])),
+		PassedCount:   toInt(m["passedCount"]),
+		TotalCount:    toInt(m["totalCount"]),
+		Score:         toInt(m["score"]),
+		MaxScore:      toInt(m["maxScore"]),
+		CreatedAt:     toTime(m["createdAt"]),
 	}
-	walk(raw)
-	return res, nil
 }
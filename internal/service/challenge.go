@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/AQADIL/JudGO/internal/domain"
+	"github.com/AQADIL/JudGO/pkg/sandbox"
+)
+
+const (
+	// maxChallengeInputBytes bounds a hack input; it is stored with the game.
+	maxChallengeInputBytes = 64 << 10
+	validatorRunTimeout    = 10 * time.Second
+	// challengeTimeout bounds a challenge once a judge worker took it.
+	challengeTimeout = 2 * time.Minute
+)
+
+// ChallengeResult is the outcome of judging a solution on one input that has
+// no stored expected output. ValidInput is false when the problem's validator
+// rejects the input or its reference solution fails on it; Verdict is then
+// empty.
+type ChallengeResult struct {
+	ValidInput bool           `json:"validInput"`
+	Verdict    domain.Verdict `json:"verdict,omitempty"`
+	Message    string         `json:"message,omitempty"`
+}
+
+// Challenge queues the judging of code on input, taking the expected output
+// from the problem's reference solution once its validator accepted the
+// input. The solution runs under the same limits and checker as a submission
+// would. Like a custom run, a challenge waits in the judge queue and is run
+// by a judge worker, which calls onDone; it fails right away when the queue
+// is full, and is not offered by an API judging on remote workers.
+func (s *JudgeService) Challenge(ctx context.Context, problemID string, lang JudgeLanguage, code, input string, onDone func(*ChallengeResult, error)) error {
+	if s.workers != nil {
+		return fmt.Errorf("challenges are disabled while judging on remote workers")
+	}
+	if !s.enabled() {
+		return fmt.Errorf("judge is disabled: sandbox isolation is unavailable (set JUDGE_DEV=1 to run unsandboxed)")
+	}
+	if strings.TrimSpace(input) == "" {
+		return fmt.Errorf("input is required")
+	}
+	if len(input) > maxChallengeInputBytes {
+		return fmt.Errorf("input is larger than %d KB", maxChallengeInputBytes>>10)
+	}
+	problemID = strings.TrimSpace(problemID)
+	p, err := s.problems.GetAdmin(ctx, problemID)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return fmt.Errorf("problem not found")
+	}
+	if p.Type == domain.ProblemTypeInteractive {
+		return fmt.Errorf("interactive problems cannot be challenged")
+	}
+	if p.Reference == nil {
+		return fmt.Errorf("problem has no reference solution")
+	}
+	if p.Validator == nil {
+		return fmt.Errorf("problem has no input validator")
+	}
+
+	t := &judgeTask{custom: func() {
+		ctx, cancel := context.WithTimeout(context.Background(), challengeTimeout)
+		defer cancel()
+		onDone(s.challenge(ctx, p, problemID, lang, code, input))
+	}}
+	select {
+	case s.queue.tasks <- t:
+	default:
+		atomic.AddInt64(&s.metrics.queueRejected, 1)
+		return fmt.Errorf("judge queue is full, try again later")
+	}
+	return nil
+}
+
+// challenge is the part of a challenge done by a judge worker.
+func (s *JudgeService) challenge(ctx context.Context, p *domain.Problem, problemID string, lang JudgeLanguage, code, input string) (*ChallengeResult, error) {
+	val, err := s.programs.get(s.languages, p.Validator)
+	if err != nil {
+		return nil, fmt.Errorf("internal error: validator %v", err)
+	}
+	msg, err := s.validate(ctx, val, input)
+	if err != nil {
+		return nil, err
+	}
+	if msg != "" {
+		return &ChallengeResult{Message: "invalid input: " + msg}, nil
+	}
+
+	ref, err := s.programs.get(s.languages, p.Reference)
+	if err != nil {
+		return nil, fmt.Errorf("internal error: reference solution %v", err)
+	}
+	expected, _, err := s.runReference(ctx, ref, input, referenceLimits(p, ref))
+	if err != nil {
+		if verdictOf(err) == domain.VerdictInternalError {
+			return nil, err
+		}
+		return &ChallengeResult{Message: err.Error()}, nil
+	}
+
+	cp := *p
+	cp.Subtasks = nil
+	cp.TestCases = []domain.ProblemTestCase{{Input: input, Output: expected, IsHidden: true}}
+	req, err := s.prepareProblem(&cp, problemID, lang, code, JudgeOptions{})
+	if err != nil {
+		return nil, err
+	}
+	jr, err := s.run(ctx, req, nil)
+	if err != nil {
+		return nil, err
+	}
+	res := &ChallengeResult{ValidInput: true, Verdict: jr.Verdict}
+	switch {
+	case jr.Verdict == domain.VerdictCompileError:
+		res.Message = jr.CompileError
+	case jr.Verdict == domain.VerdictPolicyViolation:
+		res.Message = strings.Join(jr.PolicyViolations, "; ")
+	case len(jr.Results) > 0 && jr.Results[0].Error != "":
+		res.Message = jr.Results[0].Error
+	case jr.Verdict != domain.VerdictAccepted:
+		res.Message = jr.Verdict.Description()
+	}
+	return res, nil
+}
+
+// validate runs the validator on input. It returns why the input is invalid,
+// or "" when it is valid.
+func (s *JudgeService) validate(ctx context.Context, val *programBuild, input string) (string, error) {
+	if err := s.acquireSandbox(ctx); err != nil {
+		return "", err
+	}
+	defer s.releaseSandbox()
+
+	vctx, cancel := context.WithTimeout(ctx, validatorRunTimeout)
+	defer cancel()
+	var res *sandbox.Result
+	proc, err := s.startRun(vctx, val.command(), input, sandbox.Limits{CPUTime: validatorRunTimeout})
+	if err == nil {
+		res, err = proc.Wait()
+	}
+	v, msg, err := programVerdict("validator", res, err, vctx.Err())
+	if err != nil {
+		return "", fmt.Errorf("internal error: %v", err)
+	}
+	if v != domain.VerdictAccepted {
+		if msg == "" {
+			msg = "rejected by the validator"
+		}
+		return msg, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,235 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AQADIL/JudGO/internal/domain"
+	"github.com/AQADIL/JudGO/pkg/sandbox"
+)
+
+const (
+	programCompileTimeout = 60 * time.Second
+	checkerRunTimeout     = 10 * time.Second
+)
+
+// programCache keeps compiled checkers and interactors keyed by language and
+// source, so each is built once per problem version and shared by every
+// submission.
+type programCache struct {
+	mu     sync.Mutex
+	root   string
+	builds map[string]*programBuild
+}
+
+type programBuild struct {
+	once   sync.Once
+	dir    string
+	driver LanguageDriver
+	err    error
+}
+
+func newProgramCache() *programCache {
+	return &programCache{builds: map[string]*programBuild{}}
+}
+
+// get returns the compiled program, building it on first use. A program that
+// fails to compile stays failed until the problem is updated with new code.
+func (c *programCache) get(languages *LanguageRegistry, prog *domain.ProblemProgram) (*programBuild, error) {
+	driver, err := languages.Resolve(prog.Language)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(string(driver.Language()) + "\x00" + prog.Code))
+	key := hex.EncodeToString(sum[:])
+
+	c.mu.Lock()
+	if c.root == "" {
+		root, err := os.MkdirTemp("", "judgo-programs-*")
+		if err != nil {
+			c.mu.Unlock()
+			return nil, fmt.Errorf("failed to create program cache: %w", err)
+		}
+		// MkdirTemp creates it as 0700; the sandbox helper has to pass
+		// through it to reach a program's dir, so it belongs to the sandbox
+		// user too.
+		if err := sandbox.PrepareWorkDir(root); err != nil {
+			c.mu.Unlock()
+			return nil, err
+		}
+		c.root = root
+	}
+	b, ok := c.builds[key]
+	if !ok {
+		b = &programBuild{dir: filepath.Join(c.root, key[:16]), driver: driver}
+		c.builds[key] = b
+	}
+	c.mu.Unlock()
+
+	b.once.Do(func() {
+		b.err = b.build(prog.Code)
+	})
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b, nil
+}
+
+func (b *programBuild) build(code string) error {
+	if err := os.MkdirAll(b.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create program dir: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(b.dir, b.driver.SourceFile()), []byte(code), 0600); err != nil {
+		return fmt.Errorf("failed to write program: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), programCompileTimeout)
+	defer cancel()
+	if err := b.driver.Compile(ctx, b.dir); err != nil {
+		return err
+	}
+	// Only the program's own sandbox binds its dir in, where it runs as
+	// nobody when the judge is root.
+	return sandbox.PrepareWorkDir(b.dir)
+}
+
+// command returns the program's command with args appended, set up to run
+// from its build dir.
+func (b *programBuild) command(args ...string) *exec.Cmd {
+	return b.commandWithMemory(defaultMemoryLimitMB, args...)
+}
+
+// commandWithMemory is command for a program that runs under a memory limit
+// other than the default, which some runtimes need to know up front.
+func (b *programBuild) commandWithMemory(memoryLimitMB int, args ...string) *exec.Cmd {
+	cmd := b.driver.RunCommand(b.dir, memoryLimitMB)
+	cmd.Args = append(cmd.Args, args...)
+	cmd.Dir = b.dir
+	cmd.Env = sandbox.DefaultEnv(b.dir)
+	return cmd
+}
+
+type judgeFile struct {
+	name string
+	data io.Reader
+}
+
+// writeJudgeFiles writes testcase files for a judge-side program into a fresh
+// directory the submission never had access to, so nothing it left behind
+// can redirect the writes. The dir is private to the judge and handed to the
+// sandbox user; it is only bound into the judge-side program's root, through
+// Limits.ReadOnlyPaths. The caller removes the returned dir.
+func writeJudgeFiles(files ...judgeFile) (string, []string, error) {
+	dir, err := os.MkdirTemp("", "judgo-check-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create judge files dir: %w", err)
+	}
+	paths := make([]string, 0, len(files))
+	for _, f := range files {
+		path := filepath.Join(dir, f.name)
+		if err := writeJudgeFile(path, f.data); err != nil {
+			os.RemoveAll(dir)
+			return "", nil, fmt.Errorf("failed to write %s: %w", f.name, err)
+		}
+		paths = append(paths, path)
+	}
+	if err := sandbox.PrepareWorkDir(dir); err != nil {
+		os.RemoveAll(dir)
+		return "", nil, err
+	}
+	return dir, paths, nil
+}
+
+func writeJudgeFile(path string, data io.Reader) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// check runs the checker on one testcase of p. The input and expected output
+// are streamed from the test data into the checker's files rather than read
+// whole.
+func (s *JudgeService) check(ctx context.Context, b *programBuild, p *domain.Problem, tc domain.ProblemTestCase, output string) (domain.Verdict, string, error) {
+	input, err := s.openTestData(ctx, p, tc.Input, tc.InputSHA256)
+	if err != nil {
+		return "", "", err
+	}
+	defer input.Close()
+	expected, err := s.openTestData(ctx, p, tc.Output, tc.OutputSHA256)
+	if err != nil {
+		return "", "", err
+	}
+	defer expected.Close()
+	dir, args, err := writeJudgeFiles(
+		judgeFile{"input.txt", input},
+		judgeFile{"expected.txt", expected},
+		judgeFile{"output.txt", strings.NewReader(output)},
+	)
+	if err != nil {
+		return "", "", err
+	}
+	defer os.RemoveAll(dir)
+
+	cctx, cancel := context.WithTimeout(ctx, checkerRunTimeout)
+	defer cancel()
+	cmd := b.command(args...)
+
+	var res *sandbox.Result
+	proc, err := s.startRun(cctx, cmd, "", sandbox.Limits{CPUTime: checkerRunTimeout, ReadOnlyPaths: []string{dir}})
+	if err == nil {
+		res, err = proc.Wait()
+	}
+	return programVerdict("checker", res, err, cctx.Err())
+}
+
+// programVerdict turns a checker, interactor or validator exit into a verdict
+// and its message: 0 is accepted, 1 wrong answer and 2 presentation error,
+// judged as wrong answer. The message is the first line of stderr, or of
+// stdout when stderr is empty. A program that crashed, timed out or used an
+// unknown exit code is reported as an error rather than a verdict.
+func programVerdict(role string, res *sandbox.Result, err error, ctxErr error) (domain.Verdict, string, error) {
+	if res == nil || errors.Is(err, sandbox.ErrSetup) {
+		return "", "", fmt.Errorf("%s failed: %v", role, err)
+	}
+	if ctxErr == context.DeadlineExceeded {
+		return "", "", fmt.Errorf("%s failed: time limit exceeded", role)
+	}
+	msg := firstLine(res.Stderr)
+	if msg == "" {
+		msg = firstLine(res.Stdout)
+	}
+	switch res.ExitCode {
+	case 0:
+		return domain.VerdictAccepted, msg, nil
+	case 1, 2:
+		return domain.VerdictWrongAnswer, msg, nil
+	default:
+		if msg == "" && err != nil {
+			msg = err.Error()
+		}
+		return "", "", fmt.Errorf("%s failed: %s", role, msg)
+	}
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	return s
+}
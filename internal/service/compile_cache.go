@@ -0,0 +1,274 @@
+package service
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCompileCacheMB = 512
+	// compiled artifacts nobody asked for in this long are dropped
+	compileCacheMaxAge = 6 * time.Hour
+)
+
+// compileCache keeps the work dir of successful builds keyed by language,
+// toolchain version and source hash, so resubmitted or shared code skips the
+// compiler. Entries are evicted least recently used first once the cache
+// grows past maxBytes, and when they have not been used for maxAge.
+type compileCache struct {
+	maxBytes int64
+	maxAge   time.Duration
+
+	mu       sync.Mutex
+	root     string
+	size     int64
+	entries  map[string]*list.Element
+	lru      *list.List // front is most recently used
+	versions map[JudgeLanguage]string
+}
+
+type compileEntry struct {
+	key      string
+	dir      string
+	size     int64
+	lastUsed time.Time
+	// ready is closed once the first build of this key has finished; ok
+	// tells whether it produced artifacts.
+	ready chan struct{}
+	ok    bool
+	// readers counts restores copying from dir; an entry evicted meanwhile
+	// is only marked removed, and the last reader deletes dir.
+	readers int
+	removed bool
+}
+
+func newCompileCache() *compileCache {
+	return &compileCache{
+		maxBytes: int64(envInt("JUDGE_COMPILE_CACHE_MB", defaultCompileCacheMB)) << 20,
+		maxAge:   compileCacheMaxAge,
+		entries:  map[string]*list.Element{},
+		lru:      list.New(),
+		versions: map[JudgeLanguage]string{},
+	}
+}
+
+// key returns the cache key for code, or "" when the driver is interpreted
+// or its toolchain version cannot be determined.
+func (c *compileCache) key(driver LanguageDriver, code string) string {
+	version := c.version(driver)
+	if version == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(string(driver.Language()) + "\x00" + version + "\x00" + code))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *compileCache) version(driver LanguageDriver) string {
+	args := driver.VersionCommand()
+	if len(args) == 0 {
+		return ""
+	}
+	c.mu.Lock()
+	v, ok := c.versions[driver.Language()]
+	c.mu.Unlock()
+	if ok {
+		return v
+	}
+	out, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+	if err != nil {
+		log.Printf("[JUDGE] compile cache disabled for %s: %v", driver.DisplayName(), err)
+	} else {
+		v = strings.TrimSpace(string(out))
+	}
+	c.mu.Lock()
+	c.versions[driver.Language()] = v
+	c.mu.Unlock()
+	return v
+}
+
+// restore copies the artifacts for key into workDir and reports a hit. When
+// another submission is building the same key it waits for that build first.
+// On a miss the caller compiles itself; if it is handed the pending entry it
+// must pass it to store afterwards so waiters are released.
+func (c *compileCache) restore(ctx context.Context, key, workDir string) (bool, *compileEntry, error) {
+	c.mu.Lock()
+	c.evictLocked(time.Now())
+	el, ok := c.entries[key]
+	if !ok {
+		e := &compileEntry{key: key, ready: make(chan struct{})}
+		c.entries[key] = c.lru.PushFront(e)
+		c.mu.Unlock()
+		return false, e, nil
+	}
+	e := el.Value.(*compileEntry)
+	c.mu.Unlock()
+
+	select {
+	case <-e.ready:
+	case <-ctx.Done():
+		return false, nil, ctx.Err()
+	}
+	if !e.ok {
+		return false, nil, nil
+	}
+
+	c.mu.Lock()
+	if cur, ok := c.entries[key]; !ok || cur != el {
+		// evicted while we waited
+		c.mu.Unlock()
+		return false, nil, nil
+	}
+	e.lastUsed = time.Now()
+	c.lru.MoveToFront(el)
+	e.readers++
+	c.mu.Unlock()
+
+	_, err := copyTree(e.dir, workDir)
+	c.release(e)
+	if err != nil {
+		return false, nil, err
+	}
+	return true, nil, nil
+}
+
+// release ends a restore's copy from e, deleting its dir if e was evicted
+// meanwhile.
+func (c *compileCache) release(e *compileEntry) {
+	c.mu.Lock()
+	e.readers--
+	drop := e.removed && e.readers == 0
+	c.mu.Unlock()
+	if drop {
+		os.RemoveAll(e.dir)
+	}
+}
+
+// store saves the build in workDir for a pending entry from restore, or,
+// when the build failed, drops the entry so later submissions try again.
+func (c *compileCache) store(e *compileEntry, workDir string, buildErr error) {
+	defer close(e.ready)
+
+	err := buildErr
+	if err == nil {
+		e.dir, err = c.entryDir(e.key)
+		if err == nil {
+			e.size, err = copyTree(workDir, e.dir)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el := c.entries[e.key]
+	if err != nil {
+		if err != buildErr {
+			log.Printf("[JUDGE] failed to cache build: %v", err)
+		}
+		c.removeLocked(el)
+		return
+	}
+	e.ok = true
+	e.lastUsed = time.Now()
+	c.size += e.size
+	c.evictLocked(e.lastUsed)
+}
+
+func (c *compileCache) entryDir(key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.root == "" {
+		root, err := os.MkdirTemp("", "judgo-compile-cache-*")
+		if err != nil {
+			return "", fmt.Errorf("failed to create compile cache: %w", err)
+		}
+		c.root = root
+	}
+	dir := filepath.Join(c.root, key)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// evictLocked drops stale entries and then the least recently used ones
+// until the cache fits maxBytes. Builds still in progress are skipped.
+func (c *compileCache) evictLocked(now time.Time) {
+	for el := c.lru.Back(); el != nil; {
+		prev := el.Prev()
+		e := el.Value.(*compileEntry)
+		if e.ok && (c.size > c.maxBytes || now.Sub(e.lastUsed) > c.maxAge) {
+			c.removeLocked(el)
+		}
+		el = prev
+	}
+}
+
+func (c *compileCache) removeLocked(el *list.Element) {
+	e := el.Value.(*compileEntry)
+	c.lru.Remove(el)
+	delete(c.entries, e.key)
+	c.size -= e.size
+	if e.readers > 0 {
+		e.removed = true
+	} else if e.dir != "" {
+		os.RemoveAll(e.dir)
+	}
+}
+
+// copyTree copies the regular files and directories under src into dst,
+// keeping their modes, and returns the bytes copied.
+func copyTree(src, dst string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode().IsRegular():
+			n, err := copyFile(path, target, info.Mode().Perm())
+			total += n
+			return err
+		}
+		return nil
+	})
+	return total, err
+}
+
+func copyFile(src, dst string, perm os.FileMode) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"container/list"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCompileCacheRestore(t *testing.T) {
+	ctx := context.Background()
+	c := &compileCache{maxBytes: 1 << 20, maxAge: time.Hour, entries: map[string]*list.Element{}, lru: list.New()}
+	t.Cleanup(func() {
+		if c.root != "" {
+			os.RemoveAll(c.root)
+		}
+	})
+
+	hit, pending, err := c.restore(ctx, "k", t.TempDir())
+	if err != nil || hit || pending == nil {
+		t.Fatalf("first restore: hit %v, pending %v, err %v", hit, pending, err)
+	}
+	build := t.TempDir()
+	if err := os.WriteFile(filepath.Join(build, "main"), []byte("binary"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	c.store(pending, build, nil)
+
+	work := t.TempDir()
+	if hit, _, err := c.restore(ctx, "k", work); err != nil || !hit {
+		t.Fatalf("second restore: hit %v, err %v", hit, err)
+	}
+	if got, err := os.ReadFile(filepath.Join(work, "main")); err != nil || string(got) != "binary" {
+		t.Fatalf("restored %q, %v", got, err)
+	}
+
+	// An entry evicted while a restore copies from it keeps its dir until
+	// the copy is done.
+	c.mu.Lock()
+	el := c.entries["k"]
+	e := el.Value.(*compileEntry)
+	e.readers++
+	c.removeLocked(el)
+	c.mu.Unlock()
+	if _, err := os.Stat(e.dir); err != nil {
+		t.Fatalf("dir removed under a reader: %v", err)
+	}
+	c.release(e)
+	if _, err := os.Stat(e.dir); !os.IsNotExist(err) {
+		t.Fatalf("dir kept after the last reader: %v", err)
+	}
+
+	if hit, pending, _ := c.restore(ctx, "k", t.TempDir()); hit || pending == nil {
+		t.Fatalf("restore after eviction: hit %v, pending %v", hit, pending)
+	}
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/AQADIL/JudGO/internal/domain"
+	"github.com/AQADIL/JudGO/pkg/sandbox"
+)
+
+// maxCustomInputBytes bounds the stdin a player can send with a custom run.
+const maxCustomInputBytes = 1 << 20
+
+// CustomRunResult is the outcome of running a program once on input the
+// player supplied. Verdict is only about how the run ended; there is no
+// expected output to compare against.
+type CustomRunResult struct {
+	ProblemID        string         `json:"problemId,omitempty"`
+	Language         JudgeLanguage  `json:"language"`
+	Verdict          domain.Verdict `json:"verdict"`
+	CompileError     string         `json:"compileError,omitempty"`
+	PolicyViolations []string       `json:"policyViolations,omitempty"`
+	Stdout           string         `json:"stdout"`
+	Stderr           string         `json:"stderr"`
+	OutputTruncated  bool           `json:"outputTruncated,omitempty"`
+	ExitCode         int            `json:"exitCode"`
+	Runtime          int            `json:"runtimeMs"`
+	CPUTime          int            `json:"cpuTimeMs"`
+	Memory           int            `json:"memoryKb"`
+	TimeLimitMs      int            `json:"timeLimitMs"`
+	MemoryLimitMB    int            `json:"memoryLimitMb"`
+	OutputLimitKB    int            `json:"outputLimitKb"`
+}
+
+// RunCustom compiles code and runs it once on input, in the same sandbox and
+// under the same limits a submission to problemID would get. problemID may be
+// empty, in which case the default limits apply. Nothing is recorded, but the
+// run waits its turn in the judge queue like a submission, and is compiled
+// and run by a judge worker. Remote workers only take submissions, so an API
+// judging on them does not offer custom runs.
+func (s *JudgeService) RunCustom(ctx context.Context, problemID string, lang JudgeLanguage, code, input string) (*CustomRunResult, error) {
+	if s.workers != nil {
+		return nil, fmt.Errorf("custom runs are disabled while judging on remote workers")
+	}
+	if !s.enabled() {
+		return nil, fmt.Errorf("judge is disabled: sandbox isolation is unavailable (set JUDGE_DEV=1 to run unsandboxed)")
+	}
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return nil, fmt.Errorf("code is required")
+	}
+	if len(input) > maxCustomInputBytes {
+		return nil, fmt.Errorf("input is larger than %d KB", maxCustomInputBytes>>10)
+	}
+	driver, err := s.languages.Resolve(string(lang))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &domain.Problem{}
+	problemID = strings.TrimSpace(problemID)
+	if problemID != "" {
+		p, err = s.problems.GetAdmin(ctx, problemID)
+		if err != nil {
+			return nil, err
+		}
+		if p == nil {
+			return nil, fmt.Errorf("problem not found")
+		}
+		if p.Type == domain.ProblemTypeInteractive {
+			return nil, fmt.Errorf("custom input is not supported for interactive problems")
+		}
+	}
+
+	lim := runLimits{timeout: timeLimit(p, driver), memoryLimitMB: memoryLimitMB(p), outputLimitKB: p.OutputLimitKB, seccomp: driver.SeccompProfile()}
+	if lim.outputLimitKB <= 0 {
+		lim.outputLimitKB = defaultOutputLimitKB
+	}
+	res := &CustomRunResult{
+		ProblemID:     problemID,
+		Language:      driver.Language(),
+		Verdict:       domain.VerdictAccepted,
+		TimeLimitMs:   int(lim.timeout.Milliseconds()),
+		MemoryLimitMB: lim.memoryLimitMB,
+		OutputLimitKB: lim.outputLimitKB,
+	}
+
+	if action, violations := checkPolicy(p, driver.Language(), code); len(violations) > 0 {
+		res.PolicyViolations = violations
+		if action == domain.PolicyActionReject {
+			res.Verdict = domain.VerdictPolicyViolation
+			return res, nil
+		}
+	}
+
+	done := make(chan error, 1)
+	t := &judgeTask{custom: func() {
+		done <- s.runCustom(ctx, driver, code, input, lim, res)
+	}}
+	select {
+	case s.queue.tasks <- t:
+	default:
+		atomic.AddInt64(&s.metrics.queueRejected, 1)
+		return nil, fmt.Errorf("judge queue is full, try again later")
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// runCustom is the part of a custom run done by a judge worker: it compiles
+// code and runs it on input, filling in res.
+func (s *JudgeService) runCustom(ctx context.Context, driver LanguageDriver, code, input string, lim runLimits, res *CustomRunResult) error {
+	// The caller may have given up while the run was queued.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	workDir, err := os.MkdirTemp("", "judgo-run-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	atomic.AddInt64(&s.metrics.activeSandboxes, 1)
+	defer atomic.AddInt64(&s.metrics.activeSandboxes, -1)
+	defer os.RemoveAll(workDir)
+
+	if err := os.WriteFile(filepath.Join(workDir, driver.SourceFile()), []byte(code), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", driver.SourceFile(), err)
+	}
+	if _, err := s.compile(ctx, driver, workDir, code, lim.timeout); err != nil {
+		if verdictOf(err) != domain.VerdictCompileError {
+			return err
+		}
+		res.Verdict = domain.VerdictCompileError
+		res.CompileError = err.Error()
+		return nil
+	}
+	if s.isolated {
+		if err := sandbox.PrepareWorkDir(workDir); err != nil {
+			return fmt.Errorf("failed to prepare sandbox dir: %w", err)
+		}
+	}
+
+	if err := s.acquireSandbox(ctx); err != nil {
+		return err
+	}
+	defer s.releaseSandbox()
+
+	tctx, cancel := context.WithTimeout(ctx, lim.wallTimeout())
+	defer cancel()
+	start := time.Now()
+	var sres *sandbox.Result
+	proc, err := s.startRun(tctx, submissionCommand(workDir, driver, lim.memoryLimitMB), input, lim.sandbox())
+	if err == nil {
+		sres, err = proc.Wait()
+	}
+	res.Runtime = int(time.Since(start).Milliseconds())
+
+	out, usage, runErr := runOutcome(tctx, sres, err, lim)
+	res.Verdict = verdictOf(runErr)
+	if res.Verdict == domain.VerdictInternalError {
+		return runErr
+	}
+	res.Memory = usage.memoryKB
+	res.CPUTime = int(usage.cpuTime.Milliseconds())
+	res.Stdout, res.OutputTruncated = shownOutput(out, res.Verdict == domain.VerdictOutputLimitExceeded)
+	if sres != nil {
+		res.ExitCode = sres.ExitCode
+		stderr, truncated := shownOutput(sres.Stderr, false)
+		res.Stderr = stderr
+		res.OutputTruncated = res.OutputTruncated || truncated
+	}
+	return nil
+}
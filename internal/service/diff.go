@@ -0,0 +1,231 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// MismatchKind classifies how a wrong output differs from the expected one.
+type MismatchKind string
+
+const (
+	// MismatchExtraOutput: the output is the expected output followed by
+	// more lines.
+	MismatchExtraOutput MismatchKind = "EXTRA_OUTPUT"
+	// MismatchMissingLines: the output stops early but is right so far.
+	MismatchMissingLines MismatchKind = "MISSING_LINES"
+	// MismatchWhitespace: the same tokens, spaced or broken into lines
+	// differently.
+	MismatchWhitespace MismatchKind = "WHITESPACE_ONLY"
+	// MismatchCase: the same tokens up to letter case.
+	MismatchCase MismatchKind = "CASE_ONLY"
+	// MismatchContent: anything else.
+	MismatchContent MismatchKind = "WRONG_CONTENT"
+)
+
+const (
+	diffContextLines = 3
+	// maxDiffWindowLines bounds how much of each side, from just before the
+	// first difference, is diffed.
+	maxDiffWindowLines = 200
+	// maxDiffLines and maxDiffLineBytes bound the diff that is returned.
+	maxDiffLines     = 60
+	maxDiffLineBytes = 200
+)
+
+// outputMismatch locates and describes a difference between two normalized
+// outputs. line and column are 1-based; column counts characters.
+type outputMismatch struct {
+	line   int
+	column int
+	kind   MismatchKind
+	diff   string
+}
+
+func diagnoseMismatch(out, exp string) outputMismatch {
+	a, b := splitLines(out), splitLines(exp)
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	m := outputMismatch{line: i + 1, column: 1}
+	if i < len(a) && i < len(b) {
+		m.column = firstDiffColumn(a[i], b[i])
+	}
+
+	switch {
+	case i == len(b):
+		m.kind = MismatchExtraOutput
+	case i == len(a):
+		m.kind = MismatchMissingLines
+	case strings.Join(strings.Fields(out), " ") == strings.Join(strings.Fields(exp), " "):
+		m.kind = MismatchWhitespace
+	case strings.EqualFold(strings.Join(strings.Fields(out), " "), strings.Join(strings.Fields(exp), " ")):
+		m.kind = MismatchCase
+	default:
+		m.kind = MismatchContent
+	}
+	m.diff = unifiedDiff(b, a, i)
+	return m
+}
+
+// splitLines splits normalized output into lines; empty output has none.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// firstDiffLine returns the first 1-based line where the normalized outputs
+// differ, or 0 when they are equal.
+func firstDiffLine(out, exp string) int {
+	if out == exp {
+		return 0
+	}
+	a, b := strings.Split(out, "\n"), strings.Split(exp, "\n")
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return i + 1
+		}
+	}
+	if len(a) < len(b) {
+		return len(a) + 1
+	}
+	return len(b) + 1
+}
+
+func firstDiffColumn(a, b string) int {
+	col := 1
+	for a != "" && b != "" {
+		ra, na := utf8.DecodeRuneInString(a)
+		rb, nb := utf8.DecodeRuneInString(b)
+		if ra != rb {
+			break
+		}
+		a, b = a[na:], b[nb:]
+		col++
+	}
+	return col
+}
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	text string
+	// expLine and outLine are the 0-based line numbers the op advances.
+	expLine, outLine int
+}
+
+// unifiedDiff diffs exp against out from a little before line from, which is
+// where they first differ. Only a window of each side is diffed and the
+// result is cut to maxDiffLines, so a huge wrong output stays cheap.
+func unifiedDiff(exp, out []string, from int) string {
+	start := from - diffContextLines
+	if start < 0 {
+		start = 0
+	}
+	e, o := window(exp, start), window(out, start)
+	truncated := start+len(e) < len(exp) || start+len(o) < len(out)
+
+	// lcs[i][j] is the longest common subsequence of e[i:] and o[j:].
+	lcs := make([][]int, len(e)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(o)+1)
+	}
+	for i := len(e) - 1; i >= 0; i-- {
+		for j := len(o) - 1; j >= 0; j-- {
+			if e[i] == o[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	ops := make([]diffOp, 0, len(e)+len(o))
+	i, j := 0, 0
+	for i < len(e) || j < len(o) {
+		switch {
+		case i < len(e) && j < len(o) && e[i] == o[j]:
+			ops = append(ops, diffOp{' ', e[i], start + i, start + j})
+			i++
+			j++
+		case i < len(e) && (j == len(o) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', e[i], start + i, start + j})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', o[j], start + i, start + j})
+			j++
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("--- expected\n+++ output\n")
+	lines := 0
+	for k := 0; k < len(ops); {
+		if ops[k].kind == ' ' {
+			k++
+			continue
+		}
+		// A hunk runs from a change, with context on both sides, until two
+		// changes are further apart than twice the context.
+		lo := k - diffContextLines
+		if lo < 0 {
+			lo = 0
+		}
+		hi := k
+		for n := k; n < len(ops); n++ {
+			if ops[n].kind != ' ' {
+				hi = n
+			} else if n-hi > 2*diffContextLines {
+				break
+			}
+		}
+		hi += diffContextLines
+		if hi >= len(ops) {
+			hi = len(ops) - 1
+		}
+		expCount, outCount := 0, 0
+		for _, op := range ops[lo : hi+1] {
+			if op.kind != '+' {
+				expCount++
+			}
+			if op.kind != '-' {
+				outCount++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", ops[lo].expLine+1, expCount, ops[lo].outLine+1, outCount)
+		for _, op := range ops[lo : hi+1] {
+			if lines == maxDiffLines {
+				sb.WriteString("... [diff truncated]\n")
+				return sb.String()
+			}
+			text := op.text
+			if len(text) > maxDiffLineBytes {
+				text = strings.ToValidUTF8(text[:maxDiffLineBytes], "") + "..."
+			}
+			sb.WriteByte(op.kind)
+			sb.WriteString(text)
+			sb.WriteByte('\n')
+			lines++
+		}
+		k = hi + 1
+	}
+	if truncated {
+		sb.WriteString("... [diff truncated]\n")
+	}
+	return sb.String()
+}
+
+func window(lines []string, start int) []string {
+	if start > len(lines) {
+		return nil
+	}
+	lines = lines[start:]
+	if len(lines) > maxDiffWindowLines {
+		lines = lines[:maxDiffWindowLines]
+	}
+	return lines
+}
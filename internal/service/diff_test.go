@@ -0,0 +1,82 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiagnoseMismatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		out    string
+		exp    string
+		kind   MismatchKind
+		line   int
+		column int
+	}{
+		{"extra output", "1\n2\n3", "1\n2", MismatchExtraOutput, 3, 1},
+		{"missing lines", "1", "1\n2\n3", MismatchMissingLines, 2, 1},
+		{"empty output", "", "42", MismatchMissingLines, 1, 1},
+		{"spacing", "1  2 3", "1 2 3", MismatchWhitespace, 1, 3},
+		{"line breaks", "1\n2\n3", "1 2 3", MismatchWhitespace, 1, 2},
+		{"case", "YES\nno", "yes\nno", MismatchCase, 1, 1},
+		{"case and spacing", "Yes  NO", "yes no", MismatchCase, 1, 1},
+		{"wrong number", "1\n5\n3", "1\n4\n3", MismatchContent, 2, 1},
+		{"wrong digit", "12345", "12355", MismatchContent, 1, 4},
+		{"columns count characters", "héllo wörld", "héllo world", MismatchContent, 1, 8},
+		{"wrong and short", "1\n5", "1\n4\n3", MismatchContent, 2, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := diagnoseMismatch(tt.out, tt.exp)
+			if m.kind != tt.kind || m.line != tt.line || m.column != tt.column {
+				t.Fatalf("got %s at %d:%d, want %s at %d:%d", m.kind, m.line, m.column, tt.kind, tt.line, tt.column)
+			}
+			if !strings.HasPrefix(m.diff, "--- expected\n+++ output\n@@ ") {
+				t.Fatalf("diff has no hunk:\n%s", m.diff)
+			}
+		})
+	}
+}
+
+func TestFirstDiffLine(t *testing.T) {
+	tests := []struct {
+		out, exp string
+		want     int
+	}{
+		{"1\n2", "1\n2", 0},
+		{"1\n3", "1\n2", 2},
+		{"1", "1\n2", 2},
+		{"1\n2\n3", "1\n2", 3},
+		{"", "1", 1},
+	}
+	for _, tt := range tests {
+		if got := firstDiffLine(tt.out, tt.exp); got != tt.want {
+			t.Errorf("firstDiffLine(%q, %q) = %d, want %d", tt.out, tt.exp, got, tt.want)
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	exp := []string{"1", "2", "3", "4", "5", "6", "7"}
+	out := []string{"1", "2", "3", "4", "X", "6", "7", "8"}
+	want := "--- expected\n+++ output\n" +
+		"@@ -2,6 +2,7 @@\n" +
+		" 2\n 3\n 4\n-5\n+X\n 6\n 7\n+8\n"
+	if got := unifiedDiff(exp, out, 4); got != want {
+		t.Fatalf("diff:\n%s\nwant:\n%s", got, want)
+	}
+
+	// A long wrong output is cut short.
+	long := make([]string, 500)
+	for i := range long {
+		long[i] = "x"
+	}
+	got := unifiedDiff([]string{"y"}, long, 0)
+	if n := strings.Count(got, "\n"); n > maxDiffLines+4 {
+		t.Fatalf("diff of %d lines", n)
+	}
+	if !strings.HasSuffix(got, "... [diff truncated]\n") {
+		t.Fatalf("long diff not marked truncated:\n%s", got)
+	}
+}
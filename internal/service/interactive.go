@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/AQADIL/JudGO/internal/domain"
+	"github.com/AQADIL/JudGO/pkg/sandbox"
+)
+
+// interactorSlack is how much longer than the submission the interactor may
+// run: it has to outlive a submission that uses its whole time limit.
+const interactorSlack = 5 * time.Second
+
+// interact runs one testcase of an interactive problem. The submission's
+// stdout is the interactor's stdin and the other way round; the interactor
+// gets the testcase as `interactor <input> <expected>`.
+//
+// A submission that exceeds its time or memory limit gets that verdict even
+// if the interactor also complained, since the interactor only sees the
+// conversation break off. Otherwise the interactor's wrong answer wins over
+// a submission runtime error, which is usually the submission failing to
+// write to an interactor that already quit. An interactor that crashes or
+// times out is an internal error.
+func (s *JudgeService) interact(ctx context.Context, workDir string, driver LanguageDriver, interactor *programBuild, p *domain.Problem, tc domain.ProblemTestCase, lim runLimits) (domain.Verdict, runUsage, string, error) {
+	input, err := s.openTestData(ctx, p, tc.Input, tc.InputSHA256)
+	if err != nil {
+		return domain.VerdictInternalError, runUsage{}, "", err
+	}
+	defer input.Close()
+	expected, err := s.openTestData(ctx, p, tc.Output, tc.OutputSHA256)
+	if err != nil {
+		return domain.VerdictInternalError, runUsage{}, "", err
+	}
+	defer expected.Close()
+	dir, args, err := writeJudgeFiles(
+		judgeFile{"input.txt", input},
+		judgeFile{"expected.txt", expected},
+	)
+	if err != nil {
+		return domain.VerdictInternalError, runUsage{}, "", err
+	}
+	defer os.RemoveAll(dir)
+
+	toInteractorR, toInteractorW, err := os.Pipe()
+	if err != nil {
+		return domain.VerdictInternalError, runUsage{}, "", err
+	}
+	toSubmissionR, toSubmissionW, err := os.Pipe()
+	if err != nil {
+		toInteractorR.Close()
+		toInteractorW.Close()
+		return domain.VerdictInternalError, runUsage{}, "", err
+	}
+	// Each side holds its own copies once started; ours must be closed so
+	// either one sees EOF when the other exits.
+	closePipes := func() {
+		toInteractorR.Close()
+		toInteractorW.Close()
+		toSubmissionR.Close()
+		toSubmissionW.Close()
+	}
+
+	ictx, icancel := context.WithTimeout(ctx, lim.wallTimeout()+interactorSlack)
+	defer icancel()
+	icmd := interactor.command(args...)
+	icmd.Stdin = toInteractorR
+	icmd.Stdout = toSubmissionW
+	iproc, err := s.startRun(ictx, icmd, "", sandbox.Limits{CPUTime: lim.timeout + interactorSlack, ReadOnlyPaths: []string{dir}})
+	if err != nil {
+		closePipes()
+		return domain.VerdictInternalError, runUsage{}, "", fmt.Errorf("interactor failed: %v", err)
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, lim.wallTimeout())
+	defer cancel()
+	cmd := submissionCommand(workDir, driver, lim.memoryLimitMB)
+	cmd.Stdin = toSubmissionR
+	cmd.Stdout = toInteractorW
+	proc, runErr := s.startRun(tctx, cmd, "", lim.sandbox())
+	closePipes()
+
+	var res *sandbox.Result
+	if runErr == nil {
+		res, runErr = proc.Wait()
+	}
+	_, usage, runErr := runOutcome(tctx, res, runErr, lim)
+
+	ires, ierr := iproc.Wait()
+	iverdict, msg, ierr := programVerdict("interactor", ires, ierr, ictx.Err())
+	if ierr != nil {
+		return domain.VerdictInternalError, usage, "", ierr
+	}
+
+	switch verdict := verdictOf(runErr); {
+	case verdict == domain.VerdictTimeLimitExceeded, verdict == domain.VerdictMemoryLimitExceeded, verdict == domain.VerdictOutputLimitExceeded, verdict == domain.VerdictInternalError:
+		return verdict, usage, msg, runErr
+	case iverdict == domain.VerdictWrongAnswer:
+		return domain.VerdictWrongAnswer, usage, msg, nil
+	case verdict == domain.VerdictRuntimeError:
+		return verdict, usage, msg, runErr
+	}
+	return domain.VerdictAccepted, usage, msg, nil
+}
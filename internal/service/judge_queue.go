@@ -0,0 +1,287 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type JudgeJobState string
+
+const (
+	JudgeJobStateQueued    JudgeJobState = "QUEUED"
+	JudgeJobStateCompiling JudgeJobState = "COMPILING"
+	JudgeJobStateRunning   JudgeJobState = "RUNNING"
+	JudgeJobStateDone      JudgeJobState = "DONE"
+)
+
+const (
+	defaultJudgeQueueSize = 100
+	// finished jobs stay pollable this long after they are done
+	judgeJobRetention = 10 * time.Minute
+)
+
+// JudgeJob is a submission waiting in or taken from the judge queue. Result
+// and Error are set once it is DONE; Error means the submission could not be
+// judged at all.
+type JudgeJob struct {
+	ID         string        `json:"submissionId"`
+	State      JudgeJobState `json:"status"`
+	ProblemID  string        `json:"problemId"`
+	Language   JudgeLanguage `json:"language"`
+	QueuedAt   time.Time     `json:"queuedAt"`
+	StartedAt  *time.Time    `json:"startedAt,omitempty"`
+	FinishedAt *time.Time    `json:"finishedAt,omitempty"`
+	Result     *JudgeResult  `json:"result,omitempty"`
+	Error      string        `json:"error,omitempty"`
+
+	userID string
+}
+
+// OwnedBy reports whether userID submitted the job. Jobs queued without a
+// user belong to nobody.
+func (j *JudgeJob) OwnedBy(userID string) bool {
+	return j.userID != "" && j.userID == userID
+}
+
+type judgeTask struct {
+	job    *JudgeJob
+	req    *judgeRequest
+	onDone func(*JudgeResult, error)
+	// attempts counts the remote workers the task was leased to.
+	attempts int
+	// custom, when set, is run by a local worker in place of judging req. It
+	// is a custom run, which has no job.
+	custom func()
+}
+
+// judgeQueue is a bounded queue drained by a fixed pool of workers, so the
+// number of submissions compiling and running at once stays capped no matter
+// how many requests arrive.
+type judgeQueue struct {
+	tasks chan *judgeTask
+	// background is the lane for work nobody is waiting on, such as
+	// rejudges. It is unbuffered and only read from when tasks is empty, so
+	// its senders wait for a worker with nothing else to do.
+	background chan *judgeTask
+	workers    int
+
+	mu   sync.Mutex
+	jobs map[string]*JudgeJob
+}
+
+func newJudgeQueue() *judgeQueue {
+	return &judgeQueue{
+		tasks:      make(chan *judgeTask, envInt("JUDGE_QUEUE_SIZE", defaultJudgeQueueSize)),
+		background: make(chan *judgeTask),
+		workers:    envInt("JUDGE_WORKERS", runtime.NumCPU()),
+		jobs:       map[string]*JudgeJob{},
+	}
+}
+
+func envInt(name string, def int) int {
+	raw := strings.TrimSpace(os.Getenv(name))
+	if raw == "" {
+		return def
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v <= 0 {
+		log.Printf("[JUDGE] ignoring invalid %s=%q", name, raw)
+		return def
+	}
+	return v
+}
+
+func (s *JudgeService) startWorkers() {
+	for i := 0; i < s.queue.workers; i++ {
+		go func() {
+			for {
+				s.process(s.queue.next())
+			}
+		}()
+	}
+}
+
+// next waits for a task, taking one from the background lane only when no
+// submission is queued.
+func (q *judgeQueue) next() *judgeTask {
+	select {
+	case t := <-q.tasks:
+		return t
+	default:
+	}
+	select {
+	case t := <-q.tasks:
+		return t
+	case t := <-q.background:
+		return t
+	}
+}
+
+// Enqueue validates a submission and queues it for judging, returning the
+// job right away. onDone, if set, runs on the worker with the outcome before
+// the job is marked DONE, so a client that sees DONE also sees its effects.
+func (s *JudgeService) Enqueue(ctx context.Context, problemID string, lang JudgeLanguage, code string, opts JudgeOptions, onDone func(*JudgeResult, error)) (*JudgeJob, error) {
+	t, err := s.newTask(ctx, problemID, lang, code, opts, onDone)
+	if err != nil {
+		return nil, err
+	}
+	job := t.job
+
+	s.queue.mu.Lock()
+	s.queue.pruneLocked(job.QueuedAt)
+	select {
+	case s.queue.tasks <- t:
+		s.queue.jobs[job.ID] = job
+	default:
+		s.queue.mu.Unlock()
+		t.req.done()
+		atomic.AddInt64(&s.metrics.queueRejected, 1)
+		return nil, fmt.Errorf("judge queue is full, try again later")
+	}
+	cp := *job
+	s.queue.mu.Unlock()
+	return &cp, nil
+}
+
+// judgeBackground judges a submission through the background lane and waits
+// for it. Rather than failing when no worker is free, it waits for one until
+// ctx is done.
+func (s *JudgeService) judgeBackground(ctx context.Context, problemID string, lang JudgeLanguage, code string, opts JudgeOptions) (*JudgeResult, error) {
+	type outcome struct {
+		res *JudgeResult
+		err error
+	}
+	done := make(chan outcome, 1)
+	t, err := s.newTask(ctx, problemID, lang, code, opts, func(res *JudgeResult, err error) {
+		done <- outcome{res, err}
+	})
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case s.queue.background <- t:
+	case <-ctx.Done():
+		t.req.done()
+		return nil, ctx.Err()
+	}
+	select {
+	case o := <-done:
+		return o.res, o.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// newTask validates a submission and wraps it in a job, not yet queued.
+func (s *JudgeService) newTask(ctx context.Context, problemID string, lang JudgeLanguage, code string, opts JudgeOptions, onDone func(*JudgeResult, error)) (*judgeTask, error) {
+	req, err := s.prepare(ctx, problemID, lang, code, opts)
+	if err != nil {
+		return nil, err
+	}
+	if s.workers != nil {
+		if err := s.workers.accepts(req.driver.Language()); err != nil {
+			req.done()
+			return nil, err
+		}
+	}
+	job := &JudgeJob{
+		ID:        uuid.NewString(),
+		State:     JudgeJobStateQueued,
+		ProblemID: req.problemID,
+		Language:  req.driver.Language(),
+		QueuedAt:  time.Now().UTC(),
+		userID:    opts.UserID,
+	}
+	return &judgeTask{job: job, req: req, onDone: onDone}, nil
+}
+
+// Job returns a snapshot of a queued or recently finished submission.
+func (s *JudgeService) Job(id string) (*JudgeJob, bool) {
+	s.queue.mu.Lock()
+	defer s.queue.mu.Unlock()
+	job, ok := s.queue.jobs[strings.TrimSpace(id)]
+	if !ok {
+		return nil, false
+	}
+	cp := *job
+	return &cp, true
+}
+
+func (q *judgeQueue) pruneLocked(now time.Time) {
+	for id, job := range q.jobs {
+		if job.FinishedAt != nil && now.Sub(*job.FinishedAt) > judgeJobRetention {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+func (s *JudgeService) setJobState(job *JudgeJob, state JudgeJobState) {
+	s.queue.mu.Lock()
+	job.State = state
+	s.queue.mu.Unlock()
+}
+
+func (s *JudgeService) process(t *judgeTask) {
+	if t.custom != nil {
+		t.custom()
+		return
+	}
+	s.startJob(t)
+	// The submitting request is long gone; the judge's own compile and
+	// testcase timeouts bound the run.
+	res, err := s.run(context.Background(), t.req, func(state JudgeJobState) {
+		s.setJobState(t.job, state)
+	})
+	s.finishJob(t, res, err)
+}
+
+// startJob marks a task as taken off the queue, locally or by a remote
+// worker. Only the first attempt counts towards the queue wait.
+func (s *JudgeService) startJob(t *judgeTask) {
+	startedAt := time.Now().UTC()
+	if t.attempts <= 1 {
+		s.observeQueueWait(startedAt.Sub(t.job.QueuedAt))
+	}
+
+	s.queue.mu.Lock()
+	t.job.State = JudgeJobStateCompiling
+	t.job.StartedAt = &startedAt
+	s.queue.mu.Unlock()
+}
+
+// finishJob hands the outcome to the task's onDone and marks it DONE.
+func (s *JudgeService) finishJob(t *judgeTask, res *JudgeResult, err error) {
+	t.req.done()
+	if err != nil {
+		log.Printf("[JUDGE] submission %s failed: %v", t.job.ID, err)
+	}
+	if t.onDone != nil {
+		t.onDone(res, err)
+	}
+
+	finishedAt := time.Now().UTC()
+	s.queue.mu.Lock()
+	t.job.State = JudgeJobStateDone
+	t.job.FinishedAt = &finishedAt
+	t.job.Result = res
+	if err != nil {
+		t.job.Error = err.Error()
+	}
+	s.queue.mu.Unlock()
+}
+
+func (s *JudgeService) observeQueueWait(wait time.Duration) {
+	s.metrics.mu.Lock()
+	s.metrics.queueWaitSamples = appendWindowedSample(s.metrics.queueWaitSamples, float64(wait)/float64(time.Millisecond), 120)
+	s.metrics.mu.Unlock()
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/AQADIL/JudGO/internal/domain"
+)
+
+func TestJobOwnership(t *testing.T) {
+	// Judging on a registered remote worker that never pulls keeps the jobs
+	// queued.
+	t.Setenv("JUDGE_REMOTE_WORKERS", "1")
+	t.Setenv("JUDGE_WORKER_TOKEN", "test")
+	problems := NewProblemService(&memProblemRepo{p: map[string]*domain.Problem{
+		"sum": {ID: "sum", TestCases: []domain.ProblemTestCase{{Input: "1 2", Output: "3"}}},
+	}}, nil)
+	judge := NewJudgeService(problems)
+	if _, err := judge.RegisterWorker(WorkerRegistration{Languages: []JudgeLanguage{JudgeLanguageGo}, Capacity: 1}); err != nil {
+		t.Fatalf("register worker: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		submitter string
+		userID    string
+		want      bool
+	}{
+		{"submitter", "alice", "alice", true},
+		{"someone else", "alice", "bob", false},
+		{"anonymous caller", "alice", "", false},
+		{"job without a user", "", "", false},
+		{"job without a user, any caller", "", "bob", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queued, err := judge.Enqueue(context.Background(), "sum", JudgeLanguageGo, "package main\nfunc main() {}", JudgeOptions{UserID: tt.submitter}, nil)
+			if err != nil {
+				t.Fatalf("enqueue: %v", err)
+			}
+			job, ok := judge.Job(queued.ID)
+			if !ok {
+				t.Fatal("queued job not found")
+			}
+			if got := job.OwnedBy(tt.userID); got != tt.want {
+				t.Fatalf("OwnedBy(%q) = %v, want %v", tt.userID, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueueNextPrefersSubmissions(t *testing.T) {
+	q := &judgeQueue{tasks: make(chan *judgeTask, 2), background: make(chan *judgeTask)}
+	live := []*judgeTask{{}, {}}
+	rejudge := &judgeTask{}
+
+	sent := make(chan struct{})
+	go func() {
+		q.background <- rejudge
+		close(sent)
+	}()
+	q.tasks <- live[0]
+	q.tasks <- live[1]
+	// Let the background sender block on the lane before anything is taken.
+	time.Sleep(10 * time.Millisecond)
+
+	for i, want := range []*judgeTask{live[0], live[1], rejudge} {
+		if got := q.next(); got != want {
+			t.Fatalf("task %d: got %p, want %p", i, got, want)
+		}
+	}
+	<-sent
+}
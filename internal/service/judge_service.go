@@ -1,10 +1,12 @@
 package service
 
 import (
-	"bytes"
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -14,73 +16,201 @@ import (
 	"sync/atomic"
 	"time"
 	"unicode"
+
+	"github.com/AQADIL/JudGO/internal/domain"
+	"github.com/AQADIL/JudGO/pkg/sandbox"
 )
 
 type JudgeLanguage string
 
 const (
-	JudgeLanguageGo     JudgeLanguage = "go"
-	JudgeLanguagePython JudgeLanguage = "py"
+	JudgeLanguageGo         JudgeLanguage = "go"
+	JudgeLanguagePython     JudgeLanguage = "py"
+	JudgeLanguageCPP        JudgeLanguage = "cpp"
+	JudgeLanguageJava       JudgeLanguage = "java"
+	JudgeLanguageRust       JudgeLanguage = "rust"
+	JudgeLanguageJavaScript JudgeLanguage = "js"
+)
+
+const (
+	// defaultTimeLimitMs is what problems without their own limit get: the
+	// 5s every submission had before limits were per problem.
+	defaultTimeLimitMs   = 5000
+	maxTimeLimitMs       = 10000
+	defaultMemoryLimitMB = 256
+	maxMemoryLimitMB     = 1024
+	defaultOutputLimitKB = 8 << 10
+	maxOutputLimitKB     = 64 << 10
+	// maxShownOutputBytes bounds the output echoed back for visible tests.
+	maxShownOutputBytes = 64 << 10
 )
 
 type TestcaseResult struct {
-	Index   int    `json:"index"`
-	Passed  bool   `json:"passed"`
-	Hidden  bool   `json:"hidden"`
+	Index   int            `json:"index"`
+	Passed  bool           `json:"passed"`
+	Verdict domain.Verdict `json:"verdict"`
+	Hidden  bool           `json:"hidden"`
+	// Runtime is wall-clock time including process start-up; the time limit
+	// is enforced on CPUTime.
 	Runtime int    `json:"runtimeMs"`
+	CPUTime int    `json:"cpuTimeMs"`
+	Memory  int    `json:"memoryKb"`
 	Error   string `json:"error,omitempty"`
 	Output  string `json:"output,omitempty"`
+	// OutputTruncated means Output is only the start of what the program
+	// printed.
+	OutputTruncated bool `json:"outputTruncated,omitempty"`
+	// CheckerMessage is the checker's explanation of its verdict; like
+	// Output it is omitted for hidden testcases.
+	CheckerMessage string `json:"checkerMessage,omitempty"`
+	// Input is only filled in by samples-only runs, which also set Expected
+	// and DiffLine whatever the verdict.
+	Input string `json:"input,omitempty"`
+	// Expected, DiffLine, DiffColumn, Mismatch and Diff explain a wrong
+	// answer on a visible test judged by exact comparison. DiffLine and
+	// DiffColumn are 1-based and point at the first difference; Diff is a
+	// bounded unified diff of Expected against Output.
+	Expected   string       `json:"expected,omitempty"`
+	DiffLine   int          `json:"diffLine,omitempty"`
+	DiffColumn int          `json:"diffColumn,omitempty"`
+	Mismatch   MismatchKind `json:"mismatch,omitempty"`
+	Diff       string       `json:"diff,omitempty"`
 }
 
 type JudgeResult struct {
-	ProblemID string           `json:"problemId"`
-	Language  JudgeLanguage    `json:"language"`
-	Passed    bool             `json:"passed"`
-	PassedCnt int              `json:"passedCount"`
-	TotalCnt  int              `json:"totalCount"`
-	Results   []TestcaseResult `json:"results"`
+	ProblemID    string         `json:"problemId"`
+	Language     JudgeLanguage  `json:"language"`
+	SamplesOnly  bool           `json:"samplesOnly,omitempty"`
+	Passed       bool           `json:"passed"`
+	Verdict      domain.Verdict `json:"verdict"`
+	CompileError string         `json:"compileError,omitempty"`
+	// PolicyViolations lists the disallowed imports found before compiling;
+	// under a FLAG policy the submission is judged anyway.
+	PolicyViolations    []string         `json:"policyViolations,omitempty"`
+	PassedCnt           int              `json:"passedCount"`
+	TotalCnt            int              `json:"totalCount"`
+	MemoryLimitMB       int              `json:"memoryLimitMb"`
+	MaxMemory           int              `json:"maxMemoryKb"`
+	MaxCPUTime          int              `json:"maxCpuTimeMs"`
+	MaxRuntime          int              `json:"maxRuntimeMs"`
+	MemoryLimitExceeded bool             `json:"memoryLimitExceeded"`
+	OutputLimitKB       int              `json:"outputLimitKb"`
+	Score               int              `json:"score"`
+	MaxScore            int              `json:"maxScore"`
+	Subtasks            []SubtaskResult  `json:"subtasks,omitempty"`
+	Results             []TestcaseResult `json:"results"`
+}
+
+// JudgeOptions are the per-submission knobs of a judge run. Limits come from
+// the problem.
+type JudgeOptions struct {
+	// StopOnFirstFailure skips every testcase after the first failing one,
+	// for callers that only need the verdict. It is ignored for problems
+	// with subtasks, where later subtasks can still earn points.
+	StopOnFirstFailure bool `json:"stopOnFirstFailure,omitempty"`
+	// SamplesOnly runs just the problem's visible testcases and reports
+	// their inputs and expected outputs with the results. Such a run is
+	// unscored: subtasks are ignored and Score stays 0.
+	SamplesOnly bool `json:"samplesOnly,omitempty"`
+	// UserID is who submitted the code; only they can look the job up.
+	UserID string `json:"-"`
 }
 
 type JudgeMetricsSnapshot struct {
-	Enabled           bool      `json:"enabled"`
-	ActiveSandboxes   int64     `json:"activeSandboxes"`
-	TotalRuns         int64     `json:"totalRuns"`
-	SuccessfulRuns    int64     `json:"successfulRuns"`
-	FailedRuns        int64     `json:"failedRuns"`
-	SuccessRatePct    float64   `json:"successRatePct"`
-	CompileErrors     int64     `json:"compileErrors"`
-	RuntimeErrors     int64     `json:"runtimeErrors"`
-	TimeLimitExceeded int64     `json:"timeLimitExceeded"`
-	CompileAvgMs      float64   `json:"compileAvgMs"`
-	CompileP95Ms      float64   `json:"compileP95Ms"`
-	JudgeAvgMs        float64   `json:"judgeAvgMs"`
-	JudgeP95Ms        float64   `json:"judgeP95Ms"`
-	LastDurationMs    float64   `json:"lastDurationMs"`
-	LastCompileMs     float64   `json:"lastCompileMs"`
-	LastResultAt      time.Time `json:"lastResultAt"`
+	Enabled             bool      `json:"enabled"`
+	Sandboxed           bool      `json:"sandboxed"`
+	ActiveSandboxes     int64     `json:"activeSandboxes"`
+	TotalRuns           int64     `json:"totalRuns"`
+	SuccessfulRuns      int64     `json:"successfulRuns"`
+	FailedRuns          int64     `json:"failedRuns"`
+	SuccessRatePct      float64   `json:"successRatePct"`
+	CompileErrors       int64     `json:"compileErrors"`
+	WrongAnswers        int64     `json:"wrongAnswers"`
+	RuntimeErrors       int64     `json:"runtimeErrors"`
+	TimeLimitExceeded   int64     `json:"timeLimitExceeded"`
+	MemoryLimitExceeded int64     `json:"memoryLimitExceeded"`
+	OutputLimitExceeded int64     `json:"outputLimitExceeded"`
+	PolicyViolations    int64     `json:"policyViolations"`
+	InternalErrors      int64     `json:"internalErrors"`
+	CompileAvgMs        float64   `json:"compileAvgMs"`
+	CompileCacheHits    int64     `json:"compileCacheHits"`
+	CompileCacheMisses  int64     `json:"compileCacheMisses"`
+	CompileP95Ms        float64   `json:"compileP95Ms"`
+	JudgeAvgMs          float64   `json:"judgeAvgMs"`
+	JudgeP95Ms          float64   `json:"judgeP95Ms"`
+	TestcaseCPUAvgMs    float64   `json:"testcaseCpuAvgMs"`
+	TestcaseCPUP95Ms    float64   `json:"testcaseCpuP95Ms"`
+	TestcaseWallAvgMs   float64   `json:"testcaseWallAvgMs"`
+	TestcaseWallP95Ms   float64   `json:"testcaseWallP95Ms"`
+	LastDurationMs      float64   `json:"lastDurationMs"`
+	LastCompileMs       float64   `json:"lastCompileMs"`
+	LastResultAt        time.Time `json:"lastResultAt"`
+	QueueDepth          int       `json:"queueDepth"`
+	QueueCapacity       int       `json:"queueCapacity"`
+	QueueWorkers        int       `json:"queueWorkers"`
+	RemoteWorkers       int       `json:"remoteWorkers"`
+	QueueRejected       int64     `json:"queueRejected"`
+	QueueWaitAvgMs      float64   `json:"queueWaitAvgMs"`
+	QueueWaitP95Ms      float64   `json:"queueWaitP95Ms"`
+	WarmPoolSize        int       `json:"warmPoolSize"`
+	WarmPoolIdle        int       `json:"warmPoolIdle"`
+	WarmPoolHits        int64     `json:"warmPoolHits"`
+	WarmPoolMisses      int64     `json:"warmPoolMisses"`
+	WarmPoolHitRatePct  float64   `json:"warmPoolHitRatePct"`
 }
 
 type JudgeService struct {
-	problems   *ProblemService
-	devMode    bool
-	metrics    judgeMetrics
-	goCacheDir string
+	problems  *ProblemService
+	devMode   bool
+	isolated  bool
+	metrics   judgeMetrics
+	languages *LanguageRegistry
+	programs  *programCache
+	queue     *judgeQueue
+	builds    *compileCache
+	// workers is set when submissions are judged by remote workers.
+	workers *workerPool
+	// testData is where tests that only carry checksums are read from.
+	testData TestDataStore
+	// warm holds runtimes started ahead of the runs that use them; nil when
+	// disabled.
+	warm *warmPool
+	// testParallelism caps the testcases one submission runs at once;
+	// sandboxSlots caps the runs across all submissions.
+	testParallelism int
+	sandboxSlots    chan struct{}
 }
 
 type judgeMetrics struct {
-	activeSandboxes   int64
-	totalRuns         int64
-	successfulRuns    int64
-	failedRuns        int64
-	compileErrors     int64
-	runtimeErrors     int64
-	timeLimitExceeded int64
-	lastDurationNs    int64
-	lastCompileNs     int64
-	lastResultAtNs    int64
-	mu                sync.Mutex
-	compileSamples    []float64
-	judgeSamples      []float64
+	activeSandboxes     int64
+	totalRuns           int64
+	successfulRuns      int64
+	failedRuns          int64
+	compileErrors       int64
+	compileCacheHits    int64
+	compileCacheMisses  int64
+	wrongAnswers        int64
+	runtimeErrors       int64
+	timeLimitExceeded   int64
+	memoryLimitExceeded int64
+	outputLimitExceeded int64
+	policyViolations    int64
+	internalErrors      int64
+	lastDurationNs      int64
+	lastCompileNs       int64
+	lastResultAtNs      int64
+	queueRejected       int64
+	mu                  sync.Mutex
+	compileSamples      []float64
+	judgeSamples        []float64
+	queueWaitSamples    []float64
+	testCPUSamples      []float64
+	testWallSamples     []float64
+	// The OpenMetrics series, cumulative since start.
+	runs              map[judgeRunKey]int64
+	judgeDurations    histogramVec
+	compileDurations  histogramVec
+	testcaseDurations histogramVec
 }
 
 func NewJudgeService(problems *ProblemService) *JudgeService {
@@ -93,40 +223,126 @@ func NewJudgeService(problems *ProblemService) *JudgeService {
 		_ = os.MkdirAll(cacheDir, 0755)
 	}
 
-	svc := &JudgeService{problems: problems, devMode: dev, goCacheDir: cacheDir}
-	if dev {
-		go svc.warmGoCache()
+	isolated := sandbox.Supported()
+	if isolated {
+		log.Println("[JUDGE] Sandbox isolation enabled")
+		if !sandbox.PidsCgroup() {
+			log.Println("[JUDGE] WARNING: no pids cgroup delegated; sandboxed process counts are bounded by RLIMIT_NPROC only, which kernels before 5.14 count per host user")
+		}
+	} else {
+		log.Printf("[JUDGE] Sandbox isolation unavailable: %v", sandbox.SupportError())
+	}
+
+	languages := NewLanguageRegistry(cacheDir)
+	svc := &JudgeService{problems: problems, devMode: dev, isolated: isolated, languages: languages, programs: newProgramCache(), queue: newJudgeQueue(), builds: newCompileCache(), workers: newWorkerPool()}
+	if problems != nil {
+		svc.testData = problems.testData
+	}
+	svc.metrics.runs = map[judgeRunKey]int64{}
+	svc.metrics.judgeDurations = newHistogramVec(judgeDurationBuckets)
+	svc.metrics.compileDurations = newHistogramVec(compileDurationBuckets)
+	svc.metrics.testcaseDurations = newHistogramVec(testcaseDurationBuckets)
+	svc.testParallelism = envInt("JUDGE_TESTCASE_PARALLELISM", defaultTestcaseParallelism)
+	svc.sandboxSlots = make(chan struct{}, envInt("JUDGE_MAX_SANDBOXES", runtime.NumCPU()))
+	if svc.workers != nil {
+		// Workers check their own toolchains; the API only needs to know
+		// every language by name.
+		svc.languages = NewFullLanguageRegistry(cacheDir)
+		log.Println("[JUDGE] Judging on remote workers")
+		go svc.reapWorkers()
+	} else {
+		svc.startWorkers()
+	}
+	if svc.enabled() {
+		if d, err := languages.Resolve(string(JudgeLanguageGo)); err == nil {
+			go d.(*goDriver).warm()
+		}
+	}
+	if isolated && svc.workers == nil {
+		if svc.warm = newWarmPool(svc.sandboxSlots); svc.warm != nil {
+			if d, err := languages.Resolve(string(JudgeLanguagePython)); err == nil {
+				svc.warm.pin(d)
+			}
+		}
 	}
 	return svc
 }
 
-func (s *JudgeService) warmGoCache() {
-	dir, err := os.MkdirTemp("", "judgo-warmup-*")
-	if err != nil {
-		return
-	}
-	defer os.RemoveAll(dir)
+// enabled reports whether submissions can be judged: either every run is
+// isolated, or JUDGE_DEV explicitly allows running them unsandboxed.
+func (s *JudgeService) enabled() bool {
+	return s.isolated || s.devMode
+}
 
-	_ = os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module warmup\ngo 1.21\n"), 0644)
-	_ = os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\nimport \"fmt\"\nfunc main(){fmt.Println(0)}\n"), 0644)
+func normalizeOutput(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.TrimRightFunc(s, unicode.IsSpace)
+}
 
-	binName := "warmup"
-	if runtime.GOOS == "windows" {
-		binName += ".exe"
+// outputMatches reports whether expected, normalized the way normalizeOutput
+// does it, equals want, which is already normalized. expected is read as a
+// stream, so it is never held whole.
+func outputMatches(want string, expected io.Reader) (bool, error) {
+	r := bufio.NewReader(expected)
+	for i := 0; i < len(want); i++ {
+		c, err := r.ReadByte()
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if c == '\r' {
+			if next, err := r.Peek(1); err == nil && next[0] == '\n' {
+				r.ReadByte()
+				c = '\n'
+			}
+		}
+		if c != want[i] {
+			return false, nil
+		}
+	}
+	// want does not end in whitespace, so whatever expected has past it has
+	// to be trailing whitespace.
+	for {
+		c, _, err := r.ReadRune()
+		if err == io.EOF {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if !unicode.IsSpace(c) {
+			return false, nil
+		}
 	}
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
-	defer cancel()
+// shownOutput cuts output down to what is echoed back for a visible test and
+// marks it when anything is missing, whether cut here or by the output limit.
+func shownOutput(out string, truncated bool) (string, bool) {
+	if len(out) > maxShownOutputBytes {
+		out = strings.ToValidUTF8(out[:maxShownOutputBytes], "")
+		truncated = true
+	}
+	if truncated {
+		out += "\n... [output truncated]"
+	}
+	return out, truncated
+}
 
-	cmd := exec.CommandContext(ctx, "go", "build", "-o", binName, "main.go")
-	cmd.Dir = dir
-	cmd.Env = s.goBuildEnv()
-	_ = cmd.Run()
+// Languages lists the language drivers registered on this host.
+func (s *JudgeService) Languages() []LanguageInfo {
+	return s.languages.List()
 }
 
-func normalizeOutput(s string) string {
-	s = strings.ReplaceAll(s, "\r\n", "\n")
-	return strings.TrimRightFunc(s, unicode.IsSpace)
+// ResolveLanguage maps a user-supplied language name to a registered driver.
+func (s *JudgeService) ResolveLanguage(name string) (JudgeLanguage, error) {
+	d, err := s.languages.Resolve(name)
+	if err != nil {
+		return "", err
+	}
+	return d.Language(), nil
 }
 
 func (s *JudgeService) MetricsSnapshot() JudgeMetricsSnapshot {
@@ -134,8 +350,11 @@ func (s *JudgeService) MetricsSnapshot() JudgeMetricsSnapshot {
 	successfulRuns := atomic.LoadInt64(&s.metrics.successfulRuns)
 	failedRuns := atomic.LoadInt64(&s.metrics.failedRuns)
 	compileErrors := atomic.LoadInt64(&s.metrics.compileErrors)
+	wrongAnswers := atomic.LoadInt64(&s.metrics.wrongAnswers)
 	runtimeErrors := atomic.LoadInt64(&s.metrics.runtimeErrors)
 	timeLimitExceeded := atomic.LoadInt64(&s.metrics.timeLimitExceeded)
+	memoryLimitExceeded := atomic.LoadInt64(&s.metrics.memoryLimitExceeded)
+	internalErrors := atomic.LoadInt64(&s.metrics.internalErrors)
 	lastDurationMs := float64(atomic.LoadInt64(&s.metrics.lastDurationNs)) / float64(time.Millisecond)
 	lastCompileMs := float64(atomic.LoadInt64(&s.metrics.lastCompileNs)) / float64(time.Millisecond)
 	lastResultAtNs := atomic.LoadInt64(&s.metrics.lastResultAtNs)
@@ -146,45 +365,146 @@ func (s *JudgeService) MetricsSnapshot() JudgeMetricsSnapshot {
 	s.metrics.mu.Lock()
 	compileSamples := append([]float64(nil), s.metrics.compileSamples...)
 	judgeSamples := append([]float64(nil), s.metrics.judgeSamples...)
+	queueWaitSamples := append([]float64(nil), s.metrics.queueWaitSamples...)
+	testCPUSamples := append([]float64(nil), s.metrics.testCPUSamples...)
+	testWallSamples := append([]float64(nil), s.metrics.testWallSamples...)
 	s.metrics.mu.Unlock()
 	successRate := 0.0
 	if totalRuns > 0 {
 		successRate = float64(successfulRuns) / float64(totalRuns) * 100
 	}
+	queueWorkers := s.queue.workers
+	remoteWorkers := 0
+	if s.workers != nil {
+		workers := s.Workers()
+		remoteWorkers, queueWorkers = len(workers), 0
+		for _, w := range workers {
+			queueWorkers += w.Capacity
+		}
+	}
+	var warmSize, warmIdle int
+	var warmHits, warmMisses int64
+	warmHitRate := 0.0
+	if s.warm != nil {
+		warmSize, warmIdle = s.warm.size, s.warm.idleCount()
+		warmHits, warmMisses = atomic.LoadInt64(&s.warm.hits), atomic.LoadInt64(&s.warm.misses)
+		if warmHits+warmMisses > 0 {
+			warmHitRate = float64(warmHits) / float64(warmHits+warmMisses) * 100
+		}
+	}
 	return JudgeMetricsSnapshot{
-		Enabled:           s.devMode,
-		ActiveSandboxes:   atomic.LoadInt64(&s.metrics.activeSandboxes),
-		TotalRuns:         totalRuns,
-		SuccessfulRuns:    successfulRuns,
-		FailedRuns:        failedRuns,
-		SuccessRatePct:    round2(successRate),
-		CompileErrors:     compileErrors,
-		RuntimeErrors:     runtimeErrors,
-		TimeLimitExceeded: timeLimitExceeded,
-		CompileAvgMs:      round2(averageFloat64(compileSamples)),
-		CompileP95Ms:      round2(computePercentile(compileSamples, 0.95)),
-		JudgeAvgMs:        round2(averageFloat64(judgeSamples)),
-		JudgeP95Ms:        round2(computePercentile(judgeSamples, 0.95)),
-		LastDurationMs:    round2(lastDurationMs),
-		LastCompileMs:     round2(lastCompileMs),
-		LastResultAt:      lastResultAt,
-	}
-}
-
-func (s *JudgeService) Judge(ctx context.Context, problemID string, lang JudgeLanguage, code string, timeout time.Duration) (*JudgeResult, error) {
-	if !s.devMode {
-		return nil, fmt.Errorf("judge is disabled (set JUDGE_DEV=1)")
+		Enabled:             s.enabled() || s.workers != nil,
+		Sandboxed:           s.isolated,
+		ActiveSandboxes:     atomic.LoadInt64(&s.metrics.activeSandboxes),
+		TotalRuns:           totalRuns,
+		SuccessfulRuns:      successfulRuns,
+		FailedRuns:          failedRuns,
+		SuccessRatePct:      round2(successRate),
+		CompileErrors:       compileErrors,
+		WrongAnswers:        wrongAnswers,
+		RuntimeErrors:       runtimeErrors,
+		TimeLimitExceeded:   timeLimitExceeded,
+		MemoryLimitExceeded: memoryLimitExceeded,
+		OutputLimitExceeded: atomic.LoadInt64(&s.metrics.outputLimitExceeded),
+		PolicyViolations:    atomic.LoadInt64(&s.metrics.policyViolations),
+		InternalErrors:      internalErrors,
+		CompileAvgMs:        round2(averageFloat64(compileSamples)),
+		CompileCacheHits:    atomic.LoadInt64(&s.metrics.compileCacheHits),
+		CompileCacheMisses:  atomic.LoadInt64(&s.metrics.compileCacheMisses),
+		CompileP95Ms:        round2(computePercentile(compileSamples, 0.95)),
+		JudgeAvgMs:          round2(averageFloat64(judgeSamples)),
+		JudgeP95Ms:          round2(computePercentile(judgeSamples, 0.95)),
+		TestcaseCPUAvgMs:    round2(averageFloat64(testCPUSamples)),
+		TestcaseCPUP95Ms:    round2(computePercentile(testCPUSamples, 0.95)),
+		TestcaseWallAvgMs:   round2(averageFloat64(testWallSamples)),
+		TestcaseWallP95Ms:   round2(computePercentile(testWallSamples, 0.95)),
+		LastDurationMs:      round2(lastDurationMs),
+		LastCompileMs:       round2(lastCompileMs),
+		LastResultAt:        lastResultAt,
+		QueueDepth:          len(s.queue.tasks),
+		QueueCapacity:       cap(s.queue.tasks),
+		QueueWorkers:        queueWorkers,
+		RemoteWorkers:       remoteWorkers,
+		QueueRejected:       atomic.LoadInt64(&s.metrics.queueRejected),
+		QueueWaitAvgMs:      round2(averageFloat64(queueWaitSamples)),
+		QueueWaitP95Ms:      round2(computePercentile(queueWaitSamples, 0.95)),
+		WarmPoolSize:        warmSize,
+		WarmPoolIdle:        warmIdle,
+		WarmPoolHits:        warmHits,
+		WarmPoolMisses:      warmMisses,
+		WarmPoolHitRatePct:  round2(warmHitRate),
+	}
+}
+
+// judgeRequest is a validated submission, ready to be compiled and run.
+type judgeRequest struct {
+	problemID string
+	problem   *domain.Problem
+	driver    LanguageDriver
+	code      string
+	timeout   time.Duration
+	stopEarly bool
+	samples   bool
+	// opts is kept so the request can be handed to a remote worker as is.
+	opts JudgeOptions
+	// release lets go of the problem's test data version, which is held
+	// from loading the problem until the request is judged.
+	release func()
+}
+
+// done releases what the request holds once it is judged or dropped.
+func (r *judgeRequest) done() {
+	if r.release != nil {
+		r.release()
+	}
+}
+
+// Judge compiles and runs a submission against every testcase, blocking
+// until it is done. Handlers go through Enqueue instead.
+func (s *JudgeService) Judge(ctx context.Context, problemID string, lang JudgeLanguage, code string, opts JudgeOptions) (*JudgeResult, error) {
+	if s.workers != nil {
+		return s.judgeRemote(ctx, problemID, lang, code, opts)
+	}
+	req, err := s.prepare(ctx, problemID, lang, code, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer req.done()
+	return s.run(ctx, req, nil)
+}
+
+// judgeRemote queues a submission for the remote workers and waits for it.
+func (s *JudgeService) judgeRemote(ctx context.Context, problemID string, lang JudgeLanguage, code string, opts JudgeOptions) (*JudgeResult, error) {
+	type outcome struct {
+		res *JudgeResult
+		err error
+	}
+	done := make(chan outcome, 1)
+	if _, err := s.Enqueue(ctx, problemID, lang, code, opts, func(res *JudgeResult, err error) {
+		done <- outcome{res, err}
+	}); err != nil {
+		return nil, err
+	}
+	select {
+	case o := <-done:
+		return o.res, o.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// prepare validates a submission and loads its problem, so bad requests are
+// rejected before they take a queue slot.
+func (s *JudgeService) prepare(ctx context.Context, problemID string, lang JudgeLanguage, code string, opts JudgeOptions) (*judgeRequest, error) {
+	if !s.enabled() && s.workers == nil {
+		return nil, fmt.Errorf("judge is disabled: sandbox isolation is unavailable (set JUDGE_DEV=1 to run unsandboxed)")
 	}
 	problemID = strings.TrimSpace(problemID)
 	if problemID == "" {
 		return nil, fmt.Errorf("problemId is required")
 	}
-	code = strings.TrimSpace(code)
-	if code == "" {
-		return nil, fmt.Errorf("code is required")
-	}
-	if timeout <= 0 {
-		timeout = 2 * time.Second
+	if _, err := s.languages.Resolve(string(lang)); err != nil {
+		return nil, err
 	}
 
 	p, err := s.problems.GetAdmin(ctx, problemID)
@@ -194,9 +514,60 @@ func (s *JudgeService) Judge(ctx context.Context, problemID string, lang JudgeLa
 	if p == nil {
 		return nil, fmt.Errorf("problem not found")
 	}
+	req, err := s.prepareProblem(p, problemID, lang, code, opts)
+	if err != nil {
+		return nil, err
+	}
+	req.release = s.problems.holdTestData(p)
+	return req, nil
+}
+
+// prepareProblem validates a submission against an already loaded problem.
+// Remote workers start here, with the problem sent along with the job.
+func (s *JudgeService) prepareProblem(p *domain.Problem, problemID string, lang JudgeLanguage, code string, opts JudgeOptions) (*judgeRequest, error) {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return nil, fmt.Errorf("code is required")
+	}
+	driver, err := s.languages.Resolve(string(lang))
+	if err != nil {
+		return nil, err
+	}
 	if len(p.TestCases) == 0 {
 		return nil, fmt.Errorf("problem has no testCases")
 	}
+	if p.Type == domain.ProblemTypeInteractive && p.Interactor == nil {
+		return nil, fmt.Errorf("interactive problem has no interactor")
+	}
+	if opts.SamplesOnly {
+		p = sampleProblem(p)
+		if len(p.TestCases) == 0 {
+			return nil, fmt.Errorf("problem has no sample testCases")
+		}
+	}
+	return &judgeRequest{problemID: problemID, problem: p, driver: driver, code: code, timeout: timeLimit(p, driver), stopEarly: opts.StopOnFirstFailure && len(p.Subtasks) == 0, samples: opts.SamplesOnly, opts: opts}, nil
+}
+
+// sampleProblem is a copy of p reduced to its visible testcases and without
+// subtasks, whose test indices would no longer line up.
+func sampleProblem(p *domain.Problem) *domain.Problem {
+	cp := *p
+	cp.Subtasks = nil
+	cp.TestCases = make([]domain.ProblemTestCase, 0, len(p.TestCases))
+	for _, tc := range p.TestCases {
+		if !tc.IsHidden {
+			cp.TestCases = append(cp.TestCases, tc)
+		}
+	}
+	return &cp
+}
+
+// run judges a prepared submission. progress, when set, is told when
+// compilation finishes and testcases start running.
+func (s *JudgeService) run(ctx context.Context, req *judgeRequest, progress func(JudgeJobState)) (*JudgeResult, error) {
+	p, driver, code, timeout := req.problem, req.driver, req.code, req.timeout
+	lang := driver.Language()
+	problemID := req.problemID
 
 	judgeStartedAt := time.Now()
 
@@ -209,97 +580,209 @@ func (s *JudgeService) Judge(ctx context.Context, problemID string, lang JudgeLa
 	defer atomic.AddInt64(&s.metrics.activeSandboxes, -1)
 	defer os.RemoveAll(workDir)
 
-	switch lang {
-	case JudgeLanguageGo:
-		if err := os.WriteFile(filepath.Join(workDir, "main.go"), []byte(code), 0644); err != nil {
-			return nil, fmt.Errorf("failed to write main.go: %w", err)
+	if err := os.WriteFile(filepath.Join(workDir, driver.SourceFile()), []byte(code), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", driver.SourceFile(), err)
+	}
+
+	lim := runLimits{timeout: timeout, memoryLimitMB: memoryLimitMB(p), outputLimitKB: p.OutputLimitKB, seccomp: driver.SeccompProfile()}
+	if lim.outputLimitKB <= 0 {
+		lim.outputLimitKB = defaultOutputLimitKB
+	}
+
+	res := &JudgeResult{
+		ProblemID:     problemID,
+		Language:      lang,
+		SamplesOnly:   req.samples,
+		Passed:        true,
+		Verdict:       domain.VerdictAccepted,
+		TotalCnt:      len(p.TestCases),
+		MemoryLimitMB: lim.memoryLimitMB,
+		OutputLimitKB: lim.outputLimitKB,
+		MaxScore:      maxScore(p),
+		Results:       make([]TestcaseResult, 0, len(p.TestCases)),
+	}
+
+	if action, violations := checkPolicy(p, lang, code); len(violations) > 0 {
+		res.PolicyViolations = violations
+		if action == domain.PolicyActionReject {
+			res.Passed = false
+			res.Verdict = domain.VerdictPolicyViolation
+			s.observeJudgeCompletion(lang, res.Verdict, time.Since(judgeStartedAt), 0)
+			return res, nil
 		}
-	case JudgeLanguagePython:
-		if err := os.WriteFile(filepath.Join(workDir, "main.py"), []byte(code), 0644); err != nil {
-			return nil, fmt.Errorf("failed to write main.py: %w", err)
+	}
+
+	var checker, interactor *programBuild
+	if p.Checker != nil {
+		checker, err = s.programs.get(s.languages, p.Checker)
+		if err != nil {
+			s.observeJudgeFailure(lang, time.Since(judgeStartedAt), 0)
+			return nil, fmt.Errorf("internal error: checker %v", err)
+		}
+	}
+	if p.Type == domain.ProblemTypeInteractive {
+		interactor, err = s.programs.get(s.languages, p.Interactor)
+		if err != nil {
+			s.observeJudgeFailure(lang, time.Since(judgeStartedAt), 0)
+			return nil, fmt.Errorf("internal error: interactor %v", err)
 		}
-	default:
-		return nil, fmt.Errorf("unsupported language: %s", lang)
 	}
 
-	goBin, compileDuration, err := s.buildGoBinary(ctx, workDir, lang, timeout)
+	compileDuration, err := s.compile(ctx, driver, workDir, code, timeout)
 	if err != nil {
-		s.observeJudgeFailure(err, time.Since(judgeStartedAt), compileDuration)
-		return nil, err
+		if verdictOf(err) != domain.VerdictCompileError {
+			s.observeJudgeFailure(lang, time.Since(judgeStartedAt), compileDuration)
+			return nil, err
+		}
+		res.Passed = false
+		res.Verdict = domain.VerdictCompileError
+		res.CompileError = err.Error()
+		s.observeJudgeCompletion(lang, res.Verdict, time.Since(judgeStartedAt), compileDuration)
+		return res, nil
 	}
-
-	res := &JudgeResult{
-		ProblemID: problemID,
-		Language:  lang,
-		Passed:    true,
-		TotalCnt:  len(p.TestCases),
-		Results:   make([]TestcaseResult, 0, len(p.TestCases)),
+	if s.isolated {
+		if err := sandbox.PrepareWorkDir(workDir); err != nil {
+			return nil, fmt.Errorf("failed to prepare sandbox dir: %w", err)
+		}
+	}
+	if progress != nil {
+		progress(JudgeJobStateRunning)
 	}
 
-	hadRuntimeError := false
-	hadTimeLimitExceeded := false
-	for i, tc := range p.TestCases {
+	runTestcase := func(i int, tc domain.ProblemTestCase) TestcaseResult {
 		start := time.Now()
-		out, runErr := s.runOnce(ctx, workDir, lang, goBin, tc.Input, timeout)
-		runtimeMs := int(time.Since(start).Milliseconds())
+		var out string
+		var usage runUsage
+		var runErr error
+		var verdict domain.Verdict
+		checkerMessage := ""
+		failed := func(err error) TestcaseResult {
+			return TestcaseResult{Index: i, Verdict: domain.VerdictInternalError, Hidden: tc.IsHidden, Error: err.Error()}
+		}
+		if interactor != nil {
+			verdict, usage, checkerMessage, runErr = s.interact(ctx, workDir, driver, interactor, p, tc, lim)
+		} else {
+			input, err := s.openTestData(ctx, p, tc.Input, tc.InputSHA256)
+			if err != nil {
+				return failed(err)
+			}
+			out, usage, runErr = s.runOnce(ctx, workDir, driver, input, lim)
+			input.Close()
+			verdict = verdictOf(runErr)
+		}
+		wall := time.Since(start)
+		s.observeTestcase(lang, usage.cpuTime, wall)
 
+		// The expected output is only read whole when it is shown; judging
+		// streams it from the test data.
+		expected := ""
+		if interactor == nil && (!tc.IsHidden || req.samples) {
+			var err error
+			if expected, err = s.readTestData(ctx, p, tc.Output, tc.OutputSHA256); err != nil {
+				return failed(err)
+			}
+		}
 		nOut := normalizeOutput(out)
-		nExp := normalizeOutput(tc.Output)
+		nExp := normalizeOutput(expected)
 
-		passed := runErr == nil && nOut == nExp
+		if verdict == domain.VerdictAccepted && interactor == nil {
+			if checker != nil {
+				verdict, checkerMessage, runErr = s.check(ctx, checker, p, tc, out)
+				if runErr != nil {
+					verdict = domain.VerdictInternalError
+				}
+			} else if match, err := s.matchOutput(ctx, p, tc, nOut); err != nil {
+				return failed(err)
+			} else if !match {
+				verdict = domain.VerdictWrongAnswer
+			}
+		}
 		tr := TestcaseResult{
 			Index:   i,
-			Passed:  passed,
+			Passed:  verdict == domain.VerdictAccepted,
+			Verdict: verdict,
 			Hidden:  tc.IsHidden,
-			Runtime: runtimeMs,
+			Runtime: int(wall.Milliseconds()),
+			CPUTime: int(usage.cpuTime.Milliseconds()),
+			Memory:  usage.memoryKB,
 		}
 		if runErr != nil {
 			tr.Error = runErr.Error()
-			if strings.Contains(strings.ToLower(runErr.Error()), "time limit exceeded") {
-				hadTimeLimitExceeded = true
-			} else {
-				hadRuntimeError = true
-			}
 		}
 		if !tc.IsHidden {
-			tr.Output = nOut
+			tr.Output, tr.OutputTruncated = shownOutput(nOut, verdict == domain.VerdictOutputLimitExceeded)
+			tr.CheckerMessage = checkerMessage
 		}
+		if req.samples && interactor == nil {
+			tr.Input = tc.Input
+			tr.Expected, _ = shownOutput(nExp, false)
+			tr.DiffLine = firstDiffLine(nOut, nExp)
+		}
+		if verdict == domain.VerdictWrongAnswer && !tc.IsHidden && interactor == nil && checker == nil {
+			m := diagnoseMismatch(nOut, nExp)
+			tr.Expected, _ = shownOutput(nExp, false)
+			tr.DiffLine = m.line
+			tr.DiffColumn = m.column
+			tr.Mismatch = m.kind
+			tr.Diff = m.diff
+		}
+		return tr
+	}
 
+	results := s.runTestcases(ctx, p.TestCases, req.stopEarly, runTestcase)
+	for _, tr := range results {
+		if tr.Memory > res.MaxMemory {
+			res.MaxMemory = tr.Memory
+		}
+		if tr.CPUTime > res.MaxCPUTime {
+			res.MaxCPUTime = tr.CPUTime
+		}
+		if tr.Runtime > res.MaxRuntime {
+			res.MaxRuntime = tr.Runtime
+		}
+		if tr.Verdict == domain.VerdictMemoryLimitExceeded {
+			res.MemoryLimitExceeded = true
+		}
 		res.Results = append(res.Results, tr)
-		if passed {
+		if tr.Passed {
 			res.PassedCnt++
 		} else {
 			res.Passed = false
+			// The submission takes the verdict of its first failing testcase.
+			if res.Verdict == domain.VerdictAccepted {
+				res.Verdict = tr.Verdict
+			}
 		}
 	}
 
-	s.observeJudgeCompletion(res.Passed, time.Since(judgeStartedAt), compileDuration, hadRuntimeError, hadTimeLimitExceeded)
+	if !req.samples {
+		scoreSubtasks(p, res)
+	}
+
+	s.observeJudgeCompletion(lang, res.Verdict, time.Since(judgeStartedAt), compileDuration)
 
 	return res, nil
 }
 
-func (s *JudgeService) goBuildEnv() []string {
-	env := os.Environ()
-	env = append(env, "GOCACHE="+s.goCacheDir)
-	env = append(env, "GOFLAGS=-trimpath")
-	return env
-}
-
-func (s *JudgeService) buildGoBinary(ctx context.Context, workDir string, lang JudgeLanguage, timeout time.Duration) (string, time.Duration, error) {
-	startedAt := time.Now()
-	if lang != JudgeLanguageGo {
-		return "", 0, nil
-	}
-	// go run per testcase is too slow on Windows; compile once then execute.
-	binName := "main_bin"
-	if runtime.GOOS == "windows" {
-		binName += ".exe"
+// compile builds the submission in workDir, reusing a cached build of the
+// same source when there is one. A cache hit reports no compile time, so the
+// compile samples only reflect real compiler runs.
+func (s *JudgeService) compile(ctx context.Context, driver LanguageDriver, workDir, code string, timeout time.Duration) (time.Duration, error) {
+	var pending *compileEntry
+	if key := s.builds.key(driver, code); key != "" {
+		hit, e, err := s.builds.restore(ctx, key, workDir)
+		if err != nil {
+			return 0, err
+		}
+		if hit {
+			atomic.AddInt64(&s.metrics.compileCacheHits, 1)
+			return 0, nil
+		}
+		atomic.AddInt64(&s.metrics.compileCacheMisses, 1)
+		pending = e
 	}
-	binPath := filepath.Join(workDir, binName)
-
-	// write go.mod so the toolchain skips module discovery
-	_ = os.WriteFile(filepath.Join(workDir, "go.mod"), []byte("module submission\ngo 1.21\n"), 0644)
 
+	startedAt := time.Now()
 	buildTimeout := 30 * time.Second
 	if timeout > 0 {
 		// give build more room than per-testcase timeout
@@ -311,64 +794,73 @@ func (s *JudgeService) buildGoBinary(ctx context.Context, workDir string, lang J
 
 	bctx, cancel := context.WithTimeout(ctx, buildTimeout)
 	defer cancel()
-
-	cmd := exec.CommandContext(bctx, "go", "build", "-o", binName, "main.go")
-	cmd.Dir = workDir
-	cmd.Env = s.goBuildEnv()
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		if bctx.Err() == context.DeadlineExceeded {
-			return "", time.Since(startedAt), fmt.Errorf("compile time limit exceeded")
-		}
-		errMsg := strings.TrimSpace(string(out))
-		if errMsg == "" {
-			errMsg = err.Error()
-		}
-		return "", time.Since(startedAt), fmt.Errorf("compile error: %s", errMsg)
+	err := driver.Compile(bctx, workDir)
+	duration := time.Since(startedAt)
+	if pending != nil {
+		s.builds.store(pending, workDir, err)
 	}
-
-	return binPath, time.Since(startedAt), nil
+	return duration, err
 }
 
-func (s *JudgeService) observeJudgeFailure(err error, duration time.Duration, compileDuration time.Duration) {
+// observeJudgeFailure records a judge run that ended without a verdict for
+// the submission, e.g. because the toolchain or sandbox could not be set up.
+func (s *JudgeService) observeJudgeFailure(lang JudgeLanguage, duration time.Duration, compileDuration time.Duration) {
 	atomic.AddInt64(&s.metrics.failedRuns, 1)
-	lower := strings.ToLower(strings.TrimSpace(err.Error()))
-	if strings.Contains(lower, "compile") {
-		atomic.AddInt64(&s.metrics.compileErrors, 1)
-	}
-	if strings.Contains(lower, "runtime error") {
-		atomic.AddInt64(&s.metrics.runtimeErrors, 1)
-	}
-	if strings.Contains(lower, "time limit exceeded") {
-		atomic.AddInt64(&s.metrics.timeLimitExceeded, 1)
-	}
-	s.observeJudgeDurations(duration, compileDuration)
+	atomic.AddInt64(&s.metrics.internalErrors, 1)
+	s.observeJudgeDurations(lang, domain.VerdictInternalError, duration, compileDuration)
 }
 
-func (s *JudgeService) observeJudgeCompletion(passed bool, duration time.Duration, compileDuration time.Duration, hadRuntimeError bool, hadTimeLimitExceeded bool) {
-	if passed {
+func (s *JudgeService) observeJudgeCompletion(lang JudgeLanguage, verdict domain.Verdict, duration time.Duration, compileDuration time.Duration) {
+	if verdict == domain.VerdictAccepted {
 		atomic.AddInt64(&s.metrics.successfulRuns, 1)
 	} else {
 		atomic.AddInt64(&s.metrics.failedRuns, 1)
 	}
-	if hadRuntimeError {
+	switch verdict {
+	case domain.VerdictCompileError:
+		atomic.AddInt64(&s.metrics.compileErrors, 1)
+	case domain.VerdictWrongAnswer:
+		atomic.AddInt64(&s.metrics.wrongAnswers, 1)
+	case domain.VerdictRuntimeError:
 		atomic.AddInt64(&s.metrics.runtimeErrors, 1)
-	}
-	if hadTimeLimitExceeded {
+	case domain.VerdictTimeLimitExceeded:
 		atomic.AddInt64(&s.metrics.timeLimitExceeded, 1)
+	case domain.VerdictMemoryLimitExceeded:
+		atomic.AddInt64(&s.metrics.memoryLimitExceeded, 1)
+	case domain.VerdictOutputLimitExceeded:
+		atomic.AddInt64(&s.metrics.outputLimitExceeded, 1)
+	case domain.VerdictPolicyViolation:
+		atomic.AddInt64(&s.metrics.policyViolations, 1)
+	case domain.VerdictInternalError:
+		atomic.AddInt64(&s.metrics.internalErrors, 1)
 	}
-	s.observeJudgeDurations(duration, compileDuration)
+	s.observeJudgeDurations(lang, verdict, duration, compileDuration)
 }
 
-func (s *JudgeService) observeJudgeDurations(duration time.Duration, compileDuration time.Duration) {
+func (s *JudgeService) observeJudgeDurations(lang JudgeLanguage, verdict domain.Verdict, duration time.Duration, compileDuration time.Duration) {
 	atomic.StoreInt64(&s.metrics.lastDurationNs, duration.Nanoseconds())
 	atomic.StoreInt64(&s.metrics.lastCompileNs, compileDuration.Nanoseconds())
 	atomic.StoreInt64(&s.metrics.lastResultAtNs, time.Now().UTC().UnixNano())
 	s.metrics.mu.Lock()
 	if compileDuration > 0 {
 		s.metrics.compileSamples = appendWindowedSample(s.metrics.compileSamples, float64(compileDuration)/float64(time.Millisecond), 120)
+		s.metrics.compileDurations.observe(string(lang), compileDuration.Seconds())
 	}
 	s.metrics.judgeSamples = appendWindowedSample(s.metrics.judgeSamples, float64(duration)/float64(time.Millisecond), 120)
+	s.metrics.runs[judgeRunKey{language: string(lang), verdict: string(verdict)}]++
+	// Failures on remote workers come without a duration.
+	if duration > 0 {
+		s.metrics.judgeDurations.observe(string(lang), duration.Seconds())
+	}
+	s.metrics.mu.Unlock()
+}
+
+// observeTestcase records the CPU and wall-clock time of one testcase run.
+func (s *JudgeService) observeTestcase(lang JudgeLanguage, cpu, wall time.Duration) {
+	s.metrics.mu.Lock()
+	s.metrics.testCPUSamples = appendWindowedSample(s.metrics.testCPUSamples, float64(cpu)/float64(time.Millisecond), 500)
+	s.metrics.testWallSamples = appendWindowedSample(s.metrics.testWallSamples, float64(wall)/float64(time.Millisecond), 500)
+	s.metrics.testcaseDurations.observe(string(lang), wall.Seconds())
 	s.metrics.mu.Unlock()
 }
 
@@ -380,53 +872,193 @@ func appendWindowedSample(samples []float64, value float64, limit int) []float64
 	return append([]float64(nil), samples[len(samples)-limit:]...)
 }
 
-func (s *JudgeService) runOnce(ctx context.Context, workDir string, lang JudgeLanguage, goBin string, stdin string, timeout time.Duration) (string, error) {
-	tctx, cancel := context.WithTimeout(ctx, timeout)
-	defer cancel()
+// EffectiveLimit is what a problem's limits come to in one language.
+type EffectiveLimit struct {
+	Language      JudgeLanguage `json:"language"`
+	TimeLimitMs   int           `json:"timeLimitMs"`
+	MemoryLimitMB int           `json:"memoryLimitMb"`
+}
 
-	var cmd *exec.Cmd
-	switch lang {
-	case JudgeLanguageGo:
-		if strings.TrimSpace(goBin) == "" {
-			return "", fmt.Errorf("internal error: go binary not built")
+// EffectiveLimits lists the problem's limits for every registered language,
+// with each language's time multiplier applied.
+func (s *JudgeService) EffectiveLimits(p *domain.Problem) []EffectiveLimit {
+	res := make([]EffectiveLimit, 0, len(s.languages.drivers))
+	for _, info := range s.languages.List() {
+		d, err := s.languages.Resolve(string(info.ID))
+		if err != nil {
+			continue
 		}
-		cmd = exec.CommandContext(tctx, goBin)
-	case JudgeLanguagePython:
-		py := "python"
-		if runtime.GOOS != "windows" {
-			// some linux environments require python3
-			py = "python3"
+		res = append(res, EffectiveLimit{
+			Language:      info.ID,
+			TimeLimitMs:   int(timeLimit(p, d).Milliseconds()),
+			MemoryLimitMB: memoryLimitMB(p),
+		})
+	}
+	return res
+}
+
+// timeLimit is the per-testcase time limit for submissions in driver's
+// language.
+func timeLimit(p *domain.Problem, driver LanguageDriver) time.Duration {
+	ms := p.TimeLimitMs
+	if ms <= 0 {
+		ms = defaultTimeLimitMs
+	}
+	return time.Duration(float64(ms)*driver.TimeMultiplier()) * time.Millisecond
+}
+
+func memoryLimitMB(p *domain.Problem) int {
+	if p.MemoryLimitMB <= 0 {
+		return defaultMemoryLimitMB
+	}
+	return p.MemoryLimitMB
+}
+
+// runLimits are the limits each testcase run of a submission gets. timeout
+// is the CPU time limit.
+type runLimits struct {
+	timeout       time.Duration
+	memoryLimitMB int
+	outputLimitKB int
+	seccomp       sandbox.SeccompProfile
+}
+
+// wallTimeout is the wall-clock guard around a run. It is looser than the CPU
+// limit so a busy host does not cost a submission its verdict, while a program
+// that sleeps or blocks on input is still stopped.
+func (l runLimits) wallTimeout() time.Duration {
+	return 2*l.timeout + time.Second
+}
+
+// runUsage is what a finished run consumed.
+type runUsage struct {
+	memoryKB int
+	cpuTime  time.Duration
+}
+
+func (l runLimits) sandbox() sandbox.Limits {
+	return sandbox.Limits{
+		CPUTime:        l.timeout,
+		MemoryBytes:    int64(l.memoryLimitMB) << 20,
+		MaxOutputBytes: int64(l.outputLimitKB) << 10,
+		Seccomp:        l.seccomp,
+	}
+}
+
+// runOnce executes one testcase and returns its stdout and usage. Memory is
+// enforced by the sandbox when isolated; unsandboxed dev runs can
+// only be judged against the limit after the fact. A runtime from the warm
+// pool is used when one is ready for these limits.
+func (s *JudgeService) runOnce(ctx context.Context, workDir string, driver LanguageDriver, stdin io.Reader, lim runLimits) (string, runUsage, error) {
+	if rt, ok := s.warmRuntimeFor(driver, lim); ok {
+		code, err := os.ReadFile(filepath.Join(workDir, driver.SourceFile()))
+		if err != nil {
+			rt.discard()
+			return "", runUsage{}, fmt.Errorf("internal error: %v", err)
 		}
-		cmd = exec.CommandContext(tctx, py, "main.py")
-	default:
-		return "", fmt.Errorf("unsupported language: %s", lang)
+		return s.runWarm(ctx, rt, code, stdin, lim)
 	}
 
-	cmd.Dir = workDir
-	stdinPipe, err := cmd.StdinPipe()
-	if err != nil {
-		return "", fmt.Errorf("failed to get stdin pipe: %w", err)
+	tctx, cancel := context.WithTimeout(ctx, lim.wallTimeout())
+	defer cancel()
+	cmd := submissionCommand(workDir, driver, lim.memoryLimitMB)
+	cmd.Stdin = stdin
+	var res *sandbox.Result
+	proc, err := s.startRun(tctx, cmd, "", lim.sandbox())
+	if err == nil {
+		res, err = proc.Wait()
 	}
-	go func() {
-		defer stdinPipe.Close()
-		_, _ = io.WriteString(stdinPipe, stdin)
-	}()
+	return runOutcome(tctx, res, err, lim)
+}
 
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+func submissionCommand(workDir string, driver LanguageDriver, memoryLimitMB int) *exec.Cmd {
+	cmd := driver.RunCommand(workDir, memoryLimitMB)
+	cmd.Dir = workDir
+	cmd.Env = sandbox.DefaultEnv(workDir)
+	return cmd
+}
+
+// startRun starts cmd in the sandbox, or directly when running unsandboxed in
+// dev mode.
+func (s *JudgeService) startRun(ctx context.Context, cmd *exec.Cmd, input string, limits sandbox.Limits) (*sandbox.Process, error) {
+	if s.isolated {
+		return sandbox.StartIsolated(ctx, cmd, input, limits)
+	}
+	return sandbox.Start(ctx, cmd, input, limits)
+}
 
-	if err := cmd.Run(); err != nil {
+// runOutcome classifies a finished submission run and returns its stdout and
+// usage. tctx is the run's wall-clock deadline context; the time limit itself
+// is checked against the CPU time the run reports.
+func runOutcome(tctx context.Context, res *sandbox.Result, err error, lim runLimits) (string, runUsage, error) {
+	memoryLimit := int64(lim.memoryLimitMB) << 20
+	if errors.Is(err, sandbox.ErrSetup) || errors.Is(err, sandbox.ErrUnsupported) {
+		return "", runUsage{}, fmt.Errorf("internal error: %v", err)
+	}
+	stdout := ""
+	stderr := ""
+	var usage runUsage
+	memoryExceeded := false
+	if res != nil {
+		usage = runUsage{memoryKB: int(res.MemoryPeakBytes >> 10), cpuTime: res.CPUTime}
+	}
+	if res != nil && res.OutputLimitExceeded {
+		return res.Stdout, usage, verdictError(domain.VerdictOutputLimitExceeded, "output limit exceeded")
+	}
+	if res != nil {
+		stdout = res.Stdout
+		stderr = res.Stderr
+		memoryExceeded = res.MemoryLimitExceeded || res.MemoryPeakBytes > memoryLimit
+	}
+	if memoryExceeded {
+		return stdout, usage, verdictError(domain.VerdictMemoryLimitExceeded, "memory limit exceeded")
+	}
+	// RLIMIT_CPU only kills at whole seconds, so a run can finish, or die of
+	// SIGXCPU, past the limit; either way the CPU time decides.
+	if usage.cpuTime > lim.timeout {
+		return stdout, usage, verdictError(domain.VerdictTimeLimitExceeded, "time limit exceeded")
+	}
+	if errors.Is(err, sandbox.ErrRestrictedSyscall) {
+		return stdout, usage, verdictError(domain.VerdictRuntimeError, "runtime error: %v", err)
+	}
+	if err != nil {
 		if tctx.Err() == context.DeadlineExceeded {
-			return stdout.String(), fmt.Errorf("time limit exceeded")
+			return stdout, usage, verdictError(domain.VerdictTimeLimitExceeded, "time limit exceeded (wall clock)")
 		}
-		errMsg := strings.TrimSpace(stderr.String())
+		errMsg := strings.TrimSpace(stderr)
 		if errMsg == "" {
 			errMsg = err.Error()
 		}
-		return stdout.String(), fmt.Errorf("runtime error: %s", errMsg)
+		return stdout, usage, verdictError(domain.VerdictRuntimeError, "runtime error: %s", errMsg)
 	}
 
-	return stdout.String(), nil
+	return stdout, usage, nil
+}
+
+// judgeError is a compile or run failure attributed to the submission. It
+// carries the verdict so callers never have to interpret the message.
+type judgeError struct {
+	verdict domain.Verdict
+	msg     string
+}
+
+func (e *judgeError) Error() string {
+	return e.msg
+}
+
+func verdictError(verdict domain.Verdict, format string, args ...interface{}) error {
+	return &judgeError{verdict: verdict, msg: fmt.Sprintf(format, args...)}
+}
+
+// verdictOf maps a run error to its verdict; errors that are not attributed
+// to the submission are internal errors.
+func verdictOf(err error) domain.Verdict {
+	if err == nil {
+		return domain.VerdictAccepted
+	}
+	var je *judgeError
+	if errors.As(err, &je) {
+		return je.verdict
+	}
+	return domain.VerdictInternalError
 }
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AQADIL/JudGO/internal/domain"
+	"github.com/AQADIL/JudGO/pkg/sandbox"
+)
+
+func TestRunOutcomeVerdict(t *testing.T) {
+	lim := runLimits{timeout: time.Second, memoryLimitMB: 64}
+	exited := errors.New("exit status 1")
+	tests := []struct {
+		name     string
+		res      *sandbox.Result
+		err      error
+		deadline bool
+		want     domain.Verdict
+	}{
+		{"clean exit", &sandbox.Result{Stdout: "3"}, nil, false, domain.VerdictAccepted},
+		{"non-zero exit", &sandbox.Result{ExitCode: 1, Stderr: "panic"}, exited, false, domain.VerdictRuntimeError},
+		{"restricted syscall", &sandbox.Result{}, fmt.Errorf("%w: socket", sandbox.ErrRestrictedSyscall), false, domain.VerdictRuntimeError},
+		{"cpu time over limit", &sandbox.Result{CPUTime: 1100 * time.Millisecond}, nil, false, domain.VerdictTimeLimitExceeded},
+		{"killed by SIGXCPU", &sandbox.Result{CPUTime: 2 * time.Second, ExitCode: -1}, exited, false, domain.VerdictTimeLimitExceeded},
+		{"wall clock", &sandbox.Result{CPUTime: 10 * time.Millisecond}, context.DeadlineExceeded, true, domain.VerdictTimeLimitExceeded},
+		{"oom killed", &sandbox.Result{MemoryLimitExceeded: true}, exited, false, domain.VerdictMemoryLimitExceeded},
+		{"peak over limit", &sandbox.Result{MemoryPeakBytes: 65 << 20}, nil, false, domain.VerdictMemoryLimitExceeded},
+		{"memory before time", &sandbox.Result{MemoryLimitExceeded: true, CPUTime: 2 * time.Second}, exited, false, domain.VerdictMemoryLimitExceeded},
+		{"output limit", &sandbox.Result{OutputLimitExceeded: true, MemoryLimitExceeded: true}, exited, false, domain.VerdictOutputLimitExceeded},
+		{"sandbox setup", nil, fmt.Errorf("%w: no cgroup", sandbox.ErrSetup), false, domain.VerdictInternalError},
+		{"unsupported host", nil, sandbox.ErrUnsupported, false, domain.VerdictInternalError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.deadline {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithDeadline(ctx, time.Now().Add(-time.Second))
+				defer cancel()
+			}
+			_, _, err := runOutcome(ctx, tt.res, tt.err, lim)
+			if got := verdictOf(err); got != tt.want {
+				t.Fatalf("verdict %s (%v), want %s", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutputMatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		expected string
+		want     bool
+	}{
+		{"equal", "1 2 3", "1 2 3", true},
+		{"trailing newline", "1 2 3", "1 2 3\n", true},
+		{"trailing whitespace on both", "42 \n", "42\n\n  \t", true},
+		{"crlf expected", "a\nb", "a\r\nb\r\n", true},
+		{"crlf output", "a\r\nb\r\n", "a\nb", true},
+		{"lone carriage return", "a\nb", "a\rb", false},
+		{"trailing carriage return", "a", "a\r", true},
+		{"unicode trailing space", "a", "a\u00a0\u2003", true},
+		{"expected shorter", "1 2 3", "1 2", false},
+		{"expected longer", "1 2", "1 2 3", false},
+		{"differs", "1 2 4", "1 2 3", false},
+		{"inner whitespace counts", "1  2", "1 2", false},
+		{"leading whitespace counts", " 1", "1", false},
+		{"both empty", "", "", true},
+		{"empty output", "", "\n\n", true},
+		{"empty output, expected text", "", "0", false},
+		{"long", strings.Repeat("x", 10000), strings.Repeat("x", 10000) + "\r\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := outputMatches(normalizeOutput(tt.output), strings.NewReader(tt.expected))
+			if err != nil {
+				t.Fatalf("outputMatches: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("outputMatches(%q, %q) = %v, want %v", tt.output, tt.expected, got, tt.want)
+			}
+			// It has to agree with comparing the normalized strings.
+			if whole := normalizeOutput(tt.output) == normalizeOutput(tt.expected); got != whole {
+				t.Fatalf("outputMatches = %v, normalized comparison = %v", got, whole)
+			}
+		})
+	}
+}
+
+func TestTimeLimitScaling(t *testing.T) {
+	tests := []struct {
+		name        string
+		driver      LanguageDriver
+		timeLimitMs int
+		want        time.Duration
+		wantWall    time.Duration
+	}{
+		{"go", &goDriver{}, 1000, time.Second, 3 * time.Second},
+		{"python", pythonDriver{}, 1000, 3 * time.Second, 7 * time.Second},
+		{"java", javaDriver{}, 1500, 3 * time.Second, 7 * time.Second},
+		{"node", nodeDriver{}, 1000, 1500 * time.Millisecond, 4 * time.Second},
+		{"cpp", cppDriver{}, 250, 250 * time.Millisecond, 1500 * time.Millisecond},
+		{"default", &goDriver{}, 0, defaultTimeLimitMs * time.Millisecond, (2*defaultTimeLimitMs + 1000) * time.Millisecond},
+		{"default, scaled", pythonDriver{}, 0, 3 * defaultTimeLimitMs * time.Millisecond, (6*defaultTimeLimitMs + 1000) * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := timeLimit(&domain.Problem{TimeLimitMs: tt.timeLimitMs}, tt.driver)
+			if got != tt.want {
+				t.Fatalf("time limit %v, want %v", got, tt.want)
+			}
+			if wall := (runLimits{timeout: got}).wallTimeout(); wall != tt.wantWall {
+				t.Fatalf("wall clock guard %v, want %v", wall, tt.wantWall)
+			}
+		})
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	tests := []struct {
+		limit int
+		want  int
+	}{
+		{0, defaultMemoryLimitMB},
+		{-1, defaultMemoryLimitMB},
+		{64, 64},
+		{1024, 1024},
+	}
+	for _, tt := range tests {
+		if got := memoryLimitMB(&domain.Problem{MemoryLimitMB: tt.limit}); got != tt.want {
+			t.Errorf("memoryLimitMB(%d) = %d, want %d", tt.limit, got, tt.want)
+		}
+	}
+}
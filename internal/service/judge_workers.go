@@ -0,0 +1,467 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/AQADIL/JudGO/internal/domain"
+)
+
+// Remote judge workers (cmd/judge-worker) take the compiling and running off
+// the API process. With JUDGE_REMOTE_WORKERS=1 the API stops judging locally;
+// the submissions it queues are instead leased to workers that register, pull
+// jobs, heartbeat and post results back over HTTP/JSON, authenticated with
+// the shared JUDGE_WORKER_TOKEN. A worker that stops heartbeating is dropped
+// and its jobs go back to the front of the queue, up to maxWorkerAttempts
+// times; so does a job a live worker stops reporting in its heartbeats, e.g.
+// because it could not post the result.
+
+const (
+	workerHeartbeatInterval = 5 * time.Second
+	// a worker is considered dead after this long without a heartbeat
+	workerTimeout = 20 * time.Second
+	// workerPollTimeout bounds how long a job request waits for work.
+	workerPollTimeout = 25 * time.Second
+	// a lease missing from a worker's heartbeats this long is taken back;
+	// it covers a job leased after the worker built its last heartbeat.
+	workerLeaseGrace  = 3 * workerHeartbeatInterval
+	maxWorkerAttempts = 3
+)
+
+// ErrUnknownWorker tells a worker to register again, e.g. after the API
+// restarted or declared it dead.
+var ErrUnknownWorker = errors.New("unknown judge worker")
+
+// WorkerRegistration is what a worker announces about itself on register.
+type WorkerRegistration struct {
+	Name      string          `json:"name"`
+	Languages []JudgeLanguage `json:"languages"`
+	// Capacity is how many jobs the worker runs at once.
+	Capacity int `json:"capacity"`
+}
+
+// WorkerSession is the API's answer to a registration.
+type WorkerSession struct {
+	WorkerID            string `json:"workerId"`
+	HeartbeatIntervalMs int    `json:"heartbeatIntervalMs"`
+	PollTimeoutMs       int    `json:"pollTimeoutMs"`
+}
+
+// WorkerHeartbeat reports the state of the jobs a worker is running.
+type WorkerHeartbeat struct {
+	Jobs map[string]JudgeJobState `json:"jobs,omitempty"`
+}
+
+// WorkerJob is a submission leased to a worker. It carries the problem,
+// hidden testcases included, because workers have no database access.
+type WorkerJob struct {
+	JobID     string          `json:"jobId"`
+	ProblemID string          `json:"problemId"`
+	Language  JudgeLanguage   `json:"language"`
+	Code      string          `json:"code"`
+	Options   JudgeOptions    `json:"options"`
+	Problem   *domain.Problem `json:"problem"`
+	Attempt   int             `json:"attempt"`
+}
+
+// WorkerResult is the outcome of a WorkerJob. Error means the submission
+// could not be judged at all, as with Judge.
+type WorkerResult struct {
+	Result *JudgeResult `json:"result,omitempty"`
+	Error  string       `json:"error,omitempty"`
+}
+
+// WorkerInfo describes a registered worker for the ops views.
+type WorkerInfo struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Languages []JudgeLanguage `json:"languages"`
+	Capacity  int             `json:"capacity"`
+	Running   int             `json:"running"`
+	LastSeen  time.Time       `json:"lastSeen"`
+}
+
+type remoteWorker struct {
+	info      WorkerInfo
+	languages map[JudgeLanguage]bool
+}
+
+// workerPool tracks the registered workers and the jobs leased to them.
+type workerPool struct {
+	token string
+
+	mu      sync.Mutex
+	workers map[string]*remoteWorker
+	// leases maps a job ID to its task and the worker holding it.
+	leases map[string]workerLease
+	// retry holds tasks taken back from dead workers, or pulled by a worker
+	// that cannot run their language; they go before the queue.
+	retry []*judgeTask
+	// wake is closed and replaced whenever retry grows, waking every
+	// polling worker.
+	wake chan struct{}
+}
+
+type workerLease struct {
+	task     *judgeTask
+	workerID string
+	// reported is when the lease was made or last reported by the worker.
+	reported time.Time
+}
+
+// newWorkerPool returns the pool when JUDGE_REMOTE_WORKERS is on, nil
+// otherwise.
+func newWorkerPool() *workerPool {
+	raw := strings.TrimSpace(os.Getenv("JUDGE_REMOTE_WORKERS"))
+	if raw != "1" && !strings.EqualFold(raw, "true") {
+		return nil
+	}
+	token := strings.TrimSpace(os.Getenv("JUDGE_WORKER_TOKEN"))
+	if token == "" {
+		log.Fatal("[JUDGE] JUDGE_REMOTE_WORKERS needs JUDGE_WORKER_TOKEN")
+	}
+	return &workerPool{
+		token:   token,
+		workers: map[string]*remoteWorker{},
+		leases:  map[string]workerLease{},
+		wake:    make(chan struct{}),
+	}
+}
+
+// AuthorizeWorker checks a worker's bearer token. It is always false when
+// remote workers are off.
+func (s *JudgeService) AuthorizeWorker(token string) bool {
+	if s.workers == nil || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.workers.token)) == 1
+}
+
+// RemoteWorkers reports whether submissions are judged by remote workers.
+func (s *JudgeService) RemoteWorkers() bool {
+	return s.workers != nil
+}
+
+// Workers lists the live remote workers.
+func (s *JudgeService) Workers() []WorkerInfo {
+	if s.workers == nil {
+		return nil
+	}
+	p := s.workers
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	res := make([]WorkerInfo, 0, len(p.workers))
+	for _, w := range p.workers {
+		info := w.info
+		info.Running = 0
+		for _, l := range p.leases {
+			if l.workerID == w.info.ID {
+				info.Running++
+			}
+		}
+		res = append(res, info)
+	}
+	return res
+}
+
+// RegisterWorker adds a worker to the pool.
+func (s *JudgeService) RegisterWorker(reg WorkerRegistration) (*WorkerSession, error) {
+	if s.workers == nil {
+		return nil, fmt.Errorf("remote judge workers are disabled")
+	}
+	w := &remoteWorker{
+		info: WorkerInfo{
+			ID:       uuid.NewString(),
+			Name:     strings.TrimSpace(reg.Name),
+			Capacity: reg.Capacity,
+			LastSeen: time.Now().UTC(),
+		},
+		languages: map[JudgeLanguage]bool{},
+	}
+	for _, lang := range reg.Languages {
+		d, err := s.languages.Resolve(string(lang))
+		if err != nil {
+			continue
+		}
+		if !w.languages[d.Language()] {
+			w.languages[d.Language()] = true
+			w.info.Languages = append(w.info.Languages, d.Language())
+		}
+	}
+	if len(w.languages) == 0 {
+		return nil, fmt.Errorf("worker supports no known language")
+	}
+
+	s.workers.mu.Lock()
+	s.workers.workers[w.info.ID] = w
+	s.workers.mu.Unlock()
+	log.Printf("[JUDGE] worker %s (%s) registered: %v", w.info.ID, w.info.Name, w.info.Languages)
+	return &WorkerSession{
+		WorkerID:            w.info.ID,
+		HeartbeatIntervalMs: int(workerHeartbeatInterval.Milliseconds()),
+		PollTimeoutMs:       int(workerPollTimeout.Milliseconds()),
+	}, nil
+}
+
+// WorkerHeartbeat keeps a worker alive and updates the state of its jobs.
+func (s *JudgeService) WorkerHeartbeat(workerID string, hb WorkerHeartbeat) error {
+	if s.workers == nil {
+		return ErrUnknownWorker
+	}
+	p := s.workers
+	p.mu.Lock()
+	w, ok := p.workers[workerID]
+	if !ok {
+		p.mu.Unlock()
+		return ErrUnknownWorker
+	}
+	now := time.Now().UTC()
+	w.info.LastSeen = now
+	var updates []workerLease
+	var failed []*judgeTask
+	states := map[string]JudgeJobState{}
+	for jobID, l := range p.leases {
+		if l.workerID != workerID {
+			continue
+		}
+		state, ok := hb.Jobs[jobID]
+		if !ok {
+			if now.Sub(l.reported) > workerLeaseGrace {
+				log.Printf("[JUDGE] worker %s (%s) no longer reports submission %s", workerID, w.info.Name, jobID)
+				if t := s.releaseLeaseLocked(jobID, l); t != nil {
+					failed = append(failed, t)
+				}
+			}
+			continue
+		}
+		l.reported = now
+		p.leases[jobID] = l
+		if state == JudgeJobStateCompiling || state == JudgeJobStateRunning {
+			updates = append(updates, l)
+			states[jobID] = state
+		}
+	}
+	p.mu.Unlock()
+
+	for _, l := range updates {
+		s.setJobState(l.task.job, states[l.task.job.ID])
+	}
+	s.failLostJobs(failed)
+	return nil
+}
+
+// NextWorkerJob leases the next job the worker can run, waiting until one is
+// queued, the poll timeout passes (nil, nil) or ctx is done.
+func (s *JudgeService) NextWorkerJob(ctx context.Context, workerID string) (*WorkerJob, error) {
+	if s.workers == nil {
+		return nil, ErrUnknownWorker
+	}
+	p := s.workers
+	timer := time.NewTimer(workerPollTimeout)
+	defer timer.Stop()
+	for {
+		p.mu.Lock()
+		w, ok := p.workers[workerID]
+		if !ok {
+			p.mu.Unlock()
+			return nil, ErrUnknownWorker
+		}
+		w.info.LastSeen = time.Now().UTC()
+		for i, t := range p.retry {
+			if w.languages[t.req.driver.Language()] {
+				p.retry = append(p.retry[:i], p.retry[i+1:]...)
+				job := p.leaseLocked(t, workerID)
+				p.mu.Unlock()
+				s.startJob(t)
+				return job, nil
+			}
+		}
+		wake := p.wake
+		p.mu.Unlock()
+
+		var t *judgeTask
+		select {
+		case t = <-s.queue.tasks:
+		default:
+			select {
+			case t = <-s.queue.tasks:
+			case t = <-s.queue.background:
+			case <-wake:
+				continue
+			case <-timer.C:
+				return nil, nil
+			case <-ctx.Done():
+				return nil, nil
+			}
+		}
+		p.mu.Lock()
+		if _, ok := p.workers[workerID]; !ok || !w.languages[t.req.driver.Language()] {
+			p.requeueLocked(t)
+			p.mu.Unlock()
+			if !ok {
+				return nil, ErrUnknownWorker
+			}
+			continue
+		}
+		job := p.leaseLocked(t, workerID)
+		p.mu.Unlock()
+		s.startJob(t)
+		return job, nil
+	}
+}
+
+func (p *workerPool) leaseLocked(t *judgeTask, workerID string) *WorkerJob {
+	t.attempts++
+	p.leases[t.job.ID] = workerLease{task: t, workerID: workerID, reported: time.Now().UTC()}
+	return &WorkerJob{
+		JobID:     t.job.ID,
+		ProblemID: t.req.problemID,
+		Language:  t.req.driver.Language(),
+		Code:      t.req.code,
+		Options:   t.req.opts,
+		Problem:   t.req.problem,
+		Attempt:   t.attempts,
+	}
+}
+
+func (p *workerPool) requeueLocked(t *judgeTask) {
+	p.retry = append(p.retry, t)
+	close(p.wake)
+	p.wake = make(chan struct{})
+}
+
+// CompleteWorkerJob records the outcome a worker reports for a leased job.
+// Results for jobs the worker no longer holds, because it was declared dead
+// and the job went to another worker, are dropped.
+func (s *JudgeService) CompleteWorkerJob(workerID, jobID string, wr WorkerResult) error {
+	if s.workers == nil {
+		return ErrUnknownWorker
+	}
+	p := s.workers
+	p.mu.Lock()
+	if w, ok := p.workers[workerID]; ok {
+		w.info.LastSeen = time.Now().UTC()
+	}
+	l, ok := p.leases[jobID]
+	if !ok || l.workerID != workerID {
+		p.mu.Unlock()
+		return fmt.Errorf("job %s is not leased to this worker", jobID)
+	}
+	delete(p.leases, jobID)
+	p.mu.Unlock()
+
+	var err error
+	if wr.Error != "" {
+		err = errors.New(wr.Error)
+	} else if wr.Result == nil {
+		err = fmt.Errorf("internal error: judge worker returned no result")
+	}
+	if err != nil {
+		s.observeJudgeFailure(l.task.job.Language, 0, 0)
+	} else {
+		var took time.Duration
+		if started := l.task.job.StartedAt; started != nil {
+			took = time.Since(*started)
+		}
+		s.observeJudgeCompletion(l.task.job.Language, wr.Result.Verdict, took, 0)
+	}
+	s.finishJob(l.task, wr.Result, err)
+	return nil
+}
+
+// reapWorkers drops workers that stopped heartbeating and takes their jobs
+// back.
+func (s *JudgeService) reapWorkers() {
+	ticker := time.NewTicker(workerHeartbeatInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.reapWorkersOnce(time.Now().UTC())
+	}
+}
+
+func (s *JudgeService) reapWorkersOnce(now time.Time) {
+	p := s.workers
+	var failed []*judgeTask
+	p.mu.Lock()
+	for id, w := range p.workers {
+		if now.Sub(w.info.LastSeen) <= workerTimeout {
+			continue
+		}
+		delete(p.workers, id)
+		log.Printf("[JUDGE] worker %s (%s) timed out", id, w.info.Name)
+		for jobID, l := range p.leases {
+			if l.workerID != id {
+				continue
+			}
+			if t := s.releaseLeaseLocked(jobID, l); t != nil {
+				failed = append(failed, t)
+			}
+		}
+	}
+	p.mu.Unlock()
+	s.failLostJobs(failed)
+}
+
+// releaseLeaseLocked takes a job back from its worker and queues it again.
+// It returns the task instead when it has used up its attempts; the caller
+// fails it with failLostJobs once the pool is unlocked.
+func (s *JudgeService) releaseLeaseLocked(jobID string, l workerLease) *judgeTask {
+	p := s.workers
+	delete(p.leases, jobID)
+	if l.task.attempts >= maxWorkerAttempts {
+		return l.task
+	}
+	log.Printf("[JUDGE] retrying submission %s (attempt %d failed)", jobID, l.task.attempts)
+	p.requeueLocked(l.task)
+	s.queue.mu.Lock()
+	l.task.job.State = JudgeJobStateQueued
+	s.queue.mu.Unlock()
+	return nil
+}
+
+func (s *JudgeService) failLostJobs(tasks []*judgeTask) {
+	for _, t := range tasks {
+		s.observeJudgeFailure(t.job.Language, 0, 0)
+		s.finishJob(t, nil, fmt.Errorf("internal error: judge worker lost %d times", t.attempts))
+	}
+}
+
+// accepts rejects a submission no live worker could run.
+func (p *workerPool) accepts(lang JudgeLanguage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.workers) == 0 {
+		return fmt.Errorf("no judge workers available, try again later")
+	}
+	for _, w := range p.workers {
+		if w.languages[lang] {
+			return nil
+		}
+	}
+	return fmt.Errorf("no judge worker supports %s", lang)
+}
+
+// RunWorkerJob judges a job leased from the API. It is the worker side of
+// the protocol and runs on the worker's own JudgeService.
+func (s *JudgeService) RunWorkerJob(ctx context.Context, job *WorkerJob, progress func(JudgeJobState)) (*JudgeResult, error) {
+	if !s.enabled() {
+		return nil, fmt.Errorf("judge is disabled: sandbox isolation is unavailable (set JUDGE_DEV=1 to run unsandboxed)")
+	}
+	if job.Problem == nil {
+		return nil, fmt.Errorf("job has no problem")
+	}
+	req, err := s.prepareProblem(job.Problem, job.ProblemID, job.Language, job.Code, job.Options)
+	if err != nil {
+		return nil, err
+	}
+	return s.run(ctx, req, progress)
+}
@@ -0,0 +1,447 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AQADIL/JudGO/internal/domain"
+	"github.com/AQADIL/JudGO/pkg/sandbox"
+)
+
+// LanguageDriver describes how the judge builds and runs submissions in one
+// language. Compilers that take arbitrary code to native binaries run in the
+// sandbox like RunCommand does; the rest build on the host.
+type LanguageDriver interface {
+	Language() JudgeLanguage
+	DisplayName() string
+	// SourceFile is the file name the submission is written to in the work dir.
+	SourceFile() string
+	// Compile builds the submission in workDir. Interpreted languages return
+	// nil; compiler diagnostics are returned as a compile error verdict.
+	Compile(ctx context.Context, workDir string) error
+	// RunCommand returns the command that executes the built submission.
+	RunCommand(workDir string, memoryLimitMB int) *exec.Cmd
+	// VersionCommand prints the toolchain version, which is part of the
+	// compile cache key. Interpreted languages return nil and are not cached.
+	VersionCommand() []string
+	// TimeMultiplier scales the problem time limit for slower runtimes.
+	TimeMultiplier() float64
+	// SeccompProfile is the syscall allowlist RunCommand runs under when
+	// isolated; SeccompNone leaves it unfiltered.
+	SeccompProfile() sandbox.SeccompProfile
+}
+
+// LanguageInfo is the public description of a registered driver.
+type LanguageInfo struct {
+	ID             JudgeLanguage `json:"id"`
+	Name           string        `json:"name"`
+	SourceFile     string        `json:"sourceFile"`
+	TimeMultiplier float64       `json:"timeMultiplier"`
+	// Seccomp is the syscall filter profile isolated runs get.
+	Seccomp sandbox.SeccompProfile `json:"seccomp"`
+}
+
+// LanguageRegistry holds the drivers available on this host.
+type LanguageRegistry struct {
+	drivers map[JudgeLanguage]LanguageDriver
+}
+
+var languageAliases = map[string]JudgeLanguage{
+	"golang":     JudgeLanguageGo,
+	"python":     JudgeLanguagePython,
+	"python3":    JudgeLanguagePython,
+	"c++":        JudgeLanguageCPP,
+	"cxx":        JudgeLanguageCPP,
+	"rs":         JudgeLanguageRust,
+	"javascript": JudgeLanguageJavaScript,
+	"node":       JudgeLanguageJavaScript,
+}
+
+// NewLanguageRegistry registers Go and Python unconditionally, as before,
+// and every other driver whose toolchain is on PATH.
+func NewLanguageRegistry(goCacheDir string) *LanguageRegistry {
+	r := &LanguageRegistry{drivers: map[JudgeLanguage]LanguageDriver{}}
+	r.Register(&goDriver{cacheDir: goCacheDir})
+	r.Register(pythonDriver{})
+
+	optional := []struct {
+		driver    LanguageDriver
+		toolchain []string
+	}{
+		{cppDriver{}, []string{"g++"}},
+		{javaDriver{}, []string{"javac", "java"}},
+		{rustDriver{}, []string{"rustc"}},
+		{nodeDriver{}, []string{"node"}},
+	}
+	for _, o := range optional {
+		missing := ""
+		for _, bin := range o.toolchain {
+			if _, err := exec.LookPath(bin); err != nil {
+				missing = bin
+				break
+			}
+		}
+		if missing != "" {
+			log.Printf("[JUDGE] %s disabled: %s not found", o.driver.DisplayName(), missing)
+			continue
+		}
+		r.Register(o.driver)
+	}
+	return r
+}
+
+// NewFullLanguageRegistry registers every driver without looking for its
+// toolchain, for an API that leaves building and running to remote workers.
+func NewFullLanguageRegistry(goCacheDir string) *LanguageRegistry {
+	r := &LanguageRegistry{drivers: map[JudgeLanguage]LanguageDriver{}}
+	for _, d := range []LanguageDriver{&goDriver{cacheDir: goCacheDir}, pythonDriver{}, cppDriver{}, javaDriver{}, rustDriver{}, nodeDriver{}} {
+		r.Register(d)
+	}
+	return r
+}
+
+func (r *LanguageRegistry) Register(d LanguageDriver) {
+	r.drivers[d.Language()] = d
+}
+
+// Resolve normalizes a language name (case-insensitive, common aliases) and
+// returns its driver.
+func (r *LanguageRegistry) Resolve(name string) (LanguageDriver, error) {
+	id := JudgeLanguage(strings.ToLower(strings.TrimSpace(name)))
+	if alias, ok := languageAliases[string(id)]; ok {
+		id = alias
+	}
+	d, ok := r.drivers[id]
+	if !ok {
+		return nil, fmt.Errorf("unsupported language: %s", name)
+	}
+	return d, nil
+}
+
+func (r *LanguageRegistry) List() []LanguageInfo {
+	res := make([]LanguageInfo, 0, len(r.drivers))
+	for _, d := range r.drivers {
+		res = append(res, LanguageInfo{
+			ID:             d.Language(),
+			Name:           d.DisplayName(),
+			SourceFile:     d.SourceFile(),
+			TimeMultiplier: d.TimeMultiplier(),
+			Seccomp:        d.SeccompProfile(),
+		})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res
+}
+
+// RoomLanguage is the upper-case form rooms and matches store.
+func RoomLanguage(lang JudgeLanguage) domain.RoomLanguage {
+	return domain.RoomLanguage(strings.ToUpper(string(lang)))
+}
+
+// runCompiler runs a compiler command and turns a failure into a compile
+// error verdict carrying the compiler output.
+func runCompiler(ctx context.Context, cmd *exec.Cmd) error {
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return verdictError(domain.VerdictCompileError, "compile time limit exceeded")
+	}
+	errMsg := strings.TrimSpace(string(out))
+	if errMsg == "" {
+		errMsg = err.Error()
+	}
+	return verdictError(domain.VerdictCompileError, "compile error: %s", errMsg)
+}
+
+// compileLimits bound a sandboxed compiler run for as long as ctx allows:
+// g++ and rustc at -O2 stay well under a GiB, and diagnostics past a
+// megabyte are not worth keeping.
+func compileLimits(ctx context.Context) sandbox.Limits {
+	lim := sandbox.Limits{
+		MemoryBytes:    1 << 30,
+		MaxFileBytes:   256 << 20,
+		MaxOutputBytes: 1 << 20,
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		lim.CPUTime = time.Until(deadline)
+	}
+	return lim
+}
+
+// runSandboxedCompiler is runCompiler for compilers of native code, which
+// run isolated with only their work dir, the system paths and readOnly
+// visible. Hosts without isolation only judge under JUDGE_DEV and compile
+// on the host.
+func runSandboxedCompiler(ctx context.Context, cmd *exec.Cmd, readOnly ...string) error {
+	if !sandbox.Supported() {
+		return runCompiler(ctx, cmd)
+	}
+	if err := sandbox.PrepareWorkDir(cmd.Dir); err != nil {
+		return fmt.Errorf("failed to prepare compile dir: %w", err)
+	}
+	cmd.Env = sandbox.DefaultEnv(cmd.Dir)
+	lim := compileLimits(ctx)
+	lim.ReadOnlyPaths = readOnly
+	res, err := sandbox.RunIsolated(ctx, cmd, "", lim)
+	if err == nil {
+		return nil
+	}
+	if res == nil || errors.Is(err, sandbox.ErrSetup) {
+		return fmt.Errorf("internal error: compiler failed: %v", err)
+	}
+	if ctx.Err() == context.DeadlineExceeded || res.CPUTime >= lim.CPUTime {
+		return verdictError(domain.VerdictCompileError, "compile time limit exceeded")
+	}
+	if res.MemoryLimitExceeded {
+		return verdictError(domain.VerdictCompileError, "compile memory limit exceeded")
+	}
+	errMsg := strings.TrimSpace(res.Stdout + res.Stderr)
+	if errMsg == "" {
+		errMsg = err.Error()
+	}
+	return verdictError(domain.VerdictCompileError, "compile error: %s", errMsg)
+}
+
+func binaryName() string {
+	if runtime.GOOS == "windows" {
+		return "main_bin.exe"
+	}
+	return "main_bin"
+}
+
+type goDriver struct {
+	cacheDir string
+}
+
+func (d *goDriver) Language() JudgeLanguage                { return JudgeLanguageGo }
+func (d *goDriver) DisplayName() string                    { return "Go" }
+func (d *goDriver) SourceFile() string                     { return "main.go" }
+func (d *goDriver) TimeMultiplier() float64                { return 1 }
+func (d *goDriver) SeccompProfile() sandbox.SeccompProfile { return sandbox.SeccompGo }
+
+func (d *goDriver) buildEnv() []string {
+	env := os.Environ()
+	env = append(env, "GOCACHE="+d.cacheDir)
+	env = append(env, "GOFLAGS=-trimpath")
+	// cgo would let a submission run the C toolchain with its own flags.
+	env = append(env, "CGO_ENABLED=0")
+	return env
+}
+
+func (d *goDriver) Compile(ctx context.Context, workDir string) error {
+	// write go.mod so the toolchain skips module discovery
+	_ = os.WriteFile(filepath.Join(workDir, "go.mod"), []byte("module submission\ngo 1.21\n"), 0644)
+
+	cmd := exec.CommandContext(ctx, "go", "build", "-o", binaryName(), "main.go")
+	cmd.Dir = workDir
+	cmd.Env = d.buildEnv()
+	return runCompiler(ctx, cmd)
+}
+
+func (d *goDriver) RunCommand(workDir string, memoryLimitMB int) *exec.Cmd {
+	return exec.Command(filepath.Join(workDir, binaryName()))
+}
+
+func (d *goDriver) VersionCommand() []string { return []string{"go", "version"} }
+
+// warm builds a trivial program so the first submission does not pay for
+// compiling the standard library into the cache.
+func (d *goDriver) warm() {
+	dir, err := os.MkdirTemp("", "judgo-warmup-*")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	_ = os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\nimport \"fmt\"\nfunc main(){fmt.Println(0)}\n"), 0644)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+	_ = d.Compile(ctx, dir)
+}
+
+type pythonDriver struct{}
+
+func (pythonDriver) Language() JudgeLanguage                { return JudgeLanguagePython }
+func (pythonDriver) DisplayName() string                    { return "Python 3" }
+func (pythonDriver) SourceFile() string                     { return "main.py" }
+func (pythonDriver) TimeMultiplier() float64                { return 3 }
+func (pythonDriver) SeccompProfile() sandbox.SeccompProfile { return sandbox.SeccompPython }
+func (pythonDriver) Compile(context.Context, string) error  { return nil }
+func (pythonDriver) VersionCommand() []string               { return nil }
+
+func (pythonDriver) RunCommand(workDir string, memoryLimitMB int) *exec.Cmd {
+	py := "python"
+	if runtime.GOOS != "windows" {
+		// some linux environments require python3
+		py = "python3"
+	}
+	return exec.Command(py, "main.py")
+}
+
+// pythonWarmBootstrap is what a warm Python runtime runs: it reports ready,
+// reads the program as warmDriver describes, writes it to main.py in its work
+// dir, reports the CPU time start-up took and runs the program as __main__,
+// the way `python3 main.py` would. It reads straight from fd 0 so sys.stdin
+// is left untouched for the program.
+const pythonWarmBootstrap = `
+import os, sys, types, resource, traceback
+
+def _read(n):
+    buf = b""
+    while len(buf) < n:
+        chunk = os.read(0, n - len(buf))
+        if not chunk:
+            os._exit(0)
+        buf += chunk
+    return buf
+
+os.write(1, b"ready\n")
+_size = b""
+while not _size.endswith(b"\n"):
+    _size += _read(1)
+_source = _read(int(_size))
+_path = os.path.abspath("main.py")
+with open(_path, "wb") as f:
+    f.write(_source)
+_usage = resource.getrusage(resource.RUSAGE_SELF)
+os.write(1, b"%d\n" % round((_usage.ru_utime + _usage.ru_stime) * 1e6))
+
+_main = types.ModuleType("__main__")
+_main.__file__ = _path
+sys.modules["__main__"] = _main
+sys.argv = ["main.py"]
+try:
+    exec(compile(_source, _path, "exec"), _main.__dict__)
+except SystemExit:
+    raise
+except BaseException as e:
+    # Leave this bootstrap out of the traceback.
+    traceback.print_exception(type(e), e, e.__traceback__.tb_next)
+    sys.exit(1)
+`
+
+func (pythonDriver) WarmCommand() *exec.Cmd {
+	return exec.Command("python3", "-c", pythonWarmBootstrap)
+}
+
+type cppDriver struct{}
+
+func (cppDriver) Language() JudgeLanguage                { return JudgeLanguageCPP }
+func (cppDriver) DisplayName() string                    { return "C++17" }
+func (cppDriver) SourceFile() string                     { return "main.cpp" }
+func (cppDriver) TimeMultiplier() float64                { return 1 }
+func (cppDriver) SeccompProfile() sandbox.SeccompProfile { return sandbox.SeccompNative }
+
+func (cppDriver) Compile(ctx context.Context, workDir string) error {
+	cmd := exec.Command("g++", "-std=c++17", "-O2", "-pipe", "-o", binaryName(), "main.cpp")
+	cmd.Dir = workDir
+	return runSandboxedCompiler(ctx, cmd)
+}
+
+func (cppDriver) RunCommand(workDir string, memoryLimitMB int) *exec.Cmd {
+	return exec.Command(filepath.Join(workDir, binaryName()))
+}
+
+func (cppDriver) VersionCommand() []string { return []string{"g++", "--version"} }
+
+type javaDriver struct{}
+
+func (javaDriver) Language() JudgeLanguage { return JudgeLanguageJava }
+func (javaDriver) DisplayName() string     { return "Java" }
+func (javaDriver) SourceFile() string      { return "Main.java" }
+func (javaDriver) TimeMultiplier() float64 { return 2 }
+
+// The JVM uses a wide, version-dependent set of syscalls, so its profile
+// is a deny-list.
+func (javaDriver) SeccompProfile() sandbox.SeccompProfile { return sandbox.SeccompJVM }
+
+func (javaDriver) Compile(ctx context.Context, workDir string) error {
+	cmd := exec.CommandContext(ctx, "javac", "-encoding", "UTF-8", "-d", ".", "Main.java")
+	cmd.Dir = workDir
+	return runCompiler(ctx, cmd)
+}
+
+// javaNonHeapReserveMB is what the JVM keeps resident besides the heap:
+// metaspace, the code cache (capped below), thread stacks and its own
+// native memory.
+const javaNonHeapReserveMB = 64
+
+func (javaDriver) RunCommand(workDir string, memoryLimitMB int) *exec.Cmd {
+	// The JVM sizes its heap from host RAM unless told otherwise. The memory
+	// limit is checked against the whole process, so the heap gets what the
+	// rest of the JVM leaves of it; a solution that outgrows that gets an
+	// OutOfMemoryError rather than an MLE.
+	heapMB := memoryLimitMB - javaNonHeapReserveMB
+	if heapMB < memoryLimitMB/2 {
+		heapMB = memoryLimitMB / 2
+	}
+	return exec.Command("java", fmt.Sprintf("-Xmx%dm", heapMB), "-Xss64m", "-XX:ReservedCodeCacheSize=32m", "-XX:+UseSerialGC", "-cp", ".", "Main")
+}
+
+func (javaDriver) VersionCommand() []string { return []string{"javac", "-version"} }
+
+type rustDriver struct{}
+
+func (rustDriver) Language() JudgeLanguage                { return JudgeLanguageRust }
+func (rustDriver) DisplayName() string                    { return "Rust" }
+func (rustDriver) SourceFile() string                     { return "main.rs" }
+func (rustDriver) TimeMultiplier() float64                { return 1 }
+func (rustDriver) SeccompProfile() sandbox.SeccompProfile { return sandbox.SeccompNative }
+
+func (rustDriver) Compile(ctx context.Context, workDir string) error {
+	// rustup's rustc is a proxy that looks for its toolchain under the home
+	// dir; the sandbox gets the toolchain's own rustc and nothing else of it.
+	rustc, sysroot := "rustc", rustSysroot()
+	var readOnly []string
+	if sysroot != "" {
+		rustc = filepath.Join(sysroot, "bin", "rustc")
+		readOnly = append(readOnly, sysroot)
+	}
+	cmd := exec.Command(rustc, "--edition", "2021", "-O", "-o", binaryName(), "main.rs")
+	cmd.Dir = workDir
+	return runSandboxedCompiler(ctx, cmd, readOnly...)
+}
+
+// rustSysroot is the directory of the default Rust toolchain, or "" when
+// rustc cannot tell.
+var rustSysroot = sync.OnceValue(func() string {
+	out, err := exec.Command("rustc", "--print", "sysroot").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+})
+
+func (rustDriver) RunCommand(workDir string, memoryLimitMB int) *exec.Cmd {
+	return exec.Command(filepath.Join(workDir, binaryName()))
+}
+
+func (rustDriver) VersionCommand() []string { return []string{"rustc", "--version"} }
+
+type nodeDriver struct{}
+
+func (nodeDriver) Language() JudgeLanguage { return JudgeLanguageJavaScript }
+func (nodeDriver) DisplayName() string     { return "JavaScript (Node.js)" }
+func (nodeDriver) SourceFile() string      { return "main.js" }
+func (nodeDriver) TimeMultiplier() float64 { return 1.5 }
+
+func (nodeDriver) SeccompProfile() sandbox.SeccompProfile { return sandbox.SeccompNode }
+func (nodeDriver) Compile(context.Context, string) error  { return nil }
+func (nodeDriver) VersionCommand() []string               { return nil }
+
+func (nodeDriver) RunCommand(workDir string, memoryLimitMB int) *exec.Cmd {
+	return exec.Command("node", fmt.Sprintf("--max-old-space-size=%d", memoryLimitMB), "main.js")
+}
@@ -32,7 +32,7 @@ func NewMatchService(repo MatchRepository) *MatchService {
     }
 }                       
 
-func (s *MatchService) CreateMatch(ctx context.Context, matchType, player1 string) (*domain.Match, error) {
+func (s *MatchService) CreateMatch(ctx context.Context, matchType, player1, language string) (*domain.Match, error) {
     now := time.Now().UTC()
     m := &domain.Match{
         ID:     uuid.NewString(),
@@ -42,6 +42,7 @@ func (s *MatchService) CreateMatch(ctx context.Context, matchType, player1 strin
             Name:  player1,
             Score: 0,
         },
+        Language:  language,
         CreatedAt: now,
         UpdatedAt: now,
     }
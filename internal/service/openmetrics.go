@@ -0,0 +1,284 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// OpenMetricsContentType is what the exposition written by WriteOpenMetrics
+// is served as.
+const OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// Histogram buckets, in seconds.
+var (
+	judgeDurationBuckets    = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+	compileDurationBuckets  = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+	testcaseDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	httpDurationBuckets     = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+)
+
+type histogram struct {
+	// counts holds one count per bucket bound plus one for +Inf; they are
+	// made cumulative only when written.
+	counts []uint64
+	sum    float64
+}
+
+// histogramVec is a set of histograms over the same buckets, one per label
+// value. Unlike the sample windows of the JSON snapshot it counts everything
+// since start, as scrapers expect. Its owner guards it.
+type histogramVec struct {
+	bounds  []float64
+	byLabel map[string]*histogram
+}
+
+func newHistogramVec(bounds []float64) histogramVec {
+	return histogramVec{bounds: bounds, byLabel: map[string]*histogram{}}
+}
+
+func (v *histogramVec) observe(label string, value float64) {
+	h := v.byLabel[label]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(v.bounds)+1)}
+		v.byLabel[label] = h
+	}
+	h.counts[sort.SearchFloat64s(v.bounds, value)]++
+	h.sum += value
+}
+
+func (v *histogramVec) clone() histogramVec {
+	c := newHistogramVec(v.bounds)
+	for label, h := range v.byLabel {
+		c.byLabel[label] = &histogram{counts: append([]uint64(nil), h.counts...), sum: h.sum}
+	}
+	return c
+}
+
+// judgeRunKey labels the judge run counter.
+type judgeRunKey struct {
+	language string
+	verdict  string
+}
+
+// httpRequestKey labels the HTTP request counter. route is the pattern the
+// request matched rather than its path, which keeps IDs out of the labels.
+type httpRequestKey struct {
+	route  string
+	status int
+}
+
+// metricsWriter writes the OpenMetrics text format.
+type metricsWriter struct {
+	w *bufio.Writer
+}
+
+func (m *metricsWriter) family(name, kind, help string) {
+	fmt.Fprintf(m.w, "# TYPE %s %s\n# HELP %s %s\n", name, kind, name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help))
+}
+
+// sample writes one sample; labels are name and value pairs.
+func (m *metricsWriter) sample(name string, value float64, labels ...string) {
+	m.w.WriteString(name)
+	if len(labels) > 0 {
+		m.w.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				m.w.WriteByte(',')
+			}
+			m.w.WriteString(labels[i])
+			m.w.WriteString(`="`)
+			m.w.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[i+1]))
+			m.w.WriteByte('"')
+		}
+		m.w.WriteByte('}')
+	}
+	m.w.WriteByte(' ')
+	m.w.WriteString(formatMetricValue(value))
+	m.w.WriteByte('\n')
+}
+
+func (m *metricsWriter) gauge(name, help string, value float64, labels ...string) {
+	m.family(name, "gauge", help)
+	m.sample(name, value, labels...)
+}
+
+func (m *metricsWriter) counter(name, help string, value float64, labels ...string) {
+	m.family(name, "counter", help)
+	m.sample(name+"_total", value, labels...)
+}
+
+// histograms writes one histogram family with a series per label value.
+func (m *metricsWriter) histograms(name, help, labelName string, v histogramVec) {
+	m.family(name, "histogram", help)
+	for _, label := range sortedKeys(v.byLabel) {
+		h := v.byLabel[label]
+		var cumulative uint64
+		for i, count := range h.counts {
+			cumulative += count
+			le := "+Inf"
+			if i < len(v.bounds) {
+				le = formatMetricValue(v.bounds[i])
+			}
+			m.sample(name+"_bucket", float64(cumulative), labelName, label, "le", le)
+		}
+		m.sample(name+"_count", float64(cumulative), labelName, label)
+		m.sample(name+"_sum", h.sum, labelName, label)
+	}
+}
+
+func formatMetricValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func boolMetric(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// WriteOpenMetrics writes the judge, HTTP, platform and system metrics in
+// the OpenMetrics text format. Counters and histograms are live; platform
+// and system gauges come from the cached Snapshot.
+func (s *OpsService) WriteOpenMetrics(ctx context.Context, w io.Writer) error {
+	snapshot, err := s.Snapshot(ctx)
+	if err != nil {
+		return err
+	}
+	m := &metricsWriter{w: bufio.NewWriter(w)}
+
+	m.gauge("judgo_up", "Whether the backend's dependencies answered the last health probe.", boolMetric(snapshot.Health.Ready))
+	m.gauge("judgo_uptime_seconds", "Seconds since the API started.", float64(snapshot.System.UptimeSec))
+	m.gauge("judgo_goroutines", "Goroutines of the API process.", float64(snapshot.System.Goroutines))
+	m.gauge("judgo_process_resident_memory_bytes", "Resident memory of the API process.", float64(readPlatformProcessRSS()))
+	m.gauge("judgo_process_cpu_percent", "CPU use of the API process since the previous sample.", snapshot.System.ProcessCPUPercent)
+	m.gauge("judgo_system_cpu_percent", "CPU use of the host since the previous sample.", snapshot.System.SystemCPUPercent)
+	m.gauge("judgo_system_load1", "One-minute load average of the host.", snapshot.System.Load1)
+
+	if s.judgeSvc != nil {
+		s.judgeSvc.writeOpenMetrics(m)
+	}
+	s.writeHTTPMetrics(m)
+
+	m.family("judgo_auth_failures", "counter", "Requests refused for missing or bad credentials.")
+	m.sample("judgo_auth_failures_total", float64(atomic.LoadInt64(&s.unauthorizedTotal)), "reason", "unauthorized")
+	m.sample("judgo_auth_failures_total", float64(atomic.LoadInt64(&s.forbiddenTotal)), "reason", "forbidden")
+	m.sample("judgo_auth_failures_total", float64(atomic.LoadInt64(&s.invalidPasswordTotal)), "reason", "invalid_password")
+
+	p := snapshot.Platform
+	m.gauge("judgo_platform_users", "Registered users.", float64(p.TotalUsers))
+	m.gauge("judgo_platform_admin_users", "Registered admins.", float64(p.AdminUsers))
+	m.family("judgo_platform_problems", "gauge", "Problems by status.")
+	m.sample("judgo_platform_problems", float64(p.PublishedProblems), "status", "published")
+	m.sample("judgo_platform_problems", float64(p.DraftProblems), "status", "draft")
+	m.sample("judgo_platform_problems", float64(p.ArchivedProblems), "status", "archived")
+	m.family("judgo_platform_submissions", "gauge", "Stored practice submissions by language.")
+	for _, lang := range sortedKeys(p.SubmissionsByLang) {
+		m.sample("judgo_platform_submissions", float64(p.SubmissionsByLang[lang]), "language", lang)
+	}
+	m.gauge("judgo_platform_passed_submissions", "Stored practice submissions that passed.", float64(p.PassedSubmissions))
+	m.family("judgo_platform_rooms", "gauge", "Open rooms by state.")
+	m.sample("judgo_platform_rooms", float64(p.WaitingRooms), "state", "waiting")
+	m.sample("judgo_platform_rooms", float64(p.RunningRooms), "state", "running")
+	m.gauge("judgo_platform_running_games", "Room games in progress.", float64(p.RunningGames))
+	m.gauge("judgo_platform_live_players", "Players in running rooms.", float64(p.LivePlayers))
+
+	m.w.WriteString("# EOF\n")
+	return m.w.Flush()
+}
+
+func (s *OpsService) writeHTTPMetrics(m *metricsWriter) {
+	s.httpMu.Lock()
+	requests := make(map[httpRequestKey]int64, len(s.httpRequests))
+	for k, n := range s.httpRequests {
+		requests[k] = n
+	}
+	durations := s.httpDurations.clone()
+	s.httpMu.Unlock()
+
+	keys := make([]httpRequestKey, 0, len(requests))
+	for k := range requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		return keys[i].status < keys[j].status
+	})
+	m.family("judgo_http_requests", "counter", "HTTP requests by matched route and status code.")
+	for _, k := range keys {
+		m.sample("judgo_http_requests_total", float64(requests[k]), "route", k.route, "code", strconv.Itoa(k.status))
+	}
+	m.histograms("judgo_http_request_duration_seconds", "Time to serve HTTP requests by matched route.", "route", durations)
+}
+
+func (s *JudgeService) writeOpenMetrics(m *metricsWriter) {
+	snapshot := s.MetricsSnapshot()
+	s.metrics.mu.Lock()
+	runs := make(map[judgeRunKey]int64, len(s.metrics.runs))
+	for k, n := range s.metrics.runs {
+		runs[k] = n
+	}
+	judgeDurations := s.metrics.judgeDurations.clone()
+	compileDurations := s.metrics.compileDurations.clone()
+	testcaseDurations := s.metrics.testcaseDurations.clone()
+	s.metrics.mu.Unlock()
+
+	keys := make([]judgeRunKey, 0, len(runs))
+	for k := range runs {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].language != keys[j].language {
+			return keys[i].language < keys[j].language
+		}
+		return keys[i].verdict < keys[j].verdict
+	})
+	m.family("judgo_judge_runs", "counter", "Judged submissions by language and verdict; IE includes runs that failed without a verdict.")
+	for _, k := range keys {
+		m.sample("judgo_judge_runs_total", float64(runs[k]), "language", k.language, "verdict", k.verdict)
+	}
+	m.histograms("judgo_judge_duration_seconds", "Time to judge a submission, compiling included.", "language", judgeDurations)
+	m.histograms("judgo_judge_compile_duration_seconds", "Compiler runs; compile cache hits are not counted.", "language", compileDurations)
+	m.histograms("judgo_judge_testcase_duration_seconds", "Wall-clock time of single testcase runs.", "language", testcaseDurations)
+
+	m.gauge("judgo_judge_active_sandboxes", "Submissions being compiled or run.", float64(snapshot.ActiveSandboxes))
+	m.gauge("judgo_judge_queue_depth", "Submissions waiting in the judge queue.", float64(snapshot.QueueDepth))
+	m.gauge("judgo_judge_queue_capacity", "Submissions the judge queue holds.", float64(snapshot.QueueCapacity))
+	m.gauge("judgo_judge_queue_workers", "Submissions judged at once, across remote workers if any.", float64(snapshot.QueueWorkers))
+	m.gauge("judgo_judge_remote_workers", "Live remote judge workers.", float64(snapshot.RemoteWorkers))
+	m.counter("judgo_judge_queue_rejected", "Submissions turned away because the queue was full.", float64(snapshot.QueueRejected))
+	m.family("judgo_judge_compile_cache_lookups", "counter", "Compile cache lookups by result.")
+	m.sample("judgo_judge_compile_cache_lookups_total", float64(snapshot.CompileCacheHits), "result", "hit")
+	m.sample("judgo_judge_compile_cache_lookups_total", float64(snapshot.CompileCacheMisses), "result", "miss")
+	m.gauge("judgo_judge_warm_pool_size", "Idle warm runtimes the pool keeps at most.", float64(snapshot.WarmPoolSize))
+	m.gauge("judgo_judge_warm_pool_idle", "Idle warm runtimes.", float64(snapshot.WarmPoolIdle))
+	m.family("judgo_judge_warm_pool_takes", "counter", "Runs that asked the warm pool for a runtime, by result.")
+	m.sample("judgo_judge_warm_pool_takes_total", float64(snapshot.WarmPoolHits), "result", "hit")
+	m.sample("judgo_judge_warm_pool_takes_total", float64(snapshot.WarmPoolMisses), "result", "miss")
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"crypto/subtle"
 	"fmt"
 	"math"
 	"os"
@@ -172,10 +173,39 @@ type OpsService struct {
 	status5xxTotal       int64
 	httpMu               sync.Mutex
 	httpObservations     []httpObservation
+	httpRequests         map[httpRequestKey]int64
+	httpDurations        histogramVec
+
+	// scrapeToken admits scrapers of the OpenMetrics endpoint; empty
+	// disables it.
+	scrapeToken string
 }
 
 func NewOpsService(userRepo firebaseRepo.UserRepository, practiceRepo firebaseRepo.PracticeRepository, roomSvc *RoomService, problemSvc *ProblemService, judgeSvc *JudgeService) *OpsService {
-	return &OpsService{userRepo: userRepo, practiceRepo: practiceRepo, roomSvc: roomSvc, problemSvc: problemSvc, judgeSvc: judgeSvc, startedAt: time.Now().UTC()}
+	return &OpsService{
+		userRepo:      userRepo,
+		practiceRepo:  practiceRepo,
+		roomSvc:       roomSvc,
+		problemSvc:    problemSvc,
+		judgeSvc:      judgeSvc,
+		startedAt:     time.Now().UTC(),
+		httpRequests:  map[httpRequestKey]int64{},
+		httpDurations: newHistogramVec(httpDurationBuckets),
+		scrapeToken:   strings.TrimSpace(os.Getenv("METRICS_SCRAPE_TOKEN")),
+	}
+}
+
+// ScrapeEnabled reports whether METRICS_SCRAPE_TOKEN is set.
+func (s *OpsService) ScrapeEnabled() bool {
+	return s.scrapeToken != ""
+}
+
+// AuthorizeScrape checks a scraper's bearer token.
+func (s *OpsService) AuthorizeScrape(token string) bool {
+	if s.scrapeToken == "" || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.scrapeToken)) == 1
 }
 
 func (s *OpsService) RecordHTTPError(status int, msg string) {
@@ -191,12 +221,26 @@ func (s *OpsService) RecordHTTPError(status int, msg string) {
 	}
 }
 
-func (s *OpsService) RecordHTTPRequest(path string, status int, duration time.Duration) {
+// RecordHTTPRequest records a served request. route is the pattern it
+// matched, "" if none.
+func (s *OpsService) RecordHTTPRequest(route, path string, status int, duration time.Duration) {
+	if status < 100 {
+		status = 200
+	}
+	if route == "" {
+		route = "unmatched"
+	}
+	s.httpMu.Lock()
+	s.httpRequests[httpRequestKey{route: route, status: status}]++
+	s.httpDurations.observe(route, duration.Seconds())
+	s.httpMu.Unlock()
+
 	if strings.TrimSpace(path) == "/healthz" {
 		return
 	}
-	if status < 100 {
-		status = 200
+	// Judge workers long-poll for jobs, which would swamp request latency.
+	if strings.HasPrefix(path, "/judge-workers/") {
+		return
 	}
 	atomic.AddInt64(&s.totalRequests, 1)
 	switch {
@@ -0,0 +1,283 @@
+package service
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+
+	"github.com/AQADIL/JudGO/internal/domain"
+)
+
+// defaultDeniedImports are refused in every problem unless its policy allows
+// them. The sandbox already has no network and no way out; the list makes an
+// attempt show up as a clear verdict instead of a runtime error.
+var defaultDeniedImports = map[JudgeLanguage][]string{
+	JudgeLanguageGo:     {"os/exec", "net", "syscall", "unsafe", "plugin", "C"},
+	JudgeLanguagePython: {"subprocess", "socket", "ctypes", "multiprocessing", "pty", "importlib", "__import__"},
+}
+
+// checkPolicy returns the imports of code that p's policy does not allow,
+// and what to do about them. Languages without an analyzer always pass.
+func checkPolicy(p *domain.Problem, lang JudgeLanguage, code string) (domain.PolicyAction, []string) {
+	policy := p.Policy
+	if policy == nil {
+		policy = &domain.ProblemPolicy{}
+	}
+	action := policy.Action
+	if action == "" {
+		action = domain.PolicyActionReject
+	}
+	if action == domain.PolicyActionOff {
+		return action, nil
+	}
+
+	var imports []string
+	sep := "."
+	switch lang {
+	case JudgeLanguageGo:
+		imports, sep = goImports(code), "/"
+	case JudgeLanguagePython:
+		imports = pythonImports(code)
+	default:
+		return action, nil
+	}
+	deny := append(append([]string{}, defaultDeniedImports[lang]...), policy.Deny[string(lang)]...)
+	allow := policy.Allow[string(lang)]
+
+	var violations, seen []string
+	for _, imp := range imports {
+		// A module already reported covers its names, e.g. subprocess.run.
+		if importMatches(imp, seen, sep) || !importMatches(imp, deny, sep) || importMatches(imp, allow, sep) {
+			continue
+		}
+		seen = append(seen, imp)
+		violations = append(violations, fmt.Sprintf("import of %q is not allowed", imp))
+	}
+	return action, violations
+}
+
+// importMatches reports whether imp is one of entries or below one of them.
+func importMatches(imp string, entries []string, sep string) bool {
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if e != "" && (imp == e || strings.HasPrefix(imp, e+sep)) {
+			return true
+		}
+	}
+	return false
+}
+
+// goImports lists the import paths of a Go file. A file that does not parse
+// lists none and is left to the compiler to reject.
+func goImports(code string) []string {
+	f, err := parser.ParseFile(token.NewFileSet(), "main.go", code, parser.ImportsOnly)
+	if err != nil {
+		return nil
+	}
+	out := make([]string, 0, len(f.Imports))
+	for _, spec := range f.Imports {
+		if path, err := strconv.Unquote(spec.Path.Value); err == nil {
+			out = append(out, path)
+		}
+	}
+	return out
+}
+
+// pythonImports lists the modules a Python program imports: `import a.b`
+// gives a.b, `from a import b` gives a and a.b. Relative imports are skipped.
+// Any use of __import__ is reported as importing it.
+func pythonImports(code string) []string {
+	toks := tokenizePython(code)
+	var out []string
+	// dotted reads a dotted name starting at toks[i].
+	dotted := func(i int) (string, int) {
+		var parts []string
+		for i < len(toks) && toks[i].kind == pyName {
+			parts = append(parts, toks[i].text)
+			i++
+			if i < len(toks) && toks[i].text == "." {
+				i++
+				continue
+			}
+			break
+		}
+		return strings.Join(parts, "."), i
+	}
+
+	stmtStart := true
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		if t.kind == pyName && t.text == "__import__" {
+			out = append(out, "__import__")
+		}
+		if !stmtStart {
+			stmtStart = t.kind == pyEnd
+			continue
+		}
+		stmtStart = t.kind == pyEnd
+		if t.kind != pyName {
+			continue
+		}
+		switch t.text {
+		case "import":
+			for j := i + 1; j < len(toks); {
+				name, next := dotted(j)
+				if name != "" {
+					out = append(out, name)
+				}
+				j = next
+				if j+1 < len(toks) && toks[j].text == "as" {
+					j += 2
+				}
+				if j >= len(toks) || toks[j].text != "," {
+					i = j - 1
+					break
+				}
+				j++
+			}
+		case "from":
+			if i+1 >= len(toks) || toks[i+1].text == "." {
+				continue
+			}
+			mod, j := dotted(i + 1)
+			if mod == "" || j >= len(toks) || toks[j].text != "import" {
+				continue
+			}
+			out = append(out, mod)
+			for j++; j < len(toks) && toks[j].kind != pyEnd; j++ {
+				if toks[j].kind == pyName && toks[j].text != "as" && (j == 0 || toks[j-1].text != "as") {
+					out = append(out, mod+"."+toks[j].text)
+				}
+			}
+			i = j - 1
+		}
+	}
+	return out
+}
+
+type pyTokenKind int
+
+const (
+	pyName pyTokenKind = iota
+	pyOp
+	pyString
+	pyNumber
+	// pyEnd ends a statement: a newline outside brackets, a `;`, or the `:`
+	// of a compound statement written on one line.
+	pyEnd
+)
+
+type pyToken struct {
+	kind pyTokenKind
+	text string
+}
+
+// tokenizePython is a tokenizer pass good enough to find import statements:
+// it skips comments and string literals (prefixed, triple-quoted and with
+// escapes), joins lines inside brackets and after a backslash, and marks
+// where statements end. Indentation is not tracked.
+func tokenizePython(code string) []pyToken {
+	var toks []pyToken
+	depth := 0
+	end := func() {
+		if len(toks) > 0 && toks[len(toks)-1].kind != pyEnd {
+			toks = append(toks, pyToken{kind: pyEnd})
+		}
+	}
+	for i := 0; i < len(code); {
+		c := code[i]
+		switch {
+		case c == '#':
+			for i < len(code) && code[i] != '\n' {
+				i++
+			}
+		case c == '\\' && i+1 < len(code) && code[i+1] == '\n':
+			i += 2
+		case c == '\n':
+			if depth == 0 {
+				end()
+			}
+			i++
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f':
+			i++
+		case c == '"' || c == '\'':
+			i = skipPythonString(code, i)
+			toks = append(toks, pyToken{kind: pyString})
+		case isPyNameStart(c):
+			j := i
+			for j < len(code) && isPyNameChar(code[j]) {
+				j++
+			}
+			// A string prefix such as r, b or f runs into its quote.
+			if j < len(code) && (code[j] == '"' || code[j] == '\'') && j-i <= 2 && strings.Trim(strings.ToLower(code[i:j]), "rbfu") == "" {
+				i = skipPythonString(code, j)
+				toks = append(toks, pyToken{kind: pyString})
+				continue
+			}
+			toks = append(toks, pyToken{kind: pyName, text: code[i:j]})
+			i = j
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(code) && (isPyNameChar(code[j]) || code[j] == '.') {
+				j++
+			}
+			toks = append(toks, pyToken{kind: pyNumber, text: code[i:j]})
+			i = j
+		default:
+			switch c {
+			case '(', '[', '{':
+				depth++
+			case ')', ']', '}':
+				if depth > 0 {
+					depth--
+				}
+			}
+			if depth == 0 && (c == ';' || c == ':') {
+				end()
+			} else {
+				toks = append(toks, pyToken{kind: pyOp, text: string(c)})
+			}
+			i++
+		}
+	}
+	end()
+	return toks
+}
+
+// skipPythonString returns the index just past the string literal whose
+// opening quote is at code[i]. An unterminated literal runs to the end.
+func skipPythonString(code string, i int) int {
+	q := code[i]
+	if strings.HasPrefix(code[i:], strings.Repeat(string(q), 3)) {
+		closing := strings.Repeat(string(q), 3)
+		for j := i + 3; j < len(code); j++ {
+			if code[j] == '\\' {
+				j++
+				continue
+			}
+			if strings.HasPrefix(code[j:], closing) {
+				return j + 3
+			}
+		}
+		return len(code)
+	}
+	for j := i + 1; j < len(code); j++ {
+		switch code[j] {
+		case '\\':
+			j++
+		case q, '\n':
+			return j + 1
+		}
+	}
+	return len(code)
+}
+
+func isPyNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isPyNameChar(c byte) bool {
+	return isPyNameStart(c) || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AQADIL/JudGO/internal/domain"
+)
+
+func TestPythonImports(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want []string
+	}{
+		{"import", "import sys\n", []string{"sys"}},
+		{"dotted and aliased", "import os.path as p, json\n", []string{"os.path", "json"}},
+		{"from", "from subprocess import run, PIPE as P\n", []string{"subprocess", "subprocess.run", "subprocess.PIPE"}},
+		{"from parenthesized", "from socket import (\n    socket,\n    AF_INET,\n)\n", []string{"socket", "socket.socket", "socket.AF_INET"}},
+		{"relative", "from . import x\n", nil},
+		{"after semicolon", "x = 1; import ctypes\n", []string{"ctypes"}},
+		{"one-line compound", "if True: import pty\n", []string{"pty"}},
+		{"indented", "def f():\n    import subprocess\n", []string{"subprocess"}},
+		{"line continuation", "import \\\n  socket\n", []string{"socket"}},
+		{"in a comment", "# import socket\nprint(1)\n", nil},
+		{"in a string", "s = 'import socket'\nt = \"\"\"\nimport ctypes\n\"\"\"\n", nil},
+		{"in a prefixed string", "s = rb'import socket'\n", nil},
+		{"not a statement", "x = important\nprint(x.import_)\n", nil},
+		{"dunder import", "m = __import__('socket')\n", []string{"__import__"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pythonImports(tt.code); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("imports %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckPolicy(t *testing.T) {
+	const goExec = "package main\nimport (\n\t\"fmt\"\n\t\"os/exec\"\n)\nfunc main() { fmt.Println(exec.Command) }\n"
+	tests := []struct {
+		name       string
+		policy     *domain.ProblemPolicy
+		lang       JudgeLanguage
+		code       string
+		action     domain.PolicyAction
+		violations []string
+	}{
+		{"clean python", nil, JudgeLanguagePython, "import sys\nprint(sum(map(int, sys.stdin.read().split())))\n", domain.PolicyActionReject, nil},
+		{"python default deny", nil, JudgeLanguagePython, "import subprocess\nsubprocess.run(['ls'])\n", domain.PolicyActionReject, []string{"subprocess"}},
+		{"submodule of denied", nil, JudgeLanguagePython, "import multiprocessing.pool\n", domain.PolicyActionReject, []string{"multiprocessing.pool"}},
+		{"module reported once", nil, JudgeLanguagePython, "from socket import socket, create_connection\n", domain.PolicyActionReject, []string{"socket"}},
+		{"go default deny", nil, JudgeLanguageGo, goExec, domain.PolicyActionReject, []string{"os/exec"}},
+		{"go prefix is not a parent", nil, JudgeLanguageGo, "package main\nimport \"net2\"\n", domain.PolicyActionReject, nil},
+		{"go subpackage", nil, JudgeLanguageGo, "package main\nimport \"net/http\"\n", domain.PolicyActionReject, []string{"net/http"}},
+		{"go that does not parse", nil, JudgeLanguageGo, "import \"os/exec\"\n", domain.PolicyActionReject, nil},
+		{"allowed", &domain.ProblemPolicy{Allow: map[string][]string{"py": {"multiprocessing"}}}, JudgeLanguagePython, "import multiprocessing\n", domain.PolicyActionReject, nil},
+		{"extra deny", &domain.ProblemPolicy{Deny: map[string][]string{"py": {"numpy"}}}, JudgeLanguagePython, "import numpy as np\n", domain.PolicyActionReject, []string{"numpy"}},
+		{"flag", &domain.ProblemPolicy{Action: domain.PolicyActionFlag}, JudgeLanguagePython, "import ctypes\n", domain.PolicyActionFlag, []string{"ctypes"}},
+		{"off", &domain.ProblemPolicy{Action: domain.PolicyActionOff}, JudgeLanguagePython, "import ctypes\n", domain.PolicyActionOff, nil},
+		{"no analyzer", nil, JudgeLanguageCPP, "#include <unistd.h>\nint main() { fork(); }\n", domain.PolicyActionReject, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, violations := checkPolicy(&domain.Problem{Policy: tt.policy}, tt.lang, tt.code)
+			if action != tt.action {
+				t.Fatalf("action %s, want %s", action, tt.action)
+			}
+			if len(violations) != len(tt.violations) {
+				t.Fatalf("violations %q, want imports %q", violations, tt.violations)
+			}
+			for i, imp := range tt.violations {
+				if !strings.Contains(violations[i], `"`+imp+`"`) {
+					t.Fatalf("violation %q, want import %q", violations[i], imp)
+				}
+			}
+		})
+	}
+}
@@ -18,10 +18,15 @@ type ProblemRepository interface {
 
 type ProblemService struct {
 	repo ProblemRepository
+	// testData holds testcase data when set; problems then only keep
+	// checksums of their hidden tests.
+	testData TestDataStore
+	// held is the test data versions judges are still reading.
+	held testDataHolds
 }
 
-func NewProblemService(repo ProblemRepository) *ProblemService {
-	return &ProblemService{repo: repo}
+func NewProblemService(repo ProblemRepository, testData TestDataStore) *ProblemService {
+	return &ProblemService{repo: repo, testData: testData}
 }
 
 func trimTrailingWhitespace(s string) string {
@@ -38,6 +43,45 @@ func normalizeProblem(p *domain.Problem) {
 	}
 }
 
+func validateLimits(p *domain.Problem) error {
+	if p.TimeLimitMs < 0 || p.TimeLimitMs > maxTimeLimitMs {
+		return fmt.Errorf("timeLimitMs must be between 0 and %d", maxTimeLimitMs)
+	}
+	if p.MemoryLimitMB < 0 || p.MemoryLimitMB > maxMemoryLimitMB {
+		return fmt.Errorf("memoryLimitMb must be between 0 and %d", maxMemoryLimitMB)
+	}
+	if p.OutputLimitKB < 0 || p.OutputLimitKB > maxOutputLimitKB {
+		return fmt.Errorf("outputLimitKb must be between 0 and %d", maxOutputLimitKB)
+	}
+	return nil
+}
+
+func validateProblemProgram(role string, prog *domain.ProblemProgram) error {
+	if prog == nil {
+		return nil
+	}
+	prog.Language = strings.TrimSpace(prog.Language)
+	if prog.Language == "" {
+		return fmt.Errorf("%s language is required", role)
+	}
+	if strings.TrimSpace(prog.Code) == "" {
+		return fmt.Errorf("%s code is required", role)
+	}
+	return nil
+}
+
+func validatePolicy(policy *domain.ProblemPolicy) error {
+	if policy == nil {
+		return nil
+	}
+	switch policy.Action {
+	case "", domain.PolicyActionReject, domain.PolicyActionFlag, domain.PolicyActionOff:
+	default:
+		return fmt.Errorf("unknown policy action: %s", policy.Action)
+	}
+	return nil
+}
+
 func (s *ProblemService) Create(ctx context.Context, p *domain.Problem) (*domain.Problem, error) {
 	if p == nil {
 		return nil, fmt.Errorf("problem is required")
@@ -59,7 +103,48 @@ func (s *ProblemService) Create(ctx context.Context, p *domain.Problem) (*domain
 	if p.StarterCode == nil {
 		p.StarterCode = map[string]string{}
 	}
+	if err := validateLimits(p); err != nil {
+		return nil, err
+	}
+	switch p.Type {
+	case "":
+		p.Type = domain.ProblemTypeStandard
+	case domain.ProblemTypeStandard, domain.ProblemTypeInteractive:
+	default:
+		return nil, fmt.Errorf("unknown problem type: %s", p.Type)
+	}
+	if p.Type == domain.ProblemTypeInteractive && p.Interactor == nil {
+		return nil, fmt.Errorf("interactive problems require an interactor")
+	}
+	if err := validateSubtasks(p); err != nil {
+		return nil, err
+	}
+	if err := validateProblemProgram("checker", p.Checker); err != nil {
+		return nil, err
+	}
+	if err := validateProblemProgram("interactor", p.Interactor); err != nil {
+		return nil, err
+	}
+	if err := validateProblemProgram("generator", p.Generator); err != nil {
+		return nil, err
+	}
+	if err := validateProblemProgram("reference solution", p.Reference); err != nil {
+		return nil, err
+	}
+	if err := validateProblemProgram("validator", p.Validator); err != nil {
+		return nil, err
+	}
+	if err := validatePolicy(p.Policy); err != nil {
+		return nil, err
+	}
+	if len(p.GeneratorTests) > 0 && (p.Generator == nil || p.Reference == nil) {
+		return nil, fmt.Errorf("generatorTests require a generator and a reference solution")
+	}
 	normalizeProblem(p)
+	prev, err := s.storeTestData(ctx, p)
+	if err != nil {
+		return nil, err
+	}
 
 	now := time.Now().UTC()
 	if p.CreatedAt.IsZero() {
@@ -70,10 +155,77 @@ func (s *ProblemService) Create(ctx context.Context, p *domain.Problem) (*domain
 	if err := s.repo.Create(ctx, p); err != nil {
 		return nil, err
 	}
+	s.pruneTestData(ctx, p, prev)
 	cp := *p
 	return &cp, nil
 }
 
+// ProblemLimits is a partial update of a problem's limits; nil fields are
+// left as they are and zero restores the judge default.
+type ProblemLimits struct {
+	TimeLimitMs   *int `json:"timeLimitMs,omitempty"`
+	MemoryLimitMB *int `json:"memoryLimitMb,omitempty"`
+	OutputLimitKB *int `json:"outputLimitKb,omitempty"`
+}
+
+func (s *ProblemService) UpdateLimits(ctx context.Context, id string, limits ProblemLimits) (*domain.Problem, error) {
+	p, err := s.GetAdmin(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, fmt.Errorf("problem not found")
+	}
+	if limits.TimeLimitMs != nil {
+		p.TimeLimitMs = *limits.TimeLimitMs
+	}
+	if limits.MemoryLimitMB != nil {
+		p.MemoryLimitMB = *limits.MemoryLimitMB
+	}
+	if limits.OutputLimitKB != nil {
+		p.OutputLimitKB = *limits.OutputLimitKB
+	}
+	if err := validateLimits(p); err != nil {
+		return nil, err
+	}
+	p.UpdatedAt = time.Now().UTC()
+	if err := s.repo.Create(ctx, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ReplaceTestCases stores generated testcases on the problem. version is the
+// UpdatedAt the tests were generated from; if the problem was changed since,
+// they may be stale and are refused.
+func (s *ProblemService) ReplaceTestCases(ctx context.Context, id string, version time.Time, tests []domain.ProblemTestCase) (*domain.Problem, error) {
+	p, err := s.GetAdmin(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, fmt.Errorf("problem not found")
+	}
+	if !p.UpdatedAt.Equal(version) {
+		return nil, fmt.Errorf("problem was changed while its tests were being generated")
+	}
+	p.TestCases = tests
+	if err := validateSubtasks(p); err != nil {
+		return nil, err
+	}
+	normalizeProblem(p)
+	prev, err := s.storeTestData(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	p.UpdatedAt = time.Now().UTC()
+	if err := s.repo.Create(ctx, p); err != nil {
+		return nil, err
+	}
+	s.pruneTestData(ctx, p, prev)
+	return p, nil
+}
+
 func (s *ProblemService) GetAdmin(ctx context.Context, id string) (*domain.Problem, error) {
 	id = strings.TrimSpace(id)
 	if id == "" {
@@ -95,6 +247,12 @@ func (s *ProblemService) GetPublic(ctx context.Context, id string) (*domain.Prob
 	}
 
 	cp := *p
+	cp.Checker = nil
+	cp.Interactor = nil
+	cp.Generator = nil
+	cp.GeneratorTests = nil
+	cp.Reference = nil
+	cp.Validator = nil
 	if len(p.TestCases) > 0 {
 		filtered := make([]domain.ProblemTestCase, 0, len(p.TestCases))
 		for _, tc := range p.TestCases {
@@ -123,6 +281,12 @@ func (s *ProblemService) ListPublic(ctx context.Context) ([]*domain.Problem, err
 		}
 		cp := *p
 		cp.TestCases = nil
+		cp.Checker = nil
+		cp.Interactor = nil
+		cp.Generator = nil
+		cp.GeneratorTests = nil
+		cp.Reference = nil
+		cp.Validator = nil
 		out = append(out, &cp)
 	}
 	return out, nil
@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/AQADIL/JudGO/internal/domain"
+	firebaseRepo "github.com/AQADIL/JudGO/internal/repository/firebase"
+)
+
+type RejudgeState string
+
+const (
+	RejudgeStateRunning RejudgeState = "RUNNING"
+	RejudgeStateDone    RejudgeState = "DONE"
+)
+
+// finished rejudges stay pollable this long after they are done
+const rejudgeRetention = time.Hour
+
+// RejudgeFlip is a stored submission whose verdict changed on rejudge.
+type RejudgeFlip struct {
+	UserID        string         `json:"userId"`
+	SubmissionID  string         `json:"submissionId"`
+	AttemptNumber int            `json:"attemptNumber"`
+	OldVerdict    domain.Verdict `json:"oldVerdict"`
+	NewVerdict    domain.Verdict `json:"newVerdict"`
+	OldPassed     bool           `json:"oldPassed"`
+	NewPassed     bool           `json:"newPassed"`
+}
+
+// RejudgeJob reports on the rejudge of one problem's practice submissions.
+// Failed counts submissions that could not be judged; they keep their old
+// verdict.
+type RejudgeJob struct {
+	ID         string        `json:"id"`
+	ProblemID  string        `json:"problemId"`
+	State      RejudgeState  `json:"status"`
+	Total      int           `json:"total"`
+	Done       int           `json:"done"`
+	Failed     int           `json:"failed"`
+	Flips      []RejudgeFlip `json:"flips"`
+	SolvedBy   int           `json:"solvedBy"`
+	Error      string        `json:"error,omitempty"`
+	StartedAt  time.Time     `json:"startedAt"`
+	FinishedAt *time.Time    `json:"finishedAt,omitempty"`
+}
+
+// RejudgeService re-runs stored practice submissions against a problem's
+// current testcases, e.g. after a wrong expected output was fixed, and brings
+// their verdicts and the solved markers up to date.
+type RejudgeService struct {
+	practice firebaseRepo.PracticeRepository
+	judge    *JudgeService
+
+	mu        sync.Mutex
+	jobs      map[string]*RejudgeJob
+	byProblem map[string]string
+}
+
+func NewRejudgeService(practice firebaseRepo.PracticeRepository, judge *JudgeService) *RejudgeService {
+	return &RejudgeService{practice: practice, judge: judge, jobs: map[string]*RejudgeJob{}, byProblem: map[string]string{}}
+}
+
+// Start begins rejudging every practice submission for problemID in the
+// background. A problem is rejudged by at most one job at a time.
+func (s *RejudgeService) Start(ctx context.Context, problemID string) (*RejudgeJob, error) {
+	problemID = strings.TrimSpace(problemID)
+	if problemID == "" {
+		return nil, fmt.Errorf("problemId is required")
+	}
+	if s.practice == nil || s.judge == nil {
+		return nil, fmt.Errorf("rejudge is not configured")
+	}
+	if !s.judge.enabled() {
+		return nil, fmt.Errorf("judge is disabled: sandbox isolation is unavailable (set JUDGE_DEV=1 to run unsandboxed)")
+	}
+	p, err := s.judge.problems.GetAdmin(ctx, problemID)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, fmt.Errorf("problem not found")
+	}
+
+	now := time.Now().UTC()
+	s.mu.Lock()
+	s.pruneLocked(now)
+	if id, ok := s.byProblem[problemID]; ok {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("problem is already being rejudged by %s", id)
+	}
+	job := &RejudgeJob{ID: uuid.NewString(), ProblemID: problemID, State: RejudgeStateRunning, Flips: []RejudgeFlip{}, StartedAt: now}
+	s.jobs[job.ID] = job
+	s.byProblem[problemID] = job.ID
+	cp := s.snapshotLocked(job)
+	s.mu.Unlock()
+
+	go s.run(job)
+	return cp, nil
+}
+
+// Job returns a snapshot of a running or recently finished rejudge.
+func (s *RejudgeService) Job(id string) (*RejudgeJob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[strings.TrimSpace(id)]
+	if !ok {
+		return nil, false
+	}
+	return s.snapshotLocked(job), true
+}
+
+func (s *RejudgeService) snapshotLocked(job *RejudgeJob) *RejudgeJob {
+	cp := *job
+	cp.Flips = append([]RejudgeFlip(nil), job.Flips...)
+	return &cp
+}
+
+func (s *RejudgeService) pruneLocked(now time.Time) {
+	for id, job := range s.jobs {
+		if job.FinishedAt != nil && now.Sub(*job.FinishedAt) > rejudgeRetention {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+func (s *RejudgeService) run(job *RejudgeJob) {
+	err := s.rejudge(job)
+	if err != nil {
+		log.Printf("[REJUDGE] problem %s failed: %v", job.ProblemID, err)
+	}
+	finishedAt := time.Now().UTC()
+	s.mu.Lock()
+	job.State = RejudgeStateDone
+	job.FinishedAt = &finishedAt
+	if err != nil {
+		job.Error = err.Error()
+	}
+	delete(s.byProblem, job.ProblemID)
+	s.mu.Unlock()
+	log.Printf("[REJUDGE] problem %s: %d submissions, %d failed, %d flipped", job.ProblemID, job.Total, job.Failed, len(job.Flips))
+}
+
+// rejudge judges the submissions one at a time through the judge queue's
+// background lane, so they wait for live submissions; each still runs its
+// testcases in parallel under the judge's sandbox slots.
+func (s *RejudgeService) rejudge(job *RejudgeJob) error {
+	ctx := context.Background()
+	subs, err := s.practice.ListProblemSubmissions(ctx, job.ProblemID)
+	if err != nil {
+		return fmt.Errorf("failed to list submissions: %w", err)
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		if subs[i].UserID != subs[j].UserID {
+			return subs[i].UserID < subs[j].UserID
+		}
+		return subs[i].AttemptNumber < subs[j].AttemptNumber
+	})
+	s.mu.Lock()
+	job.Total = len(subs)
+	s.mu.Unlock()
+
+	for i := range subs {
+		sub := &subs[i]
+		flip, ok := s.rejudgeOne(ctx, sub)
+		s.mu.Lock()
+		job.Done++
+		if !ok {
+			job.Failed++
+		}
+		if flip != nil {
+			job.Flips = append(job.Flips, *flip)
+		}
+		s.mu.Unlock()
+	}
+
+	solvedBy, err := s.updateSolved(ctx, job.ProblemID, subs)
+	s.mu.Lock()
+	job.SolvedBy = solvedBy
+	s.mu.Unlock()
+	return err
+}
+
+// rejudgeOne judges sub again and stores the new outcome in it and in the
+// repository. It reports false when the submission could not be judged.
+func (s *RejudgeService) rejudgeOne(ctx context.Context, sub *firebaseRepo.PracticeSubmission) (*RejudgeFlip, bool) {
+	jr, err := s.judge.judgeBackground(ctx, sub.ProblemID, JudgeLanguage(sub.Language), sub.Code, JudgeOptions{})
+	if err != nil {
+		log.Printf("[REJUDGE] submission %s/%s: %v", sub.UserID, sub.ID, err)
+		return nil, false
+	}
+	var flip *RejudgeFlip
+	if jr.Passed != sub.Passed || jr.Verdict != sub.Verdict {
+		flip = &RejudgeFlip{
+			UserID:        sub.UserID,
+			SubmissionID:  sub.ID,
+			AttemptNumber: sub.AttemptNumber,
+			OldVerdict:    sub.Verdict,
+			NewVerdict:    jr.Verdict,
+			OldPassed:     sub.Passed,
+			NewPassed:     jr.Passed,
+		}
+	}
+	sub.Passed = jr.Passed
+	sub.Verdict = jr.Verdict
+	sub.PassedCount = jr.PassedCnt
+	sub.TotalCount = jr.TotalCnt
+	sub.Score = jr.Score
+	sub.MaxScore = jr.MaxScore
+	if err := s.practice.UpdateSubmission(ctx, sub); err != nil {
+		log.Printf("[REJUDGE] failed to store submission %s/%s: %v", sub.UserID, sub.ID, err)
+		return flip, false
+	}
+	return flip, true
+}
+
+// updateSolved rewrites the solved marker of each user in subs from their
+// earliest passing attempt, removing it when no attempt passes any more. The
+// user's submissions are read again first, so attempts made while the
+// rejudge ran count too.
+func (s *RejudgeService) updateSolved(ctx context.Context, problemID string, subs []firebaseRepo.PracticeSubmission) (int, error) {
+	users := map[string]bool{}
+	for _, sub := range subs {
+		users[sub.UserID] = true
+	}
+	count := 0
+	var firstErr error
+	for userID := range users {
+		rec, err := s.earliestSolve(ctx, userID, problemID)
+		if err == nil {
+			err = s.practice.ReplaceSolved(ctx, userID, problemID, rec)
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("failed to update solved marker for %s: %w", userID, err)
+			}
+			continue
+		}
+		if rec != nil {
+			count++
+		}
+	}
+	return count, firstErr
+}
+
+// earliestSolve returns the solved marker for the user's earliest stored
+// passing attempt at problemID, or nil when none passes.
+func (s *RejudgeService) earliestSolve(ctx context.Context, userID, problemID string) (*firebaseRepo.PracticeSolved, error) {
+	subs, err := s.practice.ListSubmissions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	var rec *firebaseRepo.PracticeSolved
+	for _, sub := range subs {
+		if sub.ProblemID != problemID || !sub.Passed || sub.AttemptNumber <= 0 {
+			continue
+		}
+		if rec == nil || sub.AttemptNumber < rec.AttemptsToSolve {
+			rec = &firebaseRepo.PracticeSolved{
+				UserID:          userID,
+				ProblemID:       problemID,
+				AttemptsToSolve: sub.AttemptNumber,
+				SolvedAt:        sub.CreatedAt,
+			}
+		}
+	}
+	return rec, nil
+}
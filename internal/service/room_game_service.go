@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"fmt"
+	"log"
 	"strings"
 	"time"
 
@@ -15,6 +16,10 @@ type RoomGameRepository interface {
 	Create(ctx context.Context, g *domain.RoomGame) error
 	Get(ctx context.Context, id string) (*domain.RoomGame, error)
 	Update(ctx context.Context, g *domain.RoomGame) error
+	// UpdateProgress and Transact apply fn to a player's progress or to
+	// the whole game in a transaction and return what was stored.
+	UpdateProgress(ctx context.Context, gameID, userID string, fn func(pr *domain.RoomUserProgress) error) (*domain.RoomUserProgress, error)
+	Transact(ctx context.Context, id string, fn func(g *domain.RoomGame) error) (*domain.RoomGame, error)
 	Delete(ctx context.Context, id string) error
 }
 
@@ -101,6 +106,7 @@ func (s *RoomGameService) CreateFromRoom(ctx context.Context, room *domain.Room)
 						InputFormat:  p.InputFormat,
 						OutputFormat: p.OutputFormat,
 						Samples:      samples,
+						MaxPoints:    maxScore(p),
 					})
 					used[p.ID] = true
 					return
@@ -126,19 +132,22 @@ func (s *RoomGameService) CreateFromRoom(ctx context.Context, room *domain.Room)
 	}
 
 	if len(problems) == 0 {
-		problems = append(problems, domain.RoomProblem{ID: "stub-1", Title: "Warmup", Difficulty: string(room.Settings.Difficulty), Statement: "Solve the problem. (Stub task for now)"})
+		problems = append(problems, domain.RoomProblem{ID: "stub-1", Title: "Warmup", Difficulty: string(room.Settings.Difficulty), Statement: "Solve the problem. (Stub task for now)", MaxPoints: fullScore})
 	}
 
 	g := &domain.RoomGame{
-		ID:          id,
-		RoomCode:    room.Code,
-		Status:      domain.RoomGameStatusRunning,
-		Language:    room.Settings.Language,
-		DurationMin: durMin,
-		StartedAt:   now,
-		EndsAt:      time.Time{},
-		Problems:    problems,
-		Progress:    map[string]domain.RoomUserProgress{},
+		ID:           id,
+		RoomCode:     room.Code,
+		Status:       domain.RoomGameStatusRunning,
+		Language:     room.Settings.Language,
+		Ranking:      room.Settings.Ranking,
+		DurationMin:  durMin,
+		HackPhaseMin: room.Settings.HackPhaseMin,
+		StartedAt:    now,
+		EndsAt:       time.Time{},
+		Problems:     problems,
+		Progress:     map[string]domain.RoomUserProgress{},
+		Hacks:        map[string]domain.RoomHack{},
 	}
 	if !noTimeLimit && durMin > 0 {
 		g.EndsAt = now.Add(time.Duration(durMin) * time.Minute)
@@ -171,15 +180,11 @@ func (s *RoomGameService) Submit(ctx context.Context, gameID, userID, displayNam
 	if err != nil {
 		return nil, nil, err
 	}
-	if g.Status == domain.RoomGameStatusRunning && !g.EndsAt.IsZero() && time.Now().UTC().After(g.EndsAt) {
-		now := time.Now().UTC()
-		g.Status = domain.RoomGameStatusFinished
-		g.FinishedAt = &now
-		g.WinnerUserID = s.winnerByMostSolved(g)
+	if s.advancePhase(g, time.Now().UTC()) {
 		_ = s.repo.Update(ctx, g)
-		return g, nil, nil
 	}
-	if g.Status == domain.RoomGameStatusFinished {
+	// Submissions close with the coding phase.
+	if g.Status != domain.RoomGameStatusRunning {
 		return g, nil, nil
 	}
 
@@ -194,20 +199,6 @@ func (s *RoomGameService) Submit(ctx context.Context, gameID, userID, displayNam
 		return nil, nil, fmt.Errorf("problem not in this room")
 	}
 
-	if g.Progress == nil {
-		g.Progress = map[string]domain.RoomUserProgress{}
-	}
-	pr := g.Progress[userID]
-	if pr.UserID == "" {
-		pr = domain.RoomUserProgress{UserID: userID, DisplayName: displayName, Solved: map[string]bool{}, LastSubmit: map[string]domain.RoomSubmission{}}
-	}
-	if pr.Solved == nil {
-		pr.Solved = map[string]bool{}
-	}
-	if pr.LastSubmit == nil {
-		pr.LastSubmit = map[string]domain.RoomSubmission{}
-	}
-
 	sub := domain.RoomSubmission{
 		UserID:      userID,
 		DisplayName: displayName,
@@ -217,43 +208,226 @@ func (s *RoomGameService) Submit(ctx context.Context, gameID, userID, displayNam
 		Correct:     false,
 	}
 
-	if s.judge != nil && problemID != "" {
-		lang := JudgeLanguage(strings.ToLower(string(g.Language)))
-		jr, jerr := s.judge.Judge(ctx, problemID, lang, code, 5*time.Second)
-		if jerr != nil {
-			sub.Correct = false
-			sub.ErrorMessage = jerr.Error()
-		} else {
-			if jr != nil {
-				sub.Correct = jr.Passed
-				if !jr.Passed {
-					sub.ErrorMessage = fmt.Sprintf("wrong answer: %d/%d", jr.PassedCnt, jr.TotalCnt)
-				}
+	if s.judge == nil {
+		sub.Correct = strings.EqualFold(code, "CORRECT")
+		sub.Verdict = domain.VerdictWrongAnswer
+		sub.MaxScore = fullScore
+		if sub.Correct {
+			sub.Verdict = domain.VerdictAccepted
+			sub.Score = fullScore
+		}
+		if err := s.recordSubmission(ctx, g, userID, sub); err != nil {
+			return nil, nil, err
+		}
+		cp := sub
+		return g, &cp, nil
+	}
+
+	// The submission is stored as pending before it is queued, so its result
+	// cannot land first and be overwritten by it.
+	prev, hadPrev := g.Progress[userID].LastSubmit[problemID]
+	sub.Pending = true
+	if err := s.recordSubmission(ctx, g, userID, sub); err != nil {
+		return nil, nil, err
+	}
+	lang := JudgeLanguage(strings.ToLower(string(g.Language)))
+	queued := sub
+	job, err := s.judge.Enqueue(ctx, problemID, lang, code, JudgeOptions{StopOnFirstFailure: true, UserID: userID}, func(jr *JudgeResult, jerr error) {
+		s.applyJudgeResult(gameID, userID, queued, jr, jerr)
+	})
+	if err != nil {
+		s.updatePending(ctx, g, userID, sub, func(pr *domain.RoomUserProgress) {
+			if hadPrev {
+				pr.LastSubmit[problemID] = prev
+			} else {
+				delete(pr.LastSubmit, problemID)
 			}
+		})
+		return nil, nil, err
+	}
+	sub.SubmissionID = job.ID
+	s.updatePending(ctx, g, userID, sub, func(pr *domain.RoomUserProgress) {
+		pr.LastSubmit[problemID] = sub
+	})
+
+	cp := sub
+	return g, &cp, nil
+}
+
+// updatePending applies fn to the user's progress as long as sub is still
+// their pending last submit for its problem, i.e. its result has not come
+// in and nothing was submitted since. Failures are only logged: the
+// submission itself is stored either way.
+func (s *RoomGameService) updatePending(ctx context.Context, g *domain.RoomGame, userID string, sub domain.RoomSubmission, fn func(pr *domain.RoomUserProgress)) {
+	pr, err := s.repo.UpdateProgress(ctx, g.ID, userID, func(pr *domain.RoomUserProgress) error {
+		if last, ok := pr.LastSubmit[sub.ProblemID]; ok && last.Pending && last.SubmittedAt.Equal(sub.SubmittedAt) {
+			fn(pr)
 		}
-	} else {
-		sub.Correct = strings.EqualFold(code, "CORRECT")
+		return nil
+	})
+	if err != nil {
+		log.Printf("[ROOM] failed to update pending submission for game %s: %v", g.ID, err)
+		return
 	}
+	g.Progress[userID] = *pr
+}
 
-	pr.LastSubmit[problemID] = sub
-	if sub.Correct {
-		pr.Solved[problemID] = true
+// RunSamples queues a samples-only run of code for a problem in the game. It
+// is not a submission: the game, the player's progress and the winner are
+// left untouched, and the result is polled like any judge job.
+func (s *RoomGameService) RunSamples(ctx context.Context, gameID, userID, problemID, code string) (*JudgeJob, error) {
+	gameID = strings.TrimSpace(gameID)
+	if gameID == "" {
+		return nil, fmt.Errorf("game id is required")
+	}
+	if userID == "" {
+		return nil, fmt.Errorf("user id is required")
+	}
+	problemID = strings.TrimSpace(problemID)
+	if problemID == "" {
+		return nil, fmt.Errorf("problem id is required")
+	}
+	if s.judge == nil {
+		return nil, fmt.Errorf("judge is disabled")
 	}
-	g.Progress[userID] = pr
 
-	if s.userSolvedAll(g, userID) {
-		g.Status = domain.RoomGameStatusFinished
-		now := time.Now().UTC()
-		g.FinishedAt = &now
-		g.WinnerUserID = userID
+	g, err := s.Get(ctx, gameID)
+	if err != nil {
+		return nil, err
+	}
+	if g.Status != domain.RoomGameStatusRunning {
+		return nil, fmt.Errorf("coding phase is over")
+	}
+	found := false
+	for _, p := range g.Problems {
+		if p.ID == problemID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("problem not in this room")
 	}
 
-	if err := s.repo.Update(ctx, g); err != nil {
-		return nil, nil, err
+	lang := JudgeLanguage(strings.ToLower(string(g.Language)))
+	return s.judge.Enqueue(ctx, problemID, lang, code, JudgeOptions{SamplesOnly: true, UserID: userID}, nil)
+}
+
+// applyJudgeResult records a queued submission's verdict once the judge is
+// done with it. The game is re-read because it may have moved on meanwhile;
+// a game that already finished is left alone.
+func (s *RoomGameService) applyJudgeResult(gameID, userID string, sub domain.RoomSubmission, jr *JudgeResult, jerr error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sub.SubmissionID = ""
+	sub.Pending = false
+	switch {
+	case jerr != nil:
+		sub.Verdict = domain.VerdictInternalError
+		sub.ErrorMessage = jerr.Error()
+	case jr != nil:
+		sub.Correct = jr.Passed
+		sub.Verdict = jr.Verdict
+		sub.Score = jr.Score
+		sub.MaxScore = jr.MaxScore
+		switch {
+		case jr.Verdict == domain.VerdictCompileError:
+			sub.ErrorMessage = jr.CompileError
+		case jr.Verdict == domain.VerdictPolicyViolation:
+			sub.ErrorMessage = strings.Join(jr.PolicyViolations, "; ")
+		case !jr.Passed:
+			sub.ErrorMessage = fmt.Sprintf("%s: %d/%d", jr.Verdict.Description(), jr.PassedCnt, jr.TotalCnt)
+		}
 	}
 
-	cp := sub
-	return g, &cp, nil
+	g, err := s.repo.Get(ctx, gameID)
+	if err != nil || g == nil || g.Status == domain.RoomGameStatusFinished {
+		return
+	}
+	if err := s.recordSubmission(ctx, g, userID, sub); err != nil {
+		log.Printf("[ROOM] failed to record submission for game %s: %v", gameID, err)
+	}
+}
+
+// recordSubmission credits sub to the user in a transaction on their
+// progress, so results of other submissions stored meanwhile are kept, and
+// ends the coding phase if that solved the last problem. g is updated with
+// what was stored.
+func (s *RoomGameService) recordSubmission(ctx context.Context, g *domain.RoomGame, userID string, sub domain.RoomSubmission) error {
+	pr, err := s.repo.UpdateProgress(ctx, g.ID, userID, func(pr *domain.RoomUserProgress) error {
+		creditSubmission(pr, userID, sub)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if g.Progress == nil {
+		g.Progress = map[string]domain.RoomUserProgress{}
+	}
+	g.Progress[userID] = *pr
+	if !sub.Correct || g.Status != domain.RoomGameStatusRunning || !s.userSolvedAll(g, userID) {
+		return nil
+	}
+	updated, err := s.repo.Transact(ctx, g.ID, func(cur *domain.RoomGame) error {
+		s.endCodingPhase(cur, userID)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	*g = *updated
+	return nil
+}
+
+// creditSubmission records sub in the user's progress. It becomes the last
+// submit for its problem unless a newer one is there already; it counts
+// towards solving the problem and its points either way.
+func creditSubmission(pr *domain.RoomUserProgress, userID string, sub domain.RoomSubmission) {
+	if pr.UserID == "" {
+		pr.UserID = userID
+		pr.DisplayName = sub.DisplayName
+	}
+	if pr.Solved == nil {
+		pr.Solved = map[string]bool{}
+	}
+	if pr.LastSubmit == nil {
+		pr.LastSubmit = map[string]domain.RoomSubmission{}
+	}
+	if pr.Accepted == nil {
+		pr.Accepted = map[string]domain.RoomSubmission{}
+	}
+	if pr.Points == nil {
+		pr.Points = map[string]int{}
+	}
+	if last, ok := pr.LastSubmit[sub.ProblemID]; !ok || !last.SubmittedAt.After(sub.SubmittedAt) {
+		pr.LastSubmit[sub.ProblemID] = sub
+	}
+	if sub.Correct {
+		pr.Solved[sub.ProblemID] = true
+		if prev, ok := pr.Accepted[sub.ProblemID]; !ok || !prev.SubmittedAt.After(sub.SubmittedAt) {
+			pr.Accepted[sub.ProblemID] = sub
+		}
+	}
+	if sub.Score > pr.Points[sub.ProblemID] {
+		pr.TotalPoints += sub.Score - pr.Points[sub.ProblemID]
+		pr.Points[sub.ProblemID] = sub.Score
+	}
+}
+
+// endCodingPhase ends the coding phase of g if userID solved everything in
+// it; results that arrive during the hack phase still count but do not end
+// it early.
+func (s *RoomGameService) endCodingPhase(g *domain.RoomGame, userID string) {
+	if g.Status == domain.RoomGameStatusRunning && s.userSolvedAll(g, userID) {
+		now := time.Now().UTC()
+		if g.HackPhaseMin > 0 {
+			g.Status = domain.RoomGameStatusHacking
+			g.HackEndsAt = now.Add(time.Duration(g.HackPhaseMin) * time.Minute)
+		} else {
+			s.finish(g, now, userID)
+		}
+	}
 }
 
 func (s *RoomGameService) userSolvedAll(g *domain.RoomGame, userID string) bool {
@@ -275,27 +449,31 @@ func (s *RoomGameService) userSolvedAll(g *domain.RoomGame, userID string) bool
 	return true
 }
 
-func (s *RoomGameService) winnerByMostSolved(g *domain.RoomGame) string {
+// leader returns the user ranked first by the game's ranking: most problems
+// solved, or most points, with the other measure breaking ties. It is empty
+// while nobody has scored.
+func (s *RoomGameService) leader(g *domain.RoomGame) string {
 	if g == nil {
 		return ""
 	}
 	bestID := ""
-	bestCnt := -1
+	bestPrimary, bestSecondary := 0, 0
 	for uid, pr := range g.Progress {
-		cnt := 0
+		solved := 0
 		for _, p := range g.Problems {
 			if p.ID != "" && pr.Solved != nil && pr.Solved[p.ID] {
-				cnt++
+				solved++
 			}
 		}
-		if cnt > bestCnt {
-			bestCnt = cnt
+		primary, secondary := solved, pr.TotalPoints
+		if g.Ranking == domain.RoomRankingPoints {
+			primary, secondary = pr.TotalPoints, solved
+		}
+		if primary > bestPrimary || (primary == bestPrimary && primary > 0 && secondary > bestSecondary) {
 			bestID = uid
+			bestPrimary, bestSecondary = primary, secondary
 		}
 	}
-	if bestCnt <= 0 {
-		return ""
-	}
 	return bestID
 }
 
@@ -304,16 +482,68 @@ func (s *RoomGameService) Get(ctx context.Context, gameID string) (*domain.RoomG
 	if err != nil {
 		return nil, err
 	}
-	if g.Status == domain.RoomGameStatusRunning && !g.EndsAt.IsZero() && time.Now().UTC().After(g.EndsAt) {
-		now := time.Now().UTC()
-		g.Status = domain.RoomGameStatusFinished
-		g.FinishedAt = &now
-		g.WinnerUserID = s.winnerByMostSolved(g)
+	if s.advancePhase(g, time.Now().UTC()) {
 		_ = s.repo.Update(ctx, g)
 	}
 	return g, nil
 }
 
+// advancePhase moves a game whose coding time ran out on to its hack phase,
+// and finishes one whose last phase is over. It reports whether g changed.
+func (s *RoomGameService) advancePhase(g *domain.RoomGame, now time.Time) bool {
+	changed := false
+	if g.Status == domain.RoomGameStatusRunning && !g.EndsAt.IsZero() && now.After(g.EndsAt) {
+		if g.HackPhaseMin > 0 {
+			g.Status = domain.RoomGameStatusHacking
+			g.HackEndsAt = g.EndsAt.Add(time.Duration(g.HackPhaseMin) * time.Minute)
+		} else {
+			s.finish(g, now, s.leader(g))
+		}
+		changed = true
+	}
+	if g.Status == domain.RoomGameStatusHacking && now.After(g.HackEndsAt) {
+		s.finish(g, now, s.leader(g))
+		changed = true
+	}
+	return changed
+}
+
+func (s *RoomGameService) finish(g *domain.RoomGame, now time.Time, winnerUserID string) {
+	g.Status = domain.RoomGameStatusFinished
+	g.FinishedAt = &now
+	g.WinnerUserID = winnerUserID
+}
+
+// RedactRoomGameForViewer hides the opponents' code from a game view; during
+// the hack phase it is only shown through HackTargets.
+func RedactRoomGameForViewer(g *domain.RoomGame, viewerUserID string) *domain.RoomGame {
+	if g == nil {
+		return nil
+	}
+	cp := *g
+	cp.Progress = make(map[string]domain.RoomUserProgress, len(g.Progress))
+	for uid, pr := range g.Progress {
+		if uid != viewerUserID {
+			pr.LastSubmit = redactSubmissions(pr.LastSubmit)
+			pr.Accepted = redactSubmissions(pr.Accepted)
+		}
+		cp.Progress[uid] = pr
+	}
+	return &cp
+}
+
+func redactSubmissions(in map[string]domain.RoomSubmission) map[string]domain.RoomSubmission {
+	if in == nil {
+		return nil
+	}
+	out := make(map[string]domain.RoomSubmission, len(in))
+	for k, sub := range in {
+		sub.Code = ""
+		out[k] = sub
+	}
+	return out
+}
+
 func (s *RoomGameService) Delete(ctx context.Context, gameID string) error {
 	gameID = strings.TrimSpace(gameID)
 	if gameID == "" {
@@ -0,0 +1,258 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/AQADIL/JudGO/internal/domain"
+)
+
+const (
+	maxHackPhaseMin = 60
+	// hackReward is added to the hacker's points for a successful hack and
+	// hackPenalty taken off for an unsuccessful one.
+	hackReward  = 50
+	hackPenalty = 25
+)
+
+// HackTargets returns the opponents' accepted solutions of problemID that
+// userID may hack. Only players who solved the problem themselves get to see
+// them, and only during the hack phase.
+func (s *RoomGameService) HackTargets(ctx context.Context, gameID, userID, problemID string) ([]domain.RoomSubmission, error) {
+	g, err := s.hackableGame(ctx, gameID, userID, problemID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]domain.RoomSubmission, 0)
+	for uid, pr := range g.Progress {
+		if uid == userID || !pr.Solved[problemID] {
+			continue
+		}
+		if sub, ok := pr.Accepted[problemID]; ok {
+			out = append(out, sub)
+		}
+	}
+	return out, nil
+}
+
+// Hack challenges targetID's accepted solution of problemID with input. The
+// hack waits in the judge queue and shows up in the game's hacks; a solution
+// can only be under one hack at a time.
+func (s *RoomGameService) Hack(ctx context.Context, gameID, userID, targetID, problemID, input string) (*domain.RoomHack, error) {
+	if s.judge == nil {
+		return nil, fmt.Errorf("judge is disabled")
+	}
+	if s.judge.RemoteWorkers() {
+		return nil, fmt.Errorf("hacks are disabled while judging on remote workers")
+	}
+	targetID = strings.TrimSpace(targetID)
+	if targetID == "" {
+		return nil, fmt.Errorf("target user id is required")
+	}
+	if targetID == userID {
+		return nil, fmt.Errorf("you cannot hack your own solution")
+	}
+	if strings.TrimSpace(input) == "" {
+		return nil, fmt.Errorf("input is required")
+	}
+	if len(input) > maxChallengeInputBytes {
+		return nil, fmt.Errorf("input is larger than %d KB", maxChallengeInputBytes>>10)
+	}
+	g, err := s.hackableGame(ctx, gameID, userID, problemID)
+	if err != nil {
+		return nil, err
+	}
+	p, err := s.judge.problems.GetAdmin(ctx, problemID)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil || p.Validator == nil {
+		return nil, fmt.Errorf("this problem cannot be hacked: it has no input validator")
+	}
+
+	hack := domain.RoomHack{
+		ID:        uuid.NewString(),
+		HackerID:  userID,
+		TargetID:  targetID,
+		ProblemID: problemID,
+		Input:     input,
+		Status:    domain.RoomHackStatusPending,
+		CreatedAt: time.Now().UTC(),
+	}
+	// The target's solution and the pending hacks are checked again in the
+	// transaction that stores the hack, so two hacks cannot both pass.
+	var sub domain.RoomSubmission
+	g, err = s.repo.Transact(ctx, g.ID, func(g *domain.RoomGame) error {
+		if g.Status != domain.RoomGameStatusHacking {
+			return fmt.Errorf("game is not in its hack phase")
+		}
+		if !g.Progress[userID].Solved[problemID] {
+			return fmt.Errorf("only players who solved this problem can hack it")
+		}
+		target, ok := g.Progress[targetID]
+		if !ok || !target.Solved[problemID] {
+			return fmt.Errorf("target has not solved this problem")
+		}
+		if sub, ok = target.Accepted[problemID]; !ok {
+			return fmt.Errorf("target has no accepted solution to hack")
+		}
+		for _, h := range g.Hacks {
+			if h.Status == domain.RoomHackStatusPending && h.TargetID == targetID && h.ProblemID == problemID {
+				return fmt.Errorf("this solution is already being hacked")
+			}
+		}
+		if g.Hacks == nil {
+			g.Hacks = map[string]domain.RoomHack{}
+		}
+		g.Hacks[hack.ID] = hack
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	lang := JudgeLanguage(strings.ToLower(string(g.Language)))
+	err = s.judge.Challenge(ctx, problemID, lang, sub.Code, input, func(res *ChallengeResult, err error) {
+		s.recordHack(g.ID, hack, res, err)
+	})
+	if err != nil {
+		s.dropPendingHack(g.ID, hack.ID)
+		return nil, err
+	}
+	return &hack, nil
+}
+
+// dropPendingHack takes back a hack that could not be queued.
+func (s *RoomGameService) dropPendingHack(gameID, hackID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := s.repo.Transact(ctx, gameID, func(g *domain.RoomGame) error {
+		if cur, ok := g.Hacks[hackID]; ok && cur.Status == domain.RoomHackStatusPending {
+			delete(g.Hacks, hackID)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("[ROOM] failed to drop hack %s for game %s: %v", hackID, gameID, err)
+	}
+}
+
+// hackableGame loads a game in its hack phase and checks that userID solved
+// problemID, which is what entitles them to hack it.
+func (s *RoomGameService) hackableGame(ctx context.Context, gameID, userID, problemID string) (*domain.RoomGame, error) {
+	gameID = strings.TrimSpace(gameID)
+	if gameID == "" {
+		return nil, fmt.Errorf("game id is required")
+	}
+	if userID == "" {
+		return nil, fmt.Errorf("user id is required")
+	}
+	problemID = strings.TrimSpace(problemID)
+	if problemID == "" {
+		return nil, fmt.Errorf("problem id is required")
+	}
+	g, err := s.Get(ctx, gameID)
+	if err != nil {
+		return nil, err
+	}
+	if g.Status != domain.RoomGameStatusHacking {
+		return nil, fmt.Errorf("game is not in its hack phase")
+	}
+	found := false
+	for _, p := range g.Problems {
+		if p.ID == problemID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("problem not in this room")
+	}
+	if !g.Progress[userID].Solved[problemID] {
+		return nil, fmt.Errorf("only players who solved this problem can hack it")
+	}
+	return g, nil
+}
+
+// recordHack records the outcome of judging the target's code on the hack
+// input. Like a submission's result, it is dropped if the game finished
+// meanwhile.
+func (s *RoomGameService) recordHack(gameID string, hack domain.RoomHack, res *ChallengeResult, err error) {
+	switch {
+	case err != nil:
+		hack.Status = domain.RoomHackStatusError
+		hack.Message = err.Error()
+	case !res.ValidInput:
+		hack.Status = domain.RoomHackStatusInvalid
+		hack.Message = res.Message
+	case res.Verdict == domain.VerdictAccepted:
+		hack.Status = domain.RoomHackStatusUnsuccessful
+		hack.TargetVerdict = res.Verdict
+		hack.Points = -hackPenalty
+	case res.Verdict == domain.VerdictInternalError:
+		hack.Status = domain.RoomHackStatusError
+		hack.Message = res.Message
+	default:
+		hack.Status = domain.RoomHackStatusSuccessful
+		hack.TargetVerdict = res.Verdict
+		hack.Message = res.Message
+		hack.Points = hackReward
+	}
+	now := time.Now().UTC()
+	hack.JudgedAt = &now
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err = s.repo.Transact(ctx, gameID, func(g *domain.RoomGame) error {
+		if g.Status == domain.RoomGameStatusFinished {
+			return nil
+		}
+		if cur, ok := g.Hacks[hack.ID]; !ok || cur.Status != domain.RoomHackStatusPending {
+			return nil
+		}
+		judged := hack
+		s.applyHack(g, &judged)
+		g.Hacks[hack.ID] = judged
+		return nil
+	})
+	if err != nil {
+		log.Printf("[ROOM] failed to record hack for game %s: %v", gameID, err)
+	}
+}
+
+// applyHack scores a judged hack. A successful one takes the problem and its
+// points away from the target; if the target already lost the solve, the
+// hack is still recorded but earns nothing.
+func (s *RoomGameService) applyHack(g *domain.RoomGame, hack *domain.RoomHack) {
+	if hack.Status == domain.RoomHackStatusSuccessful {
+		target := g.Progress[hack.TargetID]
+		if !target.Solved[hack.ProblemID] {
+			hack.Points = 0
+			return
+		}
+		hacked := target.Accepted[hack.ProblemID]
+		delete(target.Solved, hack.ProblemID)
+		delete(target.Accepted, hack.ProblemID)
+		target.TotalPoints -= target.Points[hack.ProblemID]
+		delete(target.Points, hack.ProblemID)
+		if last, ok := target.LastSubmit[hack.ProblemID]; ok && last.SubmittedAt.Equal(hacked.SubmittedAt) {
+			last.Correct = false
+			last.Verdict = hack.TargetVerdict
+			last.Score = 0
+			last.ErrorMessage = "hacked"
+			target.LastSubmit[hack.ProblemID] = last
+		}
+		g.Progress[hack.TargetID] = target
+	}
+	if hack.Points != 0 {
+		hacker := g.Progress[hack.HackerID]
+		hacker.HackPoints += hack.Points
+		hacker.TotalPoints += hack.Points
+		g.Progress[hack.HackerID] = hacker
+	}
+}
@@ -50,6 +50,16 @@ func (s *RoomService) CreateRoom(ctx context.Context, ownerUserID, ownerDisplayN
 	if settings.Difficulty == "" {
 		settings.Difficulty = domain.RoomDifficultyEasy
 	}
+	switch settings.Ranking {
+	case "":
+		settings.Ranking = domain.RoomRankingSolved
+	case domain.RoomRankingSolved, domain.RoomRankingPoints:
+	default:
+		return nil, fmt.Errorf("unknown ranking: %s", settings.Ranking)
+	}
+	if settings.HackPhaseMin < 0 || settings.HackPhaseMin > maxHackPhaseMin {
+		return nil, fmt.Errorf("hackPhaseMin must be between 0 and %d", maxHackPhaseMin)
+	}
 	if len(settings.TaskDifficulties) == 0 {
 		settings.TaskDifficulties = make([]domain.RoomDifficulty, settings.TaskCount)
 		for i := 0; i < settings.TaskCount; i++ {
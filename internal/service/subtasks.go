@@ -0,0 +1,93 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/AQADIL/JudGO/internal/domain"
+)
+
+// fullScore is what a problem without subtasks is worth.
+const fullScore = 100
+
+type SubtaskResult struct {
+	Index  int    `json:"index"`
+	Name   string `json:"name,omitempty"`
+	Points int    `json:"points"`
+	Earned int    `json:"earned"`
+	Passed bool   `json:"passed"`
+}
+
+// maxScore is the number of points a problem is worth.
+func maxScore(p *domain.Problem) int {
+	if len(p.Subtasks) == 0 {
+		return fullScore
+	}
+	total := 0
+	for _, st := range p.Subtasks {
+		total += st.Points
+	}
+	return total
+}
+
+// scoreSubtasks fills in the score of a finished judge result.
+func scoreSubtasks(p *domain.Problem, res *JudgeResult) {
+	if len(p.Subtasks) == 0 {
+		if res.Passed {
+			res.Score = fullScore
+		}
+		return
+	}
+	passed := make(map[int]bool, len(res.Results))
+	for _, tr := range res.Results {
+		passed[tr.Index] = tr.Passed
+	}
+	res.Subtasks = make([]SubtaskResult, 0, len(p.Subtasks))
+	for i, st := range p.Subtasks {
+		ok := true
+		for _, t := range st.Tests {
+			if !passed[t] {
+				ok = false
+				break
+			}
+		}
+		// Dependencies are earlier subtasks, so they are already scored.
+		for _, d := range st.DependsOn {
+			if !res.Subtasks[d].Passed {
+				ok = false
+			}
+		}
+		sr := SubtaskResult{Index: i, Name: st.Name, Points: st.Points, Passed: ok}
+		if ok {
+			sr.Earned = st.Points
+			res.Score += st.Points
+		}
+		res.Subtasks = append(res.Subtasks, sr)
+	}
+}
+
+func validateSubtasks(p *domain.Problem) error {
+	// Generated tests replace the hand-written ones, so subtasks index them.
+	tests := len(p.TestCases)
+	if len(p.GeneratorTests) > 0 {
+		tests = len(p.GeneratorTests)
+	}
+	for i, st := range p.Subtasks {
+		if st.Points < 0 {
+			return fmt.Errorf("subtask %d: points must not be negative", i)
+		}
+		if len(st.Tests) == 0 {
+			return fmt.Errorf("subtask %d: tests are required", i)
+		}
+		for _, t := range st.Tests {
+			if t < 0 || t >= tests {
+				return fmt.Errorf("subtask %d: test %d does not exist", i, t)
+			}
+		}
+		for _, d := range st.DependsOn {
+			if d < 0 || d >= i {
+				return fmt.Errorf("subtask %d: can only depend on earlier subtasks", i)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AQADIL/JudGO/internal/domain"
+)
+
+func TestScoreSubtasks(t *testing.T) {
+	// Tests 0-1 are the samples, 2-3 small inputs and 4-5 large ones.
+	subtasks := []domain.ProblemSubtask{
+		{Name: "samples", Points: 0, Tests: []int{0, 1}},
+		{Name: "small", Points: 30, Tests: []int{2, 3}},
+		{Name: "large", Points: 70, Tests: []int{1, 4, 5}, DependsOn: []int{1}},
+	}
+	tests := []struct {
+		name     string
+		subtasks []domain.ProblemSubtask
+		failed   []int
+		score    int
+		passed   []bool
+	}{
+		{"all pass", subtasks, nil, 100, []bool{true, true, true}},
+		{"large fails", subtasks, []int{5}, 30, []bool{true, true, false}},
+		{"dependency fails", subtasks, []int{3}, 0, []bool{true, false, false}},
+		{"shared test fails", subtasks, []int{1}, 30, []bool{false, true, false}},
+		{"no subtasks, passed", nil, nil, fullScore, nil},
+		{"no subtasks, failed", nil, []int{2}, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &domain.Problem{Subtasks: tt.subtasks}
+			res := &JudgeResult{Passed: len(tt.failed) == 0}
+			for i := 0; i < 6; i++ {
+				res.Results = append(res.Results, TestcaseResult{Index: i, Passed: true})
+			}
+			for _, i := range tt.failed {
+				res.Results[i].Passed = false
+			}
+			scoreSubtasks(p, res)
+			if res.Score != tt.score {
+				t.Fatalf("score %d, want %d", res.Score, tt.score)
+			}
+			if len(res.Subtasks) != len(tt.passed) {
+				t.Fatalf("%d subtask results, want %d", len(res.Subtasks), len(tt.passed))
+			}
+			for i, sr := range res.Subtasks {
+				earned := 0
+				if tt.passed[i] {
+					earned = sr.Points
+				}
+				if sr.Passed != tt.passed[i] || sr.Earned != earned {
+					t.Fatalf("subtask %d: passed %v, earned %d; want %v", i, sr.Passed, sr.Earned, tt.passed[i])
+				}
+			}
+		})
+	}
+}
+
+func TestScoreSubtasksSkippedTests(t *testing.T) {
+	// A test that never ran, e.g. after stopping early, does not count as
+	// passed.
+	p := &domain.Problem{Subtasks: []domain.ProblemSubtask{{Points: 10, Tests: []int{0}}, {Points: 20, Tests: []int{1}}}}
+	res := &JudgeResult{Results: []TestcaseResult{{Index: 0, Passed: true}}}
+	scoreSubtasks(p, res)
+	if res.Score != 10 {
+		t.Fatalf("score %d, want 10", res.Score)
+	}
+}
+
+func TestValidateSubtasks(t *testing.T) {
+	tests := []struct {
+		name     string
+		subtasks []domain.ProblemSubtask
+		gen      int
+		wantErr  string
+	}{
+		{"valid", []domain.ProblemSubtask{{Points: 40, Tests: []int{0}}, {Points: 60, Tests: []int{1, 2}, DependsOn: []int{0}}}, 0, ""},
+		{"negative points", []domain.ProblemSubtask{{Points: -1, Tests: []int{0}}}, 0, "negative"},
+		{"no tests", []domain.ProblemSubtask{{Points: 10}}, 0, "tests are required"},
+		{"test out of range", []domain.ProblemSubtask{{Points: 10, Tests: []int{3}}}, 0, "does not exist"},
+		{"negative test", []domain.ProblemSubtask{{Points: 10, Tests: []int{-1}}}, 0, "does not exist"},
+		{"depends on itself", []domain.ProblemSubtask{{Points: 10, Tests: []int{0}, DependsOn: []int{0}}}, 0, "earlier subtasks"},
+		{"depends on later", []domain.ProblemSubtask{{Points: 10, Tests: []int{0}, DependsOn: []int{1}}, {Points: 10, Tests: []int{1}}}, 0, "earlier subtasks"},
+		{"indexes generated tests", []domain.ProblemSubtask{{Points: 10, Tests: []int{4}}}, 5, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &domain.Problem{Subtasks: tt.subtasks, TestCases: make([]domain.ProblemTestCase, 3)}
+			p.GeneratorTests = make([]domain.ProblemGeneratorTest, tt.gen)
+			err := validateSubtasks(p)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
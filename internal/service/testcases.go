@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/AQADIL/JudGO/internal/domain"
+)
+
+const defaultTestcaseParallelism = 4
+
+// runTestcases runs the testcases through run, at most s.testParallelism of
+// them at once and each holding one of the host-wide sandbox slots, and
+// returns the results in testcase order. With stopEarly no testcase after the
+// first failing one is started and the results end at that failure, so the
+// outcome does not depend on which runs happened to finish first.
+func (s *JudgeService) runTestcases(ctx context.Context, tcs []domain.ProblemTestCase, stopEarly bool, run func(int, domain.ProblemTestCase) TestcaseResult) []TestcaseResult {
+	n := len(tcs)
+	results := make([]TestcaseResult, n)
+	next := int64(-1)
+	firstFail := int64(n)
+
+	workers := s.testParallelism
+	if workers > n {
+		workers = n
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= n {
+					return
+				}
+				// Indices are handed out in order, so once one is past the
+				// first failure every later one is too.
+				if stopEarly && int64(i) > atomic.LoadInt64(&firstFail) {
+					return
+				}
+				if err := s.acquireSandbox(ctx); err != nil {
+					results[i] = TestcaseResult{
+						Index:   i,
+						Verdict: domain.VerdictInternalError,
+						Hidden:  tcs[i].IsHidden,
+						Error:   "internal error: " + err.Error(),
+					}
+				} else {
+					results[i] = run(i, tcs[i])
+					s.releaseSandbox()
+				}
+				if !results[i].Passed {
+					for {
+						cur := atomic.LoadInt64(&firstFail)
+						if int64(i) >= cur || atomic.CompareAndSwapInt64(&firstFail, cur, int64(i)) {
+							break
+						}
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if stopEarly && firstFail < int64(n) {
+		return results[:firstFail+1]
+	}
+	return results
+}
+
+// acquireSandbox waits for one of the sandbox slots shared by every judge.
+func (s *JudgeService) acquireSandbox(ctx context.Context) error {
+	select {
+	case s.sandboxSlots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *JudgeService) releaseSandbox() {
+	<-s.sandboxSlots
+}
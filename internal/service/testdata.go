@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/AQADIL/JudGO/internal/domain"
+)
+
+// TestDataStore keeps testcase data out of the problem documents, which then
+// only carry checksums. Data is addressed by problem, test data version and
+// SHA-256 checksum; a version is written once and then only read.
+type TestDataStore interface {
+	// Put stores r under problemID and version and returns its checksum and
+	// size.
+	Put(ctx context.Context, problemID, version string, r io.Reader) (string, int64, error)
+	// Open streams stored data; the caller closes it. Stores backed by files
+	// return an *os.File, which the sandbox hands to a program as is.
+	Open(ctx context.Context, problemID, version, checksum string) (io.ReadCloser, error)
+	// Prune removes the versions of problemID other than keep.
+	Prune(ctx context.Context, problemID string, keep ...string) error
+}
+
+// storeTestData moves p's testcase data into the store, if there is one. A
+// test whose inline data matches the checksum it already has is unchanged;
+// if every test is, p keeps its version. Otherwise all tests are written to
+// a new version, unchanged ones copied from the old. It returns the version
+// p had before, which stays in the store next to the new one so judges still
+// running on it can finish.
+func (s *ProblemService) storeTestData(ctx context.Context, p *domain.Problem) (string, error) {
+	old := p.TestDataVersion
+	if s.testData == nil {
+		return old, nil
+	}
+	changed := old == ""
+	for _, tc := range p.TestCases {
+		if testDataChanged(tc.Input, tc.InputSHA256) || testDataChanged(tc.Output, tc.OutputSHA256) {
+			changed = true
+			break
+		}
+	}
+	if changed {
+		version := uuid.NewString()
+		for i := range p.TestCases {
+			tc := &p.TestCases[i]
+			var err error
+			if tc.InputSHA256, tc.InputBytes, err = s.putTestData(ctx, p.ID, old, version, tc.Input, tc.InputSHA256); err != nil {
+				return old, fmt.Errorf("failed to store input of test %d: %w", i+1, err)
+			}
+			if tc.OutputSHA256, tc.OutputBytes, err = s.putTestData(ctx, p.ID, old, version, tc.Output, tc.OutputSHA256); err != nil {
+				return old, fmt.Errorf("failed to store output of test %d: %w", i+1, err)
+			}
+		}
+		p.TestDataVersion = version
+	}
+	for i := range p.TestCases {
+		if p.TestCases[i].IsHidden {
+			p.TestCases[i].Input, p.TestCases[i].Output = "", ""
+		}
+	}
+	return old, nil
+}
+
+// testDataChanged reports whether inline data has to be stored anew rather
+// than referenced by checksum.
+func testDataChanged(inline, checksum string) bool {
+	if checksum == "" {
+		return true
+	}
+	if inline == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(inline))
+	return hex.EncodeToString(sum[:]) != checksum
+}
+
+// putTestData stores one side of a test under version: its inline data, or
+// the data stored under from when it only has a checksum.
+func (s *ProblemService) putTestData(ctx context.Context, problemID, from, version, inline, checksum string) (string, int64, error) {
+	if checksum == "" || inline != "" {
+		return s.testData.Put(ctx, problemID, version, strings.NewReader(inline))
+	}
+	if from == "" {
+		return "", 0, fmt.Errorf("test data %s has no version", checksum)
+	}
+	rc, err := s.testData.Open(ctx, problemID, from, checksum)
+	if err != nil {
+		return "", 0, err
+	}
+	defer rc.Close()
+	return s.testData.Put(ctx, problemID, version, rc)
+}
+
+// pruneTestData drops the versions of p older than prev once p is saved,
+// except those a judge still holds. Those are left for a later update to
+// prune.
+func (s *ProblemService) pruneTestData(ctx context.Context, p *domain.Problem, prev string) {
+	if s.testData == nil || p.TestDataVersion == "" {
+		return
+	}
+	keep := []string{p.TestDataVersion}
+	if prev != "" {
+		keep = append(keep, prev)
+	}
+	keep = append(keep, s.held.versions(p.ID)...)
+	if err := s.testData.Prune(ctx, p.ID, keep...); err != nil {
+		log.Printf("[PROBLEM] failed to prune test data of %s: %v", p.ID, err)
+	}
+}
+
+// testDataHolds counts the judges reading each version of a problem's test
+// data, from loading the problem until the submission is judged.
+type testDataHolds struct {
+	mu sync.Mutex
+	// holds maps a problem ID to its held versions and their holders.
+	holds map[string]map[string]int
+}
+
+// holdTestData keeps p's test data version from being pruned until the returned
+// release is called. Release can be called more than once.
+func (s *ProblemService) holdTestData(p *domain.Problem) func() {
+	if s.testData == nil || p.TestDataVersion == "" {
+		return func() {}
+	}
+	id, version := p.ID, p.TestDataVersion
+	h := &s.held
+	h.mu.Lock()
+	if h.holds == nil {
+		h.holds = map[string]map[string]int{}
+	}
+	if h.holds[id] == nil {
+		h.holds[id] = map[string]int{}
+	}
+	h.holds[id][version]++
+	h.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			if h.holds[id][version]--; h.holds[id][version] == 0 {
+				delete(h.holds[id], version)
+				if len(h.holds[id]) == 0 {
+					delete(h.holds, id)
+				}
+			}
+		})
+	}
+}
+
+// versions lists the held versions of a problem's test data.
+func (h *testDataHolds) versions(problemID string) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]string, 0, len(h.holds[problemID]))
+	for v := range h.holds[problemID] {
+		out = append(out, v)
+	}
+	return out
+}
+
+// SetTestDataStore lets a judge without a problem service, such as a remote
+// worker's, read the test data its jobs reference.
+func (s *JudgeService) SetTestDataStore(store TestDataStore) {
+	s.testData = store
+}
+
+// openTestData streams one side of a test of p: its inline data, or what
+// the store holds under its checksum.
+func (s *JudgeService) openTestData(ctx context.Context, p *domain.Problem, inline, checksum string) (io.ReadCloser, error) {
+	if checksum == "" || inline != "" {
+		return io.NopCloser(strings.NewReader(inline)), nil
+	}
+	if s.testData == nil {
+		return nil, fmt.Errorf("internal error: test data store is not configured")
+	}
+	rc, err := s.testData.Open(ctx, p.ID, p.TestDataVersion, checksum)
+	if err != nil {
+		return nil, fmt.Errorf("internal error: test data: %v", err)
+	}
+	return rc, nil
+}
+
+// readTestData is openTestData for data that is needed whole, such as an
+// expected output to show.
+func (s *JudgeService) readTestData(ctx context.Context, p *domain.Problem, inline, checksum string) (string, error) {
+	rc, err := s.openTestData(ctx, p, inline, checksum)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		return "", fmt.Errorf("internal error: test data: %v", err)
+	}
+	return string(b), nil
+}
+
+// matchOutput compares normalized output with the expected output of tc,
+// streaming the expected side.
+func (s *JudgeService) matchOutput(ctx context.Context, p *domain.Problem, tc domain.ProblemTestCase, output string) (bool, error) {
+	rc, err := s.openTestData(ctx, p, tc.Output, tc.OutputSHA256)
+	if err != nil {
+		return false, err
+	}
+	defer rc.Close()
+	match, err := outputMatches(output, rc)
+	if err != nil {
+		return false, fmt.Errorf("internal error: test data: %v", err)
+	}
+	return match, nil
+}
+
+// OpenTestData serves stored test data to remote workers.
+func (s *JudgeService) OpenTestData(ctx context.Context, problemID, version, checksum string) (io.ReadCloser, error) {
+	if s.testData == nil {
+		return nil, fmt.Errorf("test data store is not configured")
+	}
+	return s.testData.Open(ctx, problemID, version, checksum)
+}
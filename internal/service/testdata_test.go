@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"testing"
+
+	"github.com/AQADIL/JudGO/internal/domain"
+	"github.com/AQADIL/JudGO/internal/repository/filestore"
+)
+
+type memProblemRepo struct{ p map[string]*domain.Problem }
+
+func (r *memProblemRepo) Create(ctx context.Context, p *domain.Problem) error {
+	cp := *p
+	cp.TestCases = append([]domain.ProblemTestCase(nil), p.TestCases...)
+	r.p[p.ID] = &cp
+	return nil
+}
+
+func (r *memProblemRepo) Get(ctx context.Context, id string) (*domain.Problem, error) {
+	if p, ok := r.p[id]; ok {
+		cp := *p
+		cp.TestCases = append([]domain.ProblemTestCase(nil), p.TestCases...)
+		return &cp, nil
+	}
+	return nil, nil
+}
+
+func (r *memProblemRepo) List(ctx context.Context) ([]*domain.Problem, error) {
+	return nil, nil
+}
+
+// countingStore counts the writes made to a file store.
+type countingStore struct {
+	*filestore.FileTestDataStore
+	puts int
+}
+
+func (s *countingStore) Put(ctx context.Context, problemID, version string, r io.Reader) (string, int64, error) {
+	s.puts++
+	return s.FileTestDataStore.Put(ctx, problemID, version, r)
+}
+
+func sha(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func newTestDataService(t *testing.T) (*ProblemService, *JudgeService, *countingStore) {
+	t.Helper()
+	fs, err := filestore.NewFileTestDataStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &countingStore{FileTestDataStore: fs}
+	problems := NewProblemService(&memProblemRepo{p: map[string]*domain.Problem{}}, store)
+	return problems, &JudgeService{testData: store}, store
+}
+
+func readAll(t *testing.T, js *JudgeService, p *domain.Problem, inline, checksum string) string {
+	t.Helper()
+	got, err := js.readTestData(context.Background(), p, inline, checksum)
+	if err != nil {
+		t.Fatalf("read test data: %v", err)
+	}
+	return got
+}
+
+func TestStoreTestDataRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	problems, js, store := newTestDataService(t)
+
+	p, err := problems.Create(ctx, &domain.Problem{ID: "sum", Title: "Sum", TestCases: []domain.ProblemTestCase{
+		{Input: "1 2\n", Output: "3\n"},
+		{Input: "5 7\n", Output: "12", IsHidden: true},
+	}})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if p.TestDataVersion == "" {
+		t.Fatal("no test data version")
+	}
+	if store.puts != 4 {
+		t.Fatalf("%d puts, want 4", store.puts)
+	}
+
+	// Data is stored the way normalizeProblem leaves it, trimmed.
+	tests := []struct {
+		name       string
+		tc         domain.ProblemTestCase
+		input      string
+		output     string
+		keepInline bool
+	}{
+		{"visible", p.TestCases[0], "1 2", "3", true},
+		{"hidden", p.TestCases[1], "5 7", "12", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := tt.tc
+			if tc.InputSHA256 != sha(tt.input) || tc.OutputSHA256 != sha(tt.output) {
+				t.Fatalf("checksums %s %s", tc.InputSHA256, tc.OutputSHA256)
+			}
+			if tc.InputBytes != int64(len(tt.input)) || tc.OutputBytes != int64(len(tt.output)) {
+				t.Fatalf("sizes %d %d", tc.InputBytes, tc.OutputBytes)
+			}
+			if hasInline := tc.Input != "" || tc.Output != ""; hasInline != tt.keepInline {
+				t.Fatalf("inline data kept = %v, want %v", hasInline, tt.keepInline)
+			}
+			// Read from the store, not the inline copy.
+			if got := readAll(t, js, p, "", tc.InputSHA256); got != tt.input {
+				t.Fatalf("input %q, want %q", got, tt.input)
+			}
+			if got := readAll(t, js, p, "", tc.OutputSHA256); got != tt.output {
+				t.Fatalf("output %q, want %q", got, tt.output)
+			}
+			match, err := js.matchOutput(ctx, p, tc, normalizeOutput(tt.output))
+			if err != nil || !match {
+				t.Fatalf("matchOutput = %v, %v", match, err)
+			}
+		})
+	}
+}
+
+func TestStoreTestDataUnchangedChecksum(t *testing.T) {
+	ctx := context.Background()
+	problems, js, store := newTestDataService(t)
+
+	p, err := problems.Create(ctx, &domain.Problem{ID: "sum", Title: "Sum", TestCases: []domain.ProblemTestCase{
+		{Input: "1 2\n", Output: "3\n"},
+		{Input: "5 7\n", Output: "12", IsHidden: true},
+	}})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	v1 := p.TestDataVersion
+
+	// Saving the problem as it was read back, hidden data only as
+	// checksums, writes nothing and keeps the version.
+	store.puts = 0
+	same, err := problems.Create(ctx, p)
+	if err != nil {
+		t.Fatalf("save unchanged: %v", err)
+	}
+	if same.TestDataVersion != v1 || store.puts != 0 {
+		t.Fatalf("unchanged save: version %s (was %s), %d puts", same.TestDataVersion, v1, store.puts)
+	}
+
+	// Changing the visible test writes a new version; the hidden one is
+	// copied over from the old by checksum.
+	same.TestCases[0].Output = "4"
+	v2p, err := problems.Create(ctx, same)
+	if err != nil {
+		t.Fatalf("save changed: %v", err)
+	}
+	v2 := v2p.TestDataVersion
+	if v2 == v1 {
+		t.Fatal("changed test kept the version")
+	}
+	if got := readAll(t, js, v2p, "", v2p.TestCases[1].OutputSHA256); got != "12" {
+		t.Fatalf("copied hidden output %q", got)
+	}
+
+	// The previous version stays for judges that loaded it before the
+	// update; a version a judge holds outlives later updates too.
+	old := &domain.Problem{ID: "sum", TestDataVersion: v1}
+	hidden := p.TestCases[1].OutputSHA256
+	release := problems.holdTestData(old)
+	for i, out := range []string{"5", "6"} {
+		v2p.TestCases[0].Output = out
+		if v2p, err = problems.Create(ctx, v2p); err != nil {
+			t.Fatalf("update %d: %v", i, err)
+		}
+	}
+	if got := readAll(t, js, old, "", hidden); got != "12" {
+		t.Fatalf("held version: %q", got)
+	}
+	release()
+	release()
+	v2p.TestCases[0].Output = "3"
+	if v2p, err = problems.Create(ctx, v2p); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if _, err := js.readTestData(ctx, old, "", hidden); err == nil {
+		t.Fatal("released version was not pruned")
+	}
+	if got := readAll(t, js, v2p, "", hidden); got != "12" {
+		t.Fatalf("current version: %q", got)
+	}
+}
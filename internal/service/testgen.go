@@ -0,0 +1,290 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/AQADIL/JudGO/internal/domain"
+	"github.com/AQADIL/JudGO/pkg/sandbox"
+)
+
+const (
+	generatorRunTimeout = 10 * time.Second
+	// maxGeneratedInputBytes bounds a single generated input; testcases are
+	// stored inline with the problem.
+	maxGeneratedInputBytes = 8 << 20
+)
+
+type TestGenState string
+
+const (
+	TestGenStateRunning TestGenState = "RUNNING"
+	TestGenStateDone    TestGenState = "DONE"
+)
+
+// finished generations stay pollable this long after they are done
+const testGenRetention = time.Hour
+
+// GeneratedTest describes one generated testcase and what the reference
+// solution used on it.
+type GeneratedTest struct {
+	Index       int  `json:"index"`
+	InputBytes  int  `json:"inputBytes"`
+	OutputBytes int  `json:"outputBytes"`
+	IsHidden    bool `json:"isHidden"`
+	Runtime     int  `json:"runtimeMs"`
+	CPUTime     int  `json:"cpuTimeMs"`
+	Memory      int  `json:"memoryKb"`
+}
+
+// TestGenJob reports on generating one problem's testcases. The tests are
+// stored only when every one of them was generated and the reference solution
+// passed it; otherwise Error says which test failed and the problem keeps its
+// old tests.
+type TestGenJob struct {
+	ID            string          `json:"id"`
+	ProblemID     string          `json:"problemId"`
+	State         TestGenState    `json:"status"`
+	Total         int             `json:"total"`
+	Done          int             `json:"done"`
+	Tests         []GeneratedTest `json:"tests"`
+	TimeLimitMs   int             `json:"timeLimitMs"`
+	MemoryLimitMB int             `json:"memoryLimitMb"`
+	Stored        bool            `json:"stored"`
+	Error         string          `json:"error,omitempty"`
+	StartedAt     time.Time       `json:"startedAt"`
+	FinishedAt    *time.Time      `json:"finishedAt,omitempty"`
+}
+
+// TestGenService builds a problem's testcases from its generator and
+// reference solution.
+type TestGenService struct {
+	problems *ProblemService
+	judge    *JudgeService
+
+	mu        sync.Mutex
+	jobs      map[string]*TestGenJob
+	byProblem map[string]string
+}
+
+func NewTestGenService(problems *ProblemService, judge *JudgeService) *TestGenService {
+	return &TestGenService{problems: problems, judge: judge, jobs: map[string]*TestGenJob{}, byProblem: map[string]string{}}
+}
+
+// Start begins generating problemID's testcases in the background. A problem
+// is generated by at most one job at a time.
+func (s *TestGenService) Start(ctx context.Context, problemID string) (*TestGenJob, error) {
+	problemID = strings.TrimSpace(problemID)
+	if problemID == "" {
+		return nil, fmt.Errorf("problemId is required")
+	}
+	if s.problems == nil || s.judge == nil {
+		return nil, fmt.Errorf("test generation is not configured")
+	}
+	if !s.judge.enabled() {
+		return nil, fmt.Errorf("judge is disabled: sandbox isolation is unavailable (set JUDGE_DEV=1 to run unsandboxed)")
+	}
+	p, err := s.problems.GetAdmin(ctx, problemID)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, fmt.Errorf("problem not found")
+	}
+	if p.Type == domain.ProblemTypeInteractive {
+		return nil, fmt.Errorf("test generation is not supported for interactive problems")
+	}
+	if p.Generator == nil || p.Reference == nil || len(p.GeneratorTests) == 0 {
+		return nil, fmt.Errorf("problem has no generator, reference solution and generatorTests")
+	}
+
+	now := time.Now().UTC()
+	s.mu.Lock()
+	s.pruneLocked(now)
+	if id, ok := s.byProblem[problemID]; ok {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("tests are already being generated by %s", id)
+	}
+	job := &TestGenJob{
+		ID:            uuid.NewString(),
+		ProblemID:     problemID,
+		State:         TestGenStateRunning,
+		Total:         len(p.GeneratorTests),
+		Tests:         []GeneratedTest{},
+		MemoryLimitMB: memoryLimitMB(p),
+		StartedAt:     now,
+	}
+	s.jobs[job.ID] = job
+	s.byProblem[problemID] = job.ID
+	cp := s.snapshotLocked(job)
+	s.mu.Unlock()
+
+	go s.run(job, p)
+	return cp, nil
+}
+
+// Job returns a snapshot of a running or recently finished generation.
+func (s *TestGenService) Job(id string) (*TestGenJob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[strings.TrimSpace(id)]
+	if !ok {
+		return nil, false
+	}
+	return s.snapshotLocked(job), true
+}
+
+func (s *TestGenService) snapshotLocked(job *TestGenJob) *TestGenJob {
+	cp := *job
+	cp.Tests = append([]GeneratedTest{}, job.Tests...)
+	return &cp
+}
+
+func (s *TestGenService) pruneLocked(now time.Time) {
+	for id, job := range s.jobs {
+		if job.FinishedAt != nil && now.Sub(*job.FinishedAt) > testGenRetention {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+func (s *TestGenService) run(job *TestGenJob, p *domain.Problem) {
+	err := s.generate(job, p)
+	if err != nil {
+		log.Printf("[TESTGEN] problem %s failed: %v", job.ProblemID, err)
+	}
+	finishedAt := time.Now().UTC()
+	s.mu.Lock()
+	job.State = TestGenStateDone
+	job.FinishedAt = &finishedAt
+	if err != nil {
+		job.Error = err.Error()
+	} else {
+		job.Stored = true
+	}
+	delete(s.byProblem, job.ProblemID)
+	s.mu.Unlock()
+	log.Printf("[TESTGEN] problem %s: %d/%d tests generated", job.ProblemID, job.Done, job.Total)
+}
+
+// generate produces the tests one at a time, each run taking a sandbox slot,
+// and stores them once all are done.
+func (s *TestGenService) generate(job *TestGenJob, p *domain.Problem) error {
+	ctx := context.Background()
+	gen, err := s.judge.programs.get(s.judge.languages, p.Generator)
+	if err != nil {
+		return fmt.Errorf("generator: %v", err)
+	}
+	ref, err := s.judge.programs.get(s.judge.languages, p.Reference)
+	if err != nil {
+		return fmt.Errorf("reference solution: %v", err)
+	}
+	lim := referenceLimits(p, ref)
+	s.mu.Lock()
+	job.TimeLimitMs = int(lim.timeout.Milliseconds())
+	s.mu.Unlock()
+
+	tests := make([]domain.ProblemTestCase, 0, len(p.GeneratorTests))
+	for i, gt := range p.GeneratorTests {
+		input, err := s.runGenerator(ctx, gen, gt.Args)
+		if err != nil {
+			return fmt.Errorf("test %d: %v", i, err)
+		}
+		start := time.Now()
+		output, usage, err := s.judge.runReference(ctx, ref, input, lim)
+		if err != nil {
+			return fmt.Errorf("test %d: %v", i, err)
+		}
+		tests = append(tests, domain.ProblemTestCase{Input: input, Output: output, IsHidden: gt.IsHidden})
+		s.mu.Lock()
+		job.Done++
+		job.Tests = append(job.Tests, GeneratedTest{
+			Index:       i,
+			InputBytes:  len(input),
+			OutputBytes: len(output),
+			IsHidden:    gt.IsHidden,
+			Runtime:     int(time.Since(start).Milliseconds()),
+			CPUTime:     int(usage.cpuTime.Milliseconds()),
+			Memory:      usage.memoryKB,
+		})
+		s.mu.Unlock()
+	}
+
+	if _, err := s.problems.ReplaceTestCases(ctx, p.ID, p.UpdatedAt, tests); err != nil {
+		return fmt.Errorf("failed to store tests: %w", err)
+	}
+	return nil
+}
+
+// runGenerator runs the generator with args and returns what it printed.
+func (s *TestGenService) runGenerator(ctx context.Context, gen *programBuild, args []string) (string, error) {
+	if err := s.judge.acquireSandbox(ctx); err != nil {
+		return "", err
+	}
+	defer s.judge.releaseSandbox()
+
+	gctx, cancel := context.WithTimeout(ctx, generatorRunTimeout)
+	defer cancel()
+	var res *sandbox.Result
+	proc, err := s.judge.startRun(gctx, gen.command(args...), "", sandbox.Limits{CPUTime: generatorRunTimeout, MaxOutputBytes: maxGeneratedInputBytes})
+	if err == nil {
+		res, err = proc.Wait()
+	}
+	switch {
+	case res != nil && res.OutputLimitExceeded:
+		return "", fmt.Errorf("generator output is larger than %d MB", maxGeneratedInputBytes>>20)
+	case gctx.Err() == context.DeadlineExceeded:
+		return "", fmt.Errorf("generator failed: time limit exceeded")
+	case err != nil:
+		msg := ""
+		if res != nil {
+			msg = firstLine(res.Stderr)
+		}
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("generator failed: %s", msg)
+	}
+	return res.Stdout, nil
+}
+
+// referenceLimits are the limits a submission in the reference solution's
+// language gets.
+func referenceLimits(p *domain.Problem, ref *programBuild) runLimits {
+	lim := runLimits{timeout: timeLimit(p, ref.driver), memoryLimitMB: memoryLimitMB(p), outputLimitKB: p.OutputLimitKB}
+	if lim.outputLimitKB <= 0 {
+		lim.outputLimitKB = defaultOutputLimitKB
+	}
+	return lim
+}
+
+// runReference runs the reference solution on input under the limits a
+// submission in its language gets; anything but a clean run fails the test.
+func (s *JudgeService) runReference(ctx context.Context, ref *programBuild, input string, lim runLimits) (string, runUsage, error) {
+	if err := s.acquireSandbox(ctx); err != nil {
+		return "", runUsage{}, err
+	}
+	defer s.releaseSandbox()
+
+	tctx, cancel := context.WithTimeout(ctx, lim.wallTimeout())
+	defer cancel()
+	var res *sandbox.Result
+	proc, err := s.startRun(tctx, ref.commandWithMemory(lim.memoryLimitMB), input, lim.sandbox())
+	if err == nil {
+		res, err = proc.Wait()
+	}
+	out, usage, err := runOutcome(tctx, res, err, lim)
+	if err != nil {
+		if v := verdictOf(err); v != domain.VerdictInternalError {
+			return "", usage, fmt.Errorf("reference solution got %s: %v", v, err)
+		}
+		return "", usage, err
+	}
+	return out, usage, nil
+}
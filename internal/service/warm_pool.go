@@ -0,0 +1,425 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AQADIL/JudGO/internal/domain"
+	"github.com/AQADIL/JudGO/pkg/sandbox"
+)
+
+const (
+	defaultWarmPoolSize = 4
+	// warmPoolIdleTTL is how long runtimes are kept for limits no run has
+	// asked for. The limits most problems use stay warm regardless.
+	warmPoolIdleTTL = 10 * time.Minute
+	// warmStartTimeout bounds how long a runtime may take to become ready.
+	warmStartTimeout = 10 * time.Second
+	// warmSlotPoll is how often a runtime waiting to start checks for a free
+	// sandbox slot.
+	warmSlotPoll = 20 * time.Millisecond
+)
+
+// warmReady is the line a warm runtime writes to stdout once it is waiting
+// for its program.
+const warmReady = "ready\n"
+
+// warmDriver is implemented by interpreted languages whose runtime can be
+// started before the program it is to run is known.
+type warmDriver interface {
+	// WarmCommand starts a runtime that writes warmReady to stdout and then
+	// waits on stdin for its program: the source length in bytes on a line,
+	// then the source, then the program's input. Before running the program
+	// it writes the CPU time it has used so far, in microseconds, on a line
+	// of its own.
+	WarmCommand() *exec.Cmd
+}
+
+// warmKey says which runs a warm runtime can serve: it was started in the
+// sandbox with these limits.
+type warmKey struct {
+	lang JudgeLanguage
+	lim  runLimits
+}
+
+// warmRuntime is an idle sandboxed runtime. It runs exactly one testcase of
+// one submission and is then discarded, so nothing a program leaves behind
+// in its process or work dir reaches another submission.
+type warmRuntime struct {
+	dir    string
+	proc   *sandbox.Process
+	stdin  *os.File
+	stdout *os.File
+	cancel context.CancelFunc
+}
+
+// discard stops a runtime and cleans up after it.
+func (rt *warmRuntime) discard() {
+	rt.cancel()
+	rt.stdin.Close()
+	go func() {
+		_, _ = rt.proc.Wait()
+		rt.stdout.Close()
+		os.RemoveAll(rt.dir)
+	}()
+}
+
+// warmPool keeps up to size idle runtimes started ahead of time, so a run
+// skips interpreter start-up. They are started for the limits runs ask for;
+// when those vary, the runtimes of the limits used least recently make way.
+type warmPool struct {
+	size int
+	// slots are the judge's sandbox slots. A runtime starts up in one that
+	// no run is waiting for, so start-up is paid when the host has room.
+	slots chan struct{}
+
+	mu       sync.Mutex
+	idle     map[warmKey][]*warmRuntime
+	starting map[warmKey]int
+	lastUsed map[warmKey]time.Time
+	// pinned are the limits kept warm whether or not they are used.
+	pinned map[warmKey]bool
+
+	hits   int64
+	misses int64
+}
+
+// newWarmPool returns nil when JUDGE_WARM_POOL_SIZE is 0.
+func newWarmPool(slots chan struct{}) *warmPool {
+	size := defaultWarmPoolSize
+	if raw := strings.TrimSpace(os.Getenv("JUDGE_WARM_POOL_SIZE")); raw != "" {
+		if v, err := strconv.Atoi(raw); err == nil && v >= 0 {
+			size = v
+		}
+	}
+	if size == 0 {
+		return nil
+	}
+	p := &warmPool{
+		size:     size,
+		slots:    slots,
+		idle:     map[warmKey][]*warmRuntime{},
+		starting: map[warmKey]int{},
+		lastUsed: map[warmKey]time.Time{},
+		pinned:   map[warmKey]bool{},
+	}
+	go p.reap()
+	return p
+}
+
+// pin keeps runtimes for driver under the limits a problem without its own
+// gets, and starts them.
+func (p *warmPool) pin(driver LanguageDriver) {
+	wd, ok := driver.(warmDriver)
+	if !ok {
+		return
+	}
+	lim := runLimits{
+		timeout:       timeLimit(&domain.Problem{}, driver),
+		memoryLimitMB: defaultMemoryLimitMB,
+		outputLimitKB: defaultOutputLimitKB,
+		seccomp:       driver.SeccompProfile(),
+	}
+	key := warmKey{lang: driver.Language(), lim: lim}
+	p.mu.Lock()
+	p.pinned[key] = true
+	p.lastUsed[key] = time.Now()
+	p.mu.Unlock()
+	for i := 0; i < p.size; i++ {
+		p.refill(wd, key)
+	}
+}
+
+// take hands out an idle runtime for key, or nil if there is none, and
+// starts another in its place.
+func (p *warmPool) take(wd warmDriver, key warmKey) *warmRuntime {
+	p.mu.Lock()
+	p.lastUsed[key] = time.Now()
+	var rt *warmRuntime
+	if idle := p.idle[key]; len(idle) > 0 {
+		rt = idle[len(idle)-1]
+		p.idle[key] = idle[:len(idle)-1]
+	}
+	p.mu.Unlock()
+	if rt != nil {
+		atomic.AddInt64(&p.hits, 1)
+	} else {
+		atomic.AddInt64(&p.misses, 1)
+	}
+	p.refill(wd, key)
+	return rt
+}
+
+// refill starts a runtime for key if the pool has room, making room by
+// stopping one kept for other limits that were used less recently.
+func (p *warmPool) refill(wd warmDriver, key warmKey) {
+	p.mu.Lock()
+	if len(p.idle[key])+p.starting[key] >= p.size {
+		p.mu.Unlock()
+		return
+	}
+	var evicted *warmRuntime
+	if p.countLocked() >= p.size {
+		victim, ok := p.leastRecentLocked(key)
+		if !ok {
+			p.mu.Unlock()
+			return
+		}
+		idle := p.idle[victim]
+		evicted = idle[0]
+		p.idle[victim] = idle[1:]
+	}
+	p.starting[key]++
+	p.mu.Unlock()
+	if evicted != nil {
+		evicted.discard()
+	}
+
+	go func() {
+		p.acquireSpareSlot()
+		rt, err := startWarmRuntime(wd, key.lim)
+		<-p.slots
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.starting[key]--
+		if err != nil {
+			log.Printf("[JUDGE] failed to start warm %s runtime: %v", key.lang, err)
+			return
+		}
+		p.idle[key] = append(p.idle[key], rt)
+	}()
+}
+
+// acquireSpareSlot takes a sandbox slot once one is free. It never queues
+// for one: a run blocked on the slots is handed a freed slot directly, so a
+// runtime only gets one that nothing else is waiting for.
+func (p *warmPool) acquireSpareSlot() {
+	for {
+		select {
+		case p.slots <- struct{}{}:
+			return
+		default:
+			time.Sleep(warmSlotPoll)
+		}
+	}
+}
+
+func (p *warmPool) countLocked() int {
+	n := 0
+	for _, idle := range p.idle {
+		n += len(idle)
+	}
+	for _, c := range p.starting {
+		n += c
+	}
+	return n
+}
+
+// leastRecentLocked picks the limits other than key, with idle runtimes,
+// that were used least recently.
+func (p *warmPool) leastRecentLocked(key warmKey) (warmKey, bool) {
+	var victim warmKey
+	found := false
+	for k, idle := range p.idle {
+		if k == key || len(idle) == 0 {
+			continue
+		}
+		if !found || p.lastUsed[k].Before(p.lastUsed[victim]) {
+			victim, found = k, true
+		}
+	}
+	return victim, found
+}
+
+// reap stops runtimes kept for limits that have not been asked for in a
+// while.
+func (p *warmPool) reap() {
+	for range time.Tick(time.Minute) {
+		p.mu.Lock()
+		var stale []*warmRuntime
+		for k, idle := range p.idle {
+			if p.pinned[k] || time.Since(p.lastUsed[k]) < warmPoolIdleTTL {
+				continue
+			}
+			stale = append(stale, idle...)
+			delete(p.idle, k)
+			delete(p.lastUsed, k)
+		}
+		p.mu.Unlock()
+		for _, rt := range stale {
+			rt.discard()
+		}
+	}
+}
+
+// idleCount is the number of runtimes ready to be handed out.
+func (p *warmPool) idleCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := 0
+	for _, idle := range p.idle {
+		n += len(idle)
+	}
+	return n
+}
+
+// startWarmRuntime starts a runtime in a work dir of its own, in the sandbox
+// under lim, and waits until it is ready. From then on it uses no CPU time
+// until it is handed a program.
+func startWarmRuntime(wd warmDriver, lim runLimits) (*warmRuntime, error) {
+	dir, err := os.MkdirTemp("", "judgo-warm-*")
+	if err != nil {
+		return nil, err
+	}
+	if err := sandbox.PrepareWorkDir(dir); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	stdinR, stdinW, err := os.Pipe()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		stdinR.Close()
+		stdinW.Close()
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	cmd := wd.WarmCommand()
+	cmd.Dir = dir
+	cmd.Env = sandbox.DefaultEnv(dir)
+	cmd.Stdin = stdinR
+	cmd.Stdout = stdoutW
+	ctx, cancel := context.WithCancel(context.Background())
+	proc, err := sandbox.StartIsolated(ctx, cmd, "", lim.sandbox())
+	stdinR.Close()
+	stdoutW.Close()
+	if err != nil {
+		cancel()
+		stdinW.Close()
+		stdoutR.Close()
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	rt := &warmRuntime{dir: dir, proc: proc, stdin: stdinW, stdout: stdoutR, cancel: cancel}
+
+	ready := make([]byte, len(warmReady))
+	_ = stdoutR.SetReadDeadline(time.Now().Add(warmStartTimeout))
+	if _, err := io.ReadFull(stdoutR, ready); err != nil || string(ready) != warmReady {
+		rt.discard()
+		if err == nil {
+			err = fmt.Errorf("unexpected output %q", ready)
+		}
+		return nil, fmt.Errorf("runtime did not become ready: %v", err)
+	}
+	_ = stdoutR.SetReadDeadline(time.Time{})
+	return rt, nil
+}
+
+// warmOutput is what a warm runtime wrote once it was handed its program.
+type warmOutput struct {
+	startUs int64
+	started bool
+	stdout  string
+	over    bool
+}
+
+// readWarmOutput reads the start-up CPU time line and then up to limit bytes
+// of the program's stdout, stopping the runtime if it writes more.
+func readWarmOutput(rt *warmRuntime, limit int64) warmOutput {
+	var out warmOutput
+	br := bufio.NewReader(rt.stdout)
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return out
+	}
+	if out.startUs, err = strconv.ParseInt(strings.TrimSpace(line), 10, 64); err != nil {
+		return out
+	}
+	out.started = true
+	var buf bytes.Buffer
+	n, _ := io.CopyN(&buf, br, limit+1)
+	if n > limit {
+		out.over = true
+		rt.cancel()
+		buf.Truncate(int(limit))
+		_, _ = io.Copy(io.Discard, br)
+	}
+	out.stdout = buf.String()
+	return out
+}
+
+// runWarm runs code on stdin in rt the way runOnce runs a fresh process. The
+// CPU time rt used before the program started is not charged to it.
+func (s *JudgeService) runWarm(ctx context.Context, rt *warmRuntime, code []byte, stdin io.Reader, lim runLimits) (string, runUsage, error) {
+	defer os.RemoveAll(rt.dir)
+	defer rt.stdout.Close()
+	defer rt.cancel()
+	tctx, cancel := context.WithTimeout(ctx, lim.wallTimeout())
+	defer cancel()
+	stop := context.AfterFunc(tctx, rt.cancel)
+	defer stop()
+
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		defer rt.stdin.Close()
+		if _, err := fmt.Fprintf(rt.stdin, "%d\n%s", len(code), code); err != nil {
+			return
+		}
+		// A program that exits without reading all of its input ends the
+		// copy with EPIPE.
+		_, _ = io.Copy(rt.stdin, stdin)
+	}()
+	read := make(chan warmOutput, 1)
+	go func() {
+		read <- readWarmOutput(rt, int64(lim.outputLimitKB)<<10)
+	}()
+	res, err := rt.proc.Wait()
+	<-sent
+	out := <-read
+
+	if res != nil {
+		if !out.started && !res.OutputLimitExceeded {
+			if err == nil {
+				err = fmt.Errorf("warm runtime exited before running the program")
+			}
+			return "", runUsage{}, fmt.Errorf("internal error: %v", err)
+		}
+		res.Stdout = out.stdout
+		if out.over {
+			res.OutputLimitExceeded = true
+		}
+		if res.CPUTime -= time.Duration(out.startUs) * time.Microsecond; res.CPUTime < 0 {
+			res.CPUTime = 0
+		}
+	}
+	return runOutcome(tctx, res, err, lim)
+}
+
+// warmRuntimeFor returns an idle runtime for a run of driver under lim, if
+// the pool has one.
+func (s *JudgeService) warmRuntimeFor(driver LanguageDriver, lim runLimits) (*warmRuntime, bool) {
+	if s.warm == nil || !s.isolated {
+		return nil, false
+	}
+	wd, ok := driver.(warmDriver)
+	if !ok {
+		return nil, false
+	}
+	rt := s.warm.take(wd, warmKey{lang: driver.Language(), lim: lim})
+	return rt, rt != nil
+}
@@ -1,9 +1,12 @@
 package rest
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"math"
 	"net/http"
@@ -25,6 +28,8 @@ type Handler struct {
 	roomGameSvc  *service.RoomGameService
 	problemSvc   *service.ProblemService
 	judgeSvc     *service.JudgeService
+	rejudgeSvc   *service.RejudgeService
+	testGenSvc   *service.TestGenService
 	opsSvc       *service.OpsService
 	authService  *service.AuthService
 	fbAuth       *auth.Client
@@ -32,13 +37,14 @@ type Handler struct {
 	practiceRepo firebaseRepo.PracticeRepository
 }
 
-func NewHandler(ms *service.MatchService, rs *service.RoomService, rgs *service.RoomGameService, ps *service.ProblemService, js *service.JudgeService, ops *service.OpsService, as *service.AuthService, fbAuth *auth.Client, userRepo firebaseRepo.UserRepository, practiceRepo firebaseRepo.PracticeRepository) *Handler {
-	return &Handler{matchService: ms, roomService: rs, roomGameSvc: rgs, problemSvc: ps, judgeSvc: js, opsSvc: ops, authService: as, fbAuth: fbAuth, userRepo: userRepo, practiceRepo: practiceRepo}
+func NewHandler(ms *service.MatchService, rs *service.RoomService, rgs *service.RoomGameService, ps *service.ProblemService, js *service.JudgeService, rj *service.RejudgeService, tg *service.TestGenService, ops *service.OpsService, as *service.AuthService, fbAuth *auth.Client, userRepo firebaseRepo.UserRepository, practiceRepo firebaseRepo.PracticeRepository) *Handler {
+	return &Handler{matchService: ms, roomService: rs, roomGameSvc: rgs, problemSvc: ps, judgeSvc: js, rejudgeSvc: rj, testGenSvc: tg, opsSvc: ops, authService: as, fbAuth: fbAuth, userRepo: userRepo, practiceRepo: practiceRepo}
 }
 
 type createMatchRequest struct {
-	Type    string `json:"type"`
-	Player1 string `json:"player1"`
+	Type     string `json:"type"`
+	Player1  string `json:"player1"`
+	Language string `json:"language,omitempty"`
 }
 
 type joinMatchRequest struct {
@@ -75,16 +81,62 @@ type joinRoomRequest struct {
 type submitRoomGameRequest struct {
 	ProblemID string `json:"problemId"`
 	Code      string `json:"code"`
+	Mode      string `json:"mode"`
+}
+
+type hackRequest struct {
+	ProblemID    string `json:"problemId"`
+	TargetUserID string `json:"targetUserId"`
+	Input        string `json:"input"`
 }
 
 type createProblemRequest struct {
 	Problem domain.Problem `json:"problem"`
 }
 
+type updateProblemLimitsRequest struct {
+	ID string `json:"id"`
+	service.ProblemLimits
+}
+
+type rejudgeRequest struct {
+	ProblemID string `json:"problemId"`
+}
+
+type generateTestsRequest struct {
+	ProblemID string `json:"problemId"`
+}
+
 type createSubmissionRequest struct {
 	ProblemID string `json:"problemId"`
 	Language  string `json:"language"`
 	Code      string `json:"code"`
+	Mode      string `json:"mode"`
+}
+
+// Submission modes: SUBMIT (the default) judges every testcase and counts as
+// an attempt, RUN only checks the samples and is not recorded anywhere.
+const (
+	submissionModeSubmit = "SUBMIT"
+	submissionModeRun    = "RUN"
+)
+
+// samplesOnlyMode reports whether mode asks for a samples-only run.
+func samplesOnlyMode(mode string) (bool, error) {
+	switch strings.ToUpper(strings.TrimSpace(mode)) {
+	case "", submissionModeSubmit:
+		return false, nil
+	case submissionModeRun:
+		return true, nil
+	}
+	return false, fmt.Errorf("mode must be %s or %s", submissionModeSubmit, submissionModeRun)
+}
+
+type customRunRequest struct {
+	ProblemID string `json:"problemId"`
+	Language  string `json:"language"`
+	Code      string `json:"code"`
+	Input     string `json:"input"`
 }
 
 type ctxKey string
@@ -160,7 +212,8 @@ func (h *Handler) Instrument(next http.Handler) http.Handler {
 		if r.Method == http.MethodOptions {
 			return
 		}
-		h.opsSvc.RecordHTTPRequest(r.URL.Path, recorder.Status(), time.Since(started))
+		// The mux leaves the pattern it matched on the request.
+		h.opsSvc.RecordHTTPRequest(r.Pattern, r.URL.Path, recorder.Status(), time.Since(started))
 	})
 }
 
@@ -197,6 +250,46 @@ func (h *Handler) FirebaseAuthRequired(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// WorkerAuthRequired admits remote judge workers holding JUDGE_WORKER_TOKEN.
+func (h *Handler) WorkerAuthRequired(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.judgeSvc == nil || !h.judgeSvc.RemoteWorkers() {
+			h.writeError(w, http.StatusNotImplemented, "remote judge workers are disabled")
+			return
+		}
+		hdr := r.Header.Get("Authorization")
+		if hdr == "" || !strings.HasPrefix(hdr, "Bearer ") {
+			h.writeError(w, http.StatusUnauthorized, "missing bearer token")
+			return
+		}
+		if !h.judgeSvc.AuthorizeWorker(strings.TrimPrefix(hdr, "Bearer ")) {
+			h.writeError(w, http.StatusUnauthorized, "invalid worker token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// ScrapeAuthRequired admits metrics scrapers holding METRICS_SCRAPE_TOKEN.
+func (h *Handler) ScrapeAuthRequired(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.opsSvc == nil || !h.opsSvc.ScrapeEnabled() {
+			h.writeError(w, http.StatusNotImplemented, "metrics scraping is disabled")
+			return
+		}
+		hdr := r.Header.Get("Authorization")
+		if hdr == "" || !strings.HasPrefix(hdr, "Bearer ") {
+			h.writeError(w, http.StatusUnauthorized, "missing bearer token")
+			return
+		}
+		if !h.opsSvc.AuthorizeScrape(strings.TrimPrefix(hdr, "Bearer ")) {
+			h.writeError(w, http.StatusUnauthorized, "invalid scrape token")
+			return
+		}
+		next(w, r)
+	}
+}
+
 func (h *Handler) AdminOnly(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		role, _ := r.Context().Value(ctxRoleKey).(string)
@@ -525,6 +618,24 @@ func (h *Handler) HandleAdminProblems(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusOK, items)
 		return
 	}
+	if r.Method == http.MethodPatch {
+		var req updateProblemLimitsRequest
+		if err := decodeStrictJSON(r, &req); err != nil {
+			h.writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+		updated, err := h.problemSvc.UpdateLimits(r.Context(), req.ID, req.ProblemLimits)
+		if err != nil {
+			if strings.Contains(strings.ToLower(err.Error()), "not found") {
+				h.writeError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			h.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, updated)
+		return
+	}
 	if r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
@@ -543,6 +654,124 @@ func (h *Handler) HandleAdminProblems(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusCreated, created)
 }
 
+// HandleAdminRejudge handles POST /admin/rejudge, which starts rejudging a
+// problem's practice submissions, and GET /admin/rejudge/{id}, which reports
+// on it.
+func (h *Handler) HandleAdminRejudge(w http.ResponseWriter, r *http.Request) {
+	if !h.handleCORS(w, r) {
+		return
+	}
+	if h.rejudgeSvc == nil {
+		h.writeError(w, http.StatusNotImplemented, "rejudge is not configured")
+		return
+	}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/rejudge"), "/")
+	if id != "" {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		job, ok := h.rejudgeSvc.Job(id)
+		if !ok {
+			h.writeError(w, http.StatusNotFound, "rejudge not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req rejudgeRequest
+	if err := decodeStrictJSON(r, &req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	job, err := h.rejudgeSvc.Start(r.Context(), req.ProblemID)
+	if err != nil {
+		msg := strings.ToLower(err.Error())
+		switch {
+		case strings.Contains(msg, "not found"):
+			h.writeError(w, http.StatusNotFound, err.Error())
+		case strings.Contains(msg, "already being rejudged"):
+			h.writeError(w, http.StatusConflict, err.Error())
+		default:
+			h.writeJudgeError(w, err)
+		}
+		return
+	}
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// HandleAdminTestGen handles POST /admin/testgen, which starts generating a
+// problem's testcases from its generator and reference solution, and GET
+// /admin/testgen/{id}, which reports on it.
+func (h *Handler) HandleAdminTestGen(w http.ResponseWriter, r *http.Request) {
+	if !h.handleCORS(w, r) {
+		return
+	}
+	if h.testGenSvc == nil {
+		h.writeError(w, http.StatusNotImplemented, "test generation is not configured")
+		return
+	}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/testgen"), "/")
+	if id != "" {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		job, ok := h.testGenSvc.Job(id)
+		if !ok {
+			h.writeError(w, http.StatusNotFound, "test generation not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req generateTestsRequest
+	if err := decodeStrictJSON(r, &req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	job, err := h.testGenSvc.Start(r.Context(), req.ProblemID)
+	if err != nil {
+		msg := strings.ToLower(err.Error())
+		switch {
+		case strings.Contains(msg, "not found"):
+			h.writeError(w, http.StatusNotFound, err.Error())
+		case strings.Contains(msg, "already being generated"):
+			h.writeError(w, http.StatusConflict, err.Error())
+		default:
+			h.writeJudgeError(w, err)
+		}
+		return
+	}
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// HandleLanguages lists the languages the judge can build and run on this host.
+func (h *Handler) HandleLanguages(w http.ResponseWriter, r *http.Request) {
+	if !h.handleCORS(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if h.judgeSvc == nil {
+		writeJSON(w, http.StatusOK, []service.LanguageInfo{})
+		return
+	}
+	writeJSON(w, http.StatusOK, h.judgeSvc.Languages())
+}
+
 func (h *Handler) HandlePublicProblems(w http.ResponseWriter, r *http.Request) {
 	if !h.handleCORS(w, r) {
 		return
@@ -588,7 +817,18 @@ func (h *Handler) HandlePublicProblem(w http.ResponseWriter, r *http.Request) {
 		h.writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	writeJSON(w, http.StatusOK, p)
+	if h.judgeSvc == nil {
+		writeJSON(w, http.StatusOK, p)
+		return
+	}
+	resp := struct {
+		*domain.Problem
+		Limits []service.EffectiveLimit `json:"limits"`
+	}{
+		Problem: p,
+		Limits:  h.judgeSvc.EffectiveLimits(p),
+	}
+	writeJSON(w, http.StatusOK, resp)
 }
 
 func (h *Handler) HandleSubmissions(w http.ResponseWriter, r *http.Request) {
@@ -609,50 +849,267 @@ func (h *Handler) HandleSubmissions(w http.ResponseWriter, r *http.Request) {
 		h.writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
 		return
 	}
+	samplesOnly, err := samplesOnlyMode(req.Mode)
+	if err != nil {
+		h.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	userID, _ := r.Context().Value(ctxUserIDKey).(string)
 	lang := service.JudgeLanguage(strings.ToLower(strings.TrimSpace(req.Language)))
-	jr, err := h.judgeSvc.Judge(r.Context(), req.ProblemID, lang, req.Code, 5*time.Second)
-	if err != nil {
-		msg := strings.ToLower(err.Error())
-		if strings.Contains(msg, "disabled") {
-			h.writeError(w, http.StatusNotImplemented, err.Error())
+	problemID := strings.TrimSpace(req.ProblemID)
+	code := req.Code
+
+	if samplesOnly {
+		job, err := h.judgeSvc.Enqueue(r.Context(), problemID, lang, code, service.JudgeOptions{SamplesOnly: true, UserID: userID}, nil)
+		if err != nil {
+			h.writeJudgeError(w, err)
 			return
 		}
-		h.writeError(w, http.StatusBadRequest, err.Error())
+		writeJSON(w, http.StatusAccepted, job)
 		return
 	}
 
+	// The attempt number is taken once the submission is queued, so one the
+	// queue rejects does not use one up, and before it is judged, so attempts
+	// keep their submit order even when they finish out of order. The result
+	// waits for it.
+	attempt := make(chan int, 1)
+	record := func(jr *service.JudgeResult, err error) {
+		attemptNumber := <-attempt
+		if err != nil || jr == nil || h.practiceRepo == nil || userID == "" || attemptNumber == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = h.practiceRepo.Create(ctx, &firebaseRepo.PracticeSubmission{
+			UserID:        userID,
+			ProblemID:     problemID,
+			Language:      string(jr.Language),
+			Code:          code,
+			AttemptNumber: attemptNumber,
+			Passed:        jr.Passed,
+			Verdict:       jr.Verdict,
+			PassedCount:   jr.PassedCnt,
+			TotalCount:    jr.TotalCnt,
+			Score:         jr.Score,
+			MaxScore:      jr.MaxScore,
+			CreatedAt:     time.Now().UTC(),
+		})
+		if jr.Passed {
+			_ = h.practiceRepo.MarkSolvedIfFirst(ctx, userID, problemID, attemptNumber)
+		}
+	}
+
+	job, err := h.judgeSvc.Enqueue(r.Context(), problemID, lang, code, service.JudgeOptions{UserID: userID}, record)
+	if err != nil {
+		h.writeJudgeError(w, err)
+		return
+	}
 	attemptNumber := 0
-	if h.practiceRepo != nil && userID != "" && strings.TrimSpace(req.ProblemID) != "" {
-		if n, perr := h.practiceRepo.NextAttemptNumber(r.Context(), userID, req.ProblemID); perr == nil {
+	if h.practiceRepo != nil && userID != "" && problemID != "" {
+		n, err := h.practiceRepo.NextAttemptNumber(r.Context(), userID, problemID)
+		if err != nil {
+			log.Printf("[SUBMISSION] failed to increment attempt counter: %v", err)
+		} else {
 			attemptNumber = n
-			_ = h.practiceRepo.Create(r.Context(), &firebaseRepo.PracticeSubmission{
-				UserID:        userID,
-				ProblemID:     strings.TrimSpace(req.ProblemID),
-				Language:      strings.TrimSpace(req.Language),
-				Code:          req.Code,
-				AttemptNumber: n,
-				Passed:        jr.Passed,
-				PassedCount:   jr.PassedCnt,
-				TotalCount:    jr.TotalCnt,
-				CreatedAt:     time.Now().UTC(),
-			})
-			if jr.Passed {
-				_ = h.practiceRepo.MarkSolvedIfFirst(r.Context(), userID, req.ProblemID, n)
-			}
-		} else if perr != nil {
-			log.Printf("[SUBMISSION] failed to increment attempt counter: %v", perr)
 		}
 	}
+	attempt <- attemptNumber
 
 	resp := struct {
-		*service.JudgeResult
+		*service.JudgeJob
 		AttemptNumber int `json:"attemptNumber"`
 	}{
-		JudgeResult:   jr,
+		JudgeJob:      job,
 		AttemptNumber: attemptNumber,
 	}
-	writeJSON(w, http.StatusOK, resp)
+	writeJSON(w, http.StatusAccepted, resp)
+}
+
+// HandleSubmissionStatus handles /submissions/{id}, polled until the
+// submission reaches DONE. Only the submitter and admins can see it; to
+// anyone else it does not exist.
+func (h *Handler) HandleSubmissionStatus(w http.ResponseWriter, r *http.Request) {
+	if !h.handleCORS(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if h.judgeSvc == nil {
+		h.writeError(w, http.StatusNotImplemented, "judge is not configured")
+		return
+	}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/submissions/"), "/")
+	userID, _ := r.Context().Value(ctxUserIDKey).(string)
+	role, _ := r.Context().Value(ctxRoleKey).(string)
+	job, ok := h.judgeSvc.Job(id)
+	if !ok || (!job.OwnedBy(userID) && role != string(domain.UserRoleAdmin)) {
+		h.writeError(w, http.StatusNotFound, "submission not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// HandleRun compiles and runs code once on the caller's own input. It is not
+// a submission: no attempt is counted and nothing is recorded.
+func (h *Handler) HandleRun(w http.ResponseWriter, r *http.Request) {
+	if !h.handleCORS(w, r) {
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if h.judgeSvc == nil {
+		h.writeError(w, http.StatusNotImplemented, "judge is not configured")
+		return
+	}
+
+	var req customRunRequest
+	if err := decodeStrictJSON(r, &req); err != nil {
+		h.writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	lang := service.JudgeLanguage(strings.ToLower(strings.TrimSpace(req.Language)))
+	res, err := h.judgeSvc.RunCustom(r.Context(), req.ProblemID, lang, req.Code, req.Input)
+	if err != nil {
+		h.writeJudgeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// HandleJudgeWorkers serves the remote judge worker protocol:
+//
+//	POST /judge-workers/register                  -> WorkerSession
+//	POST /judge-workers/{id}/heartbeat
+//	POST /judge-workers/{id}/next                 -> WorkerJob, or 204 when the poll times out
+//	POST /judge-workers/{id}/jobs/{jobId}/result  <- WorkerResult
+//	GET  /judge-workers/testdata/{problemId}/{version}/{checksum}
+//
+// 404 on a worker's own routes means it is unknown and must register again.
+func (h *Handler) HandleJudgeWorkers(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/judge-workers/"), "/"), "/")
+	if r.Method == http.MethodGet && len(parts) == 4 && parts[0] == "testdata" {
+		h.serveTestData(w, r, parts[1], parts[2], parts[3])
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if len(parts) == 1 && parts[0] == "register" {
+		var req service.WorkerRegistration
+		if err := decodeStrictJSON(r, &req); err != nil {
+			h.writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+		sess, err := h.judgeSvc.RegisterWorker(req)
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, sess)
+		return
+	}
+	if len(parts) < 2 || parts[0] == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	workerID := parts[0]
+
+	var err error
+	switch {
+	case len(parts) == 2 && parts[1] == "heartbeat":
+		var hb service.WorkerHeartbeat
+		if err := decodeStrictJSON(r, &hb); err != nil {
+			h.writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+		if err = h.judgeSvc.WorkerHeartbeat(workerID, hb); err == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	case len(parts) == 2 && parts[1] == "next":
+		var job *service.WorkerJob
+		if job, err = h.judgeSvc.NextWorkerJob(r.Context(), workerID); err == nil {
+			if job == nil {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			writeJSON(w, http.StatusOK, job)
+			return
+		}
+	case len(parts) == 4 && parts[1] == "jobs" && parts[3] == "result":
+		var res service.WorkerResult
+		if err := decodeStrictJSON(r, &res); err != nil {
+			h.writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+		if err = h.judgeSvc.CompleteWorkerJob(workerID, parts[2], res); err == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.writeError(w, http.StatusConflict, err.Error())
+		return
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, service.ErrUnknownWorker) {
+		h.writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	h.writeError(w, http.StatusInternalServerError, err.Error())
+}
+
+// serveTestData streams stored testcase data to a worker judging a problem
+// whose tests are only referenced by checksum.
+func (h *Handler) serveTestData(w http.ResponseWriter, r *http.Request, problemID, version, checksum string) {
+	rc, err := h.judgeSvc.OpenTestData(r.Context(), problemID, version, checksum)
+	if err != nil {
+		h.writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	defer rc.Close()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, rc); err != nil {
+		log.Printf("[WORKER] failed to send test data %s: %v", checksum, err)
+	}
+}
+
+// writeJudgeError maps errors from submitting to the judge onto a status.
+func (h *Handler) writeJudgeError(w http.ResponseWriter, err error) {
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "disabled"):
+		h.writeError(w, http.StatusNotImplemented, err.Error())
+	case strings.Contains(msg, "queue is full"), strings.Contains(msg, "no judge worker"):
+		w.Header().Set("Retry-After", "5")
+		h.writeError(w, http.StatusServiceUnavailable, err.Error())
+	default:
+		h.writeError(w, http.StatusBadRequest, err.Error())
+	}
+}
+
+// writeHackError maps hack phase errors: the wrong phase or an already
+// challenged solution is a conflict, missing rights are forbidden.
+func (h *Handler) writeHackError(w http.ResponseWriter, err error) {
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "not found"):
+		h.writeError(w, http.StatusNotFound, err.Error())
+	case strings.Contains(msg, "hack phase"), strings.Contains(msg, "already being hacked"):
+		h.writeError(w, http.StatusConflict, err.Error())
+	case strings.Contains(msg, "only players who solved"):
+		h.writeError(w, http.StatusForbidden, err.Error())
+	default:
+		h.writeJudgeError(w, err)
+	}
 }
 
 func (h *Handler) HandleRooms(w http.ResponseWriter, r *http.Request) {
@@ -699,6 +1156,14 @@ func (h *Handler) HandleRooms(w http.ResponseWriter, r *http.Request) {
 		h.writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
 		return
 	}
+	if h.judgeSvc != nil && req.Settings.Language != "" {
+		lang, err := h.judgeSvc.ResolveLanguage(string(req.Settings.Language))
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		req.Settings.Language = service.RoomLanguage(lang)
+	}
 
 	room, err := h.roomService.CreateRoom(r.Context(), userID, displayName, req.Name, req.IsPrivate, req.Password, req.Settings)
 	if err != nil {
@@ -856,7 +1321,8 @@ func (h *Handler) HandleRoomActions(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNotFound)
 }
 
-// HandleRoomGameActions handles /room-games/{id} and /room-games/{id}/submit
+// HandleRoomGameActions handles /room-games/{id}, /room-games/{id}/submit and,
+// during the hack phase, /room-games/{id}/solutions and /room-games/{id}/hacks
 func (h *Handler) HandleRoomGameActions(w http.ResponseWriter, r *http.Request) {
 	if !h.handleCORS(w, r) {
 		return
@@ -893,7 +1359,42 @@ func (h *Handler) HandleRoomGameActions(w http.ResponseWriter, r *http.Request)
 				return
 			}
 		}
-		writeJSON(w, http.StatusOK, g)
+		writeJSON(w, http.StatusOK, service.RedactRoomGameForViewer(g, userID))
+		return
+	}
+
+	if len(parts) == 2 && parts[1] == "solutions" {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		userID, _ := r.Context().Value(ctxUserIDKey).(string)
+		subs, err := h.roomGameSvc.HackTargets(r.Context(), gameID, userID, r.URL.Query().Get("problemId"))
+		if err != nil {
+			h.writeHackError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, subs)
+		return
+	}
+
+	if len(parts) == 2 && parts[1] == "hacks" {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		userID, _ := r.Context().Value(ctxUserIDKey).(string)
+		var req hackRequest
+		if err := decodeStrictJSON(r, &req); err != nil {
+			h.writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+			return
+		}
+		hack, err := h.roomGameSvc.Hack(r.Context(), gameID, userID, req.TargetUserID, req.ProblemID, req.Input)
+		if err != nil {
+			h.writeHackError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, hack)
 		return
 	}
 
@@ -926,11 +1427,25 @@ func (h *Handler) HandleRoomGameActions(w http.ResponseWriter, r *http.Request)
 			h.writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
 			return
 		}
-		g, sub, err := h.roomGameSvc.Submit(r.Context(), gameID, userID, displayName, req.ProblemID, req.Code)
+		samplesOnly, err := samplesOnlyMode(req.Mode)
 		if err != nil {
 			h.writeError(w, http.StatusBadRequest, err.Error())
 			return
 		}
+		if samplesOnly {
+			job, err := h.roomGameSvc.RunSamples(r.Context(), gameID, userID, req.ProblemID, req.Code)
+			if err != nil {
+				h.writeJudgeError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusAccepted, job)
+			return
+		}
+		g, sub, err := h.roomGameSvc.Submit(r.Context(), gameID, userID, displayName, req.ProblemID, req.Code)
+		if err != nil {
+			h.writeJudgeError(w, err)
+			return
+		}
 		if g != nil {
 			g.MyUserID = userID
 		}
@@ -940,7 +1455,7 @@ func (h *Handler) HandleRoomGameActions(w http.ResponseWriter, r *http.Request)
 			}
 			_ = h.roomGameSvc.Delete(r.Context(), gameID)
 		}
-		writeJSON(w, http.StatusOK, map[string]interface{}{"game": g, "submission": sub})
+		writeJSON(w, http.StatusOK, map[string]interface{}{"game": service.RedactRoomGameForViewer(g, userID), "submission": sub})
 		return
 	}
 
@@ -1191,7 +1706,7 @@ func (h *Handler) handleCORS(w http.ResponseWriter, r *http.Request) bool {
 
 	w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
 	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, ngrok-skip-browser-warning")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 	w.Header().Set("Vary", "Origin")
 	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusNoContent)
@@ -1231,7 +1746,17 @@ func (h *Handler) HandleCreateMatch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	match, err := h.matchService.CreateMatch(r.Context(), req.Type, req.Player1)
+	language := strings.TrimSpace(req.Language)
+	if language != "" && h.judgeSvc != nil {
+		lang, err := h.judgeSvc.ResolveLanguage(language)
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		language = string(service.RoomLanguage(lang))
+	}
+
+	match, err := h.matchService.CreateMatch(r.Context(), req.Type, req.Player1, language)
 	if err != nil {
 		log.Printf("[HTTP] failed to create match: %v", err)
 		h.writeError(w, http.StatusInternalServerError, "failed to create match")
@@ -1332,28 +1857,31 @@ func (h *Handler) handleSubmit(w http.ResponseWriter, r *http.Request, matchID s
 		lang = service.JudgeLanguageGo
 	}
 
-	jr, err := h.judgeSvc.Judge(r.Context(), problemID, lang, req.Code, 5*time.Second)
+	player := req.Player
+	// The submitter polls the result like any other submission.
+	userID, _ := r.Context().Value(ctxUserIDKey).(string)
+	job, err := h.judgeSvc.Enqueue(r.Context(), problemID, lang, req.Code, service.JudgeOptions{StopOnFirstFailure: true, UserID: userID}, func(jr *service.JudgeResult, err error) {
+		if err != nil || jr == nil {
+			return
+		}
+		delta := 0
+		if jr.Passed {
+			delta = 100
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_, _ = h.matchService.UpdateScore(ctx, matchID, player, delta, jr.Passed)
+	})
 	if err != nil {
-		h.writeError(w, http.StatusBadRequest, err.Error())
+		h.writeJudgeError(w, err)
 		return
 	}
 
-	delta := 0
-	if jr.Passed {
-		delta = 100
-	}
-	finish := jr.Passed
-
-	_, _ = h.matchService.UpdateScore(r.Context(), matchID, req.Player, delta, finish)
-
-	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"passed":      jr.Passed,
-		"passedCount": jr.PassedCnt,
-		"totalCount":  jr.TotalCnt,
-		"results":     jr.Results,
-		"matchId":     matchID,
-		"player":      req.Player,
-		"finished":    finish,
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"submissionId": job.ID,
+		"status":       job.State,
+		"matchId":      matchID,
+		"player":       req.Player,
 	})
 }
 
@@ -1374,6 +1902,23 @@ func (h *Handler) HandleAdminOpsMetrics(w http.ResponseWriter, r *http.Request)
 	writeJSON(w, http.StatusOK, snapshot)
 }
 
+// HandleMetrics serves the ops metrics to Prometheus in the OpenMetrics text
+// format.
+func (h *Handler) HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	var buf bytes.Buffer
+	if err := h.opsSvc.WriteOpenMetrics(r.Context(), &buf); err != nil {
+		h.writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", service.OpenMetricsContentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
 func decodeStrictJSON(r *http.Request, dst interface{}) error {
 	defer r.Body.Close()
 	dec := json.NewDecoder(r.Body)
@@ -0,0 +1,120 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AQADIL/JudGO/internal/domain"
+	"github.com/AQADIL/JudGO/internal/service"
+)
+
+type memMatchRepo struct{ m map[string]*domain.Match }
+
+func (r *memMatchRepo) Create(ctx context.Context, m *domain.Match) error {
+	r.m[m.ID] = m
+	return nil
+}
+
+func (r *memMatchRepo) Get(ctx context.Context, id string) (*domain.Match, error) {
+	m, ok := r.m[id]
+	if !ok {
+		return nil, fmt.Errorf("match not found")
+	}
+	cp := *m
+	return &cp, nil
+}
+
+func (r *memMatchRepo) Update(ctx context.Context, m *domain.Match) error {
+	r.m[m.ID] = m
+	return nil
+}
+
+type memProblemRepo struct{ p map[string]*domain.Problem }
+
+func (r *memProblemRepo) Create(ctx context.Context, p *domain.Problem) error {
+	r.p[p.ID] = p
+	return nil
+}
+
+func (r *memProblemRepo) Get(ctx context.Context, id string) (*domain.Problem, error) {
+	if p, ok := r.p[id]; ok {
+		cp := *p
+		return &cp, nil
+	}
+	return nil, nil
+}
+
+func (r *memProblemRepo) List(ctx context.Context) ([]*domain.Problem, error) {
+	out := make([]*domain.Problem, 0, len(r.p))
+	for _, p := range r.p {
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// withUser stands in for FirebaseAuthRequired.
+func withUser(r *http.Request, userID, role string) *http.Request {
+	ctx := context.WithValue(r.Context(), ctxUserIDKey, userID)
+	ctx = context.WithValue(ctx, ctxRoleKey, role)
+	return r.WithContext(ctx)
+}
+
+// TestMatchSubmissionStatus submits to a match and polls the submission as
+// its submitter, another player and an admin. Judging on a registered remote
+// worker that never pulls keeps the job queued, so nothing is compiled.
+func TestMatchSubmissionStatus(t *testing.T) {
+	t.Setenv("JUDGE_REMOTE_WORKERS", "1")
+	t.Setenv("JUDGE_WORKER_TOKEN", "test")
+
+	problems := service.NewProblemService(&memProblemRepo{p: map[string]*domain.Problem{
+		"sum": {ID: "sum", TestCases: []domain.ProblemTestCase{{Input: "1 2", Output: "3"}}},
+	}}, nil)
+	judge := service.NewJudgeService(problems)
+	if _, err := judge.RegisterWorker(service.WorkerRegistration{Languages: []service.JudgeLanguage{service.JudgeLanguageGo}, Capacity: 1}); err != nil {
+		t.Fatalf("register worker: %v", err)
+	}
+	matches := service.NewMatchService(&memMatchRepo{m: map[string]*domain.Match{
+		"m1": {ID: "m1", ProblemID: "sum", Language: "go"},
+	}})
+	h := NewHandler(matches, nil, nil, problems, judge, nil, nil, nil, nil, nil, nil, nil)
+
+	body := `{"player":"alice","code":"package main\nfunc main() {}"}`
+	req := withUser(httptest.NewRequest(http.MethodPost, "/matches/m1/submit", strings.NewReader(body)), "alice-uid", string(domain.UserRoleUser))
+	rec := httptest.NewRecorder()
+	h.HandleMatchActions(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("submit: status %d, body %s", rec.Code, rec.Body)
+	}
+	var sub struct {
+		SubmissionID string `json:"submissionId"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&sub); err != nil || sub.SubmissionID == "" {
+		t.Fatalf("submit: no submissionId (%v)", err)
+	}
+
+	tests := []struct {
+		name   string
+		userID string
+		role   domain.UserRole
+		want   int
+	}{
+		{"submitter", "alice-uid", domain.UserRoleUser, http.StatusOK},
+		{"other player", "bob-uid", domain.UserRoleUser, http.StatusNotFound},
+		{"admin", "admin-uid", domain.UserRoleAdmin, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := withUser(httptest.NewRequest(http.MethodGet, "/submissions/"+sub.SubmissionID, nil), tt.userID, string(tt.role))
+			rec := httptest.NewRecorder()
+			h.HandleSubmissionStatus(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d (body %s)", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
@@ -14,15 +14,25 @@ func RegisterRoutes(mux *http.ServeMux, h *Handler) {
 	mux.HandleFunc("/profile", h.FirebaseAuthRequired(h.HandleProfileUpdate))
 	mux.HandleFunc("/me", h.FirebaseAuthRequired(h.HandleMeFirebase))
 	mux.HandleFunc("/dashboard/stats", h.FirebaseAuthRequired(h.HandleDashboardStats))
+	mux.HandleFunc("/metrics", h.ScrapeAuthRequired(h.HandleMetrics))
 	mux.HandleFunc("/admin/ops/metrics", h.FirebaseAuthRequired(h.AdminOnly(h.HandleAdminOpsMetrics)))
 	mux.HandleFunc("/admin/users", h.FirebaseAuthRequired(h.AdminOnly(h.HandleAdminUsers)))
 	mux.HandleFunc("/admin/problems", h.FirebaseAuthRequired(h.AdminOnly(h.HandleAdminProblems)))
+	mux.HandleFunc("/admin/rejudge", h.FirebaseAuthRequired(h.AdminOnly(h.HandleAdminRejudge)))
+	mux.HandleFunc("/admin/rejudge/", h.FirebaseAuthRequired(h.AdminOnly(h.HandleAdminRejudge)))
+	mux.HandleFunc("/admin/testgen", h.FirebaseAuthRequired(h.AdminOnly(h.HandleAdminTestGen)))
+	mux.HandleFunc("/admin/testgen/", h.FirebaseAuthRequired(h.AdminOnly(h.HandleAdminTestGen)))
 	mux.HandleFunc("/admin/user-stats", h.FirebaseAuthRequired(h.AdminOnly(h.HandleAdminUserStats)))
 	mux.HandleFunc("/admin/user-submissions", h.FirebaseAuthRequired(h.AdminOnly(h.HandleAdminUserSubmissions)))
 
 	mux.HandleFunc("/problems", RateLimitMiddleware(globalRL, h.HandlePublicProblems))
 	mux.HandleFunc("/problems/", RateLimitMiddleware(globalRL, h.HandlePublicProblem))
+	mux.HandleFunc("/languages", RateLimitMiddleware(globalRL, h.HandleLanguages))
 	mux.HandleFunc("/submissions", RateLimitMiddleware(submitRL, h.FirebaseAuthRequired(h.HandleSubmissions)))
+	mux.HandleFunc("/run", RateLimitMiddleware(submitRL, h.FirebaseAuthRequired(h.HandleRun)))
+	mux.HandleFunc("/submissions/", RateLimitMiddleware(globalRL, h.FirebaseAuthRequired(h.HandleSubmissionStatus)))
+
+	mux.HandleFunc("/judge-workers/", h.WorkerAuthRequired(h.HandleJudgeWorkers))
 
 	mux.HandleFunc("/rooms", h.FirebaseAuthRequired(h.HandleRooms))
 	mux.HandleFunc("/rooms/", h.FirebaseAuthRequired(h.HandleRoomActions))
@@ -31,6 +41,6 @@ func RegisterRoutes(mux *http.ServeMux, h *Handler) {
 	mux.HandleFunc("/auth/signup", RateLimitMiddleware(authRL, h.HandleSignUp))
 	mux.HandleFunc("/auth/signin", RateLimitMiddleware(authRL, h.HandleSignIn))
 
-	mux.HandleFunc("/matches", h.HandleCreateMatch)
-	mux.HandleFunc("/matches/", h.HandleMatchActions)
+	mux.HandleFunc("/matches", h.FirebaseAuthRequired(h.HandleCreateMatch))
+	mux.HandleFunc("/matches/", h.FirebaseAuthRequired(h.HandleMatchActions))
 }
@@ -0,0 +1,178 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const cgroupMountPoint = "/sys/fs/cgroup"
+
+type cgroupParent struct {
+	path        string
+	memory      bool
+	pids        bool
+	cpu         bool
+	unavailable error
+}
+
+var (
+	cgroupOnce sync.Once
+	cgroupRoot cgroupParent
+	cgroupSeq  uint64
+)
+
+// loadCgroupParent resolves the cgroup v2 directory under which per-run
+// cgroups are created. JUDGE_CGROUP_ROOT points at a delegated cgroup; the
+// default is a "judgo" child of the cgroup2 mount.
+func loadCgroupParent() cgroupParent {
+	cgroupOnce.Do(func() {
+		var st unix.Statfs_t
+		if err := unix.Statfs(cgroupMountPoint, &st); err != nil || st.Type != unix.CGROUP2_SUPER_MAGIC {
+			cgroupRoot.unavailable = fmt.Errorf("cgroup v2 is not mounted at %s", cgroupMountPoint)
+			return
+		}
+		root := strings.TrimSpace(os.Getenv("JUDGE_CGROUP_ROOT"))
+		if root == "" {
+			root = filepath.Join(cgroupMountPoint, "judgo")
+		}
+		if err := os.MkdirAll(root, 0755); err != nil {
+			cgroupRoot.unavailable = err
+			return
+		}
+		// The parent has to delegate controllers before the judge cgroup can
+		// enable them for its own children; both writes are best-effort.
+		_ = os.WriteFile(filepath.Join(filepath.Dir(root), "cgroup.subtree_control"), []byte("+memory +pids +cpu"), 0644)
+		for _, c := range []string{"memory", "pids", "cpu"} {
+			_ = os.WriteFile(filepath.Join(root, "cgroup.subtree_control"), []byte("+"+c), 0644)
+		}
+		raw, err := os.ReadFile(filepath.Join(root, "cgroup.subtree_control"))
+		if err != nil {
+			cgroupRoot.unavailable = err
+			return
+		}
+		enabled := strings.Fields(string(raw))
+		has := func(name string) bool {
+			for _, c := range enabled {
+				if c == name {
+					return true
+				}
+			}
+			return false
+		}
+		cgroupRoot = cgroupParent{path: root, memory: has("memory"), pids: has("pids"), cpu: has("cpu")}
+		if !cgroupRoot.memory && !cgroupRoot.pids && !cgroupRoot.cpu {
+			cgroupRoot.unavailable = fmt.Errorf("no cgroup controllers delegated to %s", root)
+		}
+	})
+	return cgroupRoot
+}
+
+// PidsCgroup reports whether runs get a pids cgroup. Without one their
+// process count is bounded by RLIMIT_NPROC alone, which before Linux 5.14
+// counts every process of the host user rather than the sandbox's.
+func PidsCgroup() bool {
+	parent := loadCgroupParent()
+	return parent.unavailable == nil && parent.pids
+}
+
+type runCgroup struct {
+	path   string
+	fd     int
+	memory bool
+	pids   bool
+}
+
+// newRunCgroup creates a leaf cgroup for one run. It returns nil without an
+// error when cgroups are unavailable, in which case rlimits are the only
+// resource bound.
+func newRunCgroup(l Limits) (*runCgroup, error) {
+	parent := loadCgroupParent()
+	if parent.unavailable != nil {
+		return nil, nil
+	}
+	name := fmt.Sprintf("run-%d-%d", os.Getpid(), atomic.AddUint64(&cgroupSeq, 1))
+	path := filepath.Join(parent.path, name)
+	if err := os.Mkdir(path, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cgroup: %w", err)
+	}
+	cg := &runCgroup{path: path, fd: -1}
+
+	write := func(file, value string) error {
+		return os.WriteFile(filepath.Join(path, file), []byte(value), 0644)
+	}
+	if parent.memory {
+		if err := write("memory.max", strconv.FormatInt(l.hardMemoryCap()+helperMemoryReserve, 10)); err != nil {
+			cg.close()
+			return nil, fmt.Errorf("failed to set memory.max: %w", err)
+		}
+		_ = write("memory.swap.max", "0")
+		cg.memory = true
+	}
+	if parent.pids {
+		if err := write("pids.max", strconv.Itoa(l.MaxProcs)); err != nil {
+			cg.close()
+			return nil, fmt.Errorf("failed to set pids.max: %w", err)
+		}
+		cg.pids = true
+	}
+	if parent.cpu {
+		const period = 100000
+		quota := int64(l.CPUQuota * period)
+		if err := write("cpu.max", fmt.Sprintf("%d %d", quota, period)); err != nil {
+			cg.close()
+			return nil, fmt.Errorf("failed to set cpu.max: %w", err)
+		}
+	}
+
+	fd, err := unix.Open(path, unix.O_DIRECTORY|unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		cg.close()
+		return nil, fmt.Errorf("failed to open cgroup: %w", err)
+	}
+	cg.fd = fd
+	return cg, nil
+}
+
+// oomKilled reports whether the kernel OOM killer fired inside the cgroup.
+func (c *runCgroup) oomKilled() bool {
+	if !c.memory {
+		return false
+	}
+	raw, err := os.ReadFile(filepath.Join(c.path, "memory.events"))
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(raw), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			n, _ := strconv.Atoi(fields[1])
+			return n > 0
+		}
+	}
+	return false
+}
+
+func (c *runCgroup) close() {
+	if c.fd >= 0 {
+		_ = unix.Close(c.fd)
+		c.fd = -1
+	}
+	_ = os.WriteFile(filepath.Join(c.path, "cgroup.kill"), []byte("1"), 0644)
+	// rmdir fails with EBUSY until the kernel has reaped every member.
+	for i := 0; i < 50; i++ {
+		if err := os.Remove(c.path); err == nil || os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -5,16 +5,50 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
+	"time"
 )
 
 type Result struct {
 	Stdout   string
 	Stderr   string
 	ExitCode int
+	// CPUTime is the user plus system CPU time the program used.
+	CPUTime time.Duration
+	// MemoryPeakBytes is the peak resident set size of the program, or 0
+	// when the platform does not report it.
+	MemoryPeakBytes int64
+	// MemoryLimitExceeded is set by RunIsolated when the peak crossed
+	// Limits.MemoryBytes or the kernel OOM-killed the run.
+	MemoryLimitExceeded bool
+	// OutputLimitExceeded means the program was killed for writing more
+	// than Limits.MaxOutputBytes; Stdout and Stderr hold what came before.
+	OutputLimitExceeded bool
+}
+
+// Process is a program started by Start or StartIsolated.
+type Process struct {
+	wait func() (*Result, error)
+}
+
+// Wait blocks until the program exits and returns its result.
+func (p *Process) Wait() (*Result, error) {
+	return p.wait()
 }
 
 func Run(ctx context.Context, cmd *exec.Cmd, input string) (*Result, error) {
+	p, err := Start(ctx, cmd, input, Limits{})
+	if err != nil {
+		return nil, err
+	}
+	return p.Wait()
+}
+
+// Start runs cmd without isolation, so of limits only MaxOutputBytes is
+// enforced. As with StartIsolated, a Stdin or Stdout already set on cmd is
+// used in place of input and the captured stdout.
+func Start(ctx context.Context, cmd *exec.Cmd, input string, limits Limits) (*Process, error) {
 	if cmd == nil {
 		return nil, fmt.Errorf("cmd is nil")
 	}
@@ -23,28 +57,93 @@ func Run(ctx context.Context, cmd *exec.Cmd, input string) (*Result, error) {
 		args := append([]string{}, cmd.Args...)
 		dir := cmd.Dir
 		env := append([]string{}, cmd.Env...)
+		stdin, stdout := cmd.Stdin, cmd.Stdout
 
 		cmd = exec.CommandContext(ctx, path, args[1:]...)
 		cmd.Dir = dir
 		cmd.Env = env
+		cmd.Stdin, cmd.Stdout = stdin, stdout
 	}
-
-	stdin, err := cmd.StdinPipe()
+	rc, err := startCommand(cmd, input, limits.withDefaults().MaxOutputBytes)
 	if err != nil {
 		return nil, err
 	}
+	return &Process{wait: rc.wait}, nil
+}
+
+type runningCommand struct {
+	cmd    *exec.Cmd
+	stdout cappedBuffer
+	stderr cappedBuffer
+}
+
+// cappedBuffer keeps the first limit bytes written to it and calls exceeded
+// once when more arrive. Later writes are discarded but still reported as
+// written, so the copy from the program's pipe never stalls.
+type cappedBuffer struct {
+	buf      bytes.Buffer
+	limit    int64
+	over     bool
+	exceeded func()
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if b.over {
+		return len(p), nil
+	}
+	if room := b.limit - int64(b.buf.Len()); int64(len(p)) > room {
+		b.buf.Write(p[:room])
+		b.over = true
+		b.exceeded()
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
 
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+// startCommand starts cmd with input on stdin and stdout/stderr captured up
+// to maxOutput bytes each. A Stdin or Stdout the caller already set is left
+// alone, which is how two programs get wired to each other.
+func startCommand(cmd *exec.Cmd, input string, maxOutput int64) (*runningCommand, error) {
+	rc := &runningCommand{cmd: cmd}
+	// The copy goroutines only start writing once cmd.Start has set
+	// cmd.Process.
+	kill := func() { _ = cmd.Process.Kill() }
+	rc.stdout = cappedBuffer{limit: maxOutput, exceeded: kill}
+	rc.stderr = cappedBuffer{limit: maxOutput, exceeded: kill}
+	var stdin io.WriteCloser
+	if cmd.Stdin == nil {
+		var err error
+		stdin, err = cmd.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cmd.Stdout == nil {
+		cmd.Stdout = &rc.stdout
+	}
+	cmd.Stderr = &rc.stderr
 
-	go func() {
-		defer stdin.Close()
-		_, _ = io.WriteString(stdin, input)
-	}()
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	if stdin != nil {
+		go func() {
+			defer stdin.Close()
+			_, _ = io.WriteString(stdin, input)
+		}()
+	}
+	return rc, nil
+}
 
-	err = cmd.Run()
+func cpuTime(ps *os.ProcessState) time.Duration {
+	if ps == nil {
+		return 0
+	}
+	return ps.UserTime() + ps.SystemTime()
+}
+
+func (rc *runningCommand) wait() (*Result, error) {
+	err := rc.cmd.Wait()
 	exitCode := 0
 	if err != nil {
 		if ee, ok := err.(*exec.ExitError); ok {
@@ -55,9 +154,15 @@ func Run(ctx context.Context, cmd *exec.Cmd, input string) (*Result, error) {
 	}
 
 	res := &Result{
-		Stdout:   stdout.String(),
-		Stderr:   stderr.String(),
-		ExitCode: exitCode,
+		Stdout:              rc.stdout.buf.String(),
+		Stderr:              rc.stderr.buf.String(),
+		ExitCode:            exitCode,
+		MemoryPeakBytes:     peakRSS(rc.cmd.ProcessState),
+		CPUTime:             cpuTime(rc.cmd.ProcessState),
+		OutputLimitExceeded: rc.stdout.over || rc.stderr.over,
+	}
+	if res.OutputLimitExceeded {
+		err = fmt.Errorf("output limit exceeded")
 	}
 	return res, err
 }
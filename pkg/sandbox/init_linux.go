@@ -0,0 +1,490 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// MaybeInit turns the process into the sandbox init helper, or the seccomp
+// helper it starts, when it was re-executed by RunIsolated, and never returns
+// in that case. It must be the first call in main, before any goroutines are
+// started.
+func MaybeInit() {
+	if len(os.Args) > 0 && os.Args[0] == seccompArg0 {
+		runSeccompExec(os.Args[1:])
+	}
+	if len(os.Args) == 0 || os.Args[0] != initArg0 {
+		return
+	}
+	// Capability drops and no_new_privs are per-thread and inherited by the
+	// forked program, so everything up to the fork has to happen on one OS
+	// thread.
+	runtime.LockOSThread()
+	unix.CloseOnExec(initStatusFD)
+	status := os.NewFile(initStatusFD, "status")
+
+	st, err := runInit()
+	if err != nil {
+		st = initStatus{Error: err.Error(), ExitCode: 1}
+	}
+	_ = json.NewEncoder(status).Encode(st)
+	os.Exit(st.ExitCode)
+}
+
+// runInit prepares the namespaces, then runs the program as a child of this
+// process (pid 1 of the sandbox) so its exit status and rusage are reported
+// without the helper's own footprint mixed in.
+func runInit() (initStatus, error) {
+	raw := os.Getenv(initConfigEnv)
+	_ = os.Unsetenv(initConfigEnv)
+	var cfg initConfig
+	if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+		return initStatus{}, fmt.Errorf("invalid config: %w", err)
+	}
+
+	if err := setupRoot(cfg.Dir, append(cfg.Paths, cfg.Limit.ReadOnlyPaths...), cfg.Limit.MaxFileBytes); err != nil {
+		return initStatus{}, err
+	}
+	if err := setRlimits(cfg.Limit, cfg.LimitData, cfg.LimitProcs); err != nil {
+		return initStatus{}, err
+	}
+	if err := dropPrivileges(); err != nil {
+		return initStatus{}, err
+	}
+	if cfg.Probe {
+		return initStatus{}, nil
+	}
+	if cfg.Path == "" || len(cfg.Args) == 0 {
+		return initStatus{}, fmt.Errorf("no command to run")
+	}
+
+	// The program is traced to be stopped at PTRACE_EVENT_EXIT: at that
+	// point its own VmHWM is still readable, whereas ru_maxrss would also
+	// carry this helper's footprint across the fork. Under a seccomp profile
+	// it is also how a blocked syscall is caught.
+	path, args := cfg.Path, cfg.Args
+	filtered := cfg.Limit.Seccomp != SeccompNone
+	if filtered {
+		path = "/proc/self/exe"
+		args = append([]string{seccompArg0, string(cfg.Limit.Seccomp), cfg.Path}, cfg.Args...)
+	}
+	pid, err := syscall.ForkExec(path, args, &syscall.ProcAttr{
+		Dir:   cfg.Dir,
+		Env:   os.Environ(),
+		Files: []uintptr{0, 1, 2},
+		Sys:   &syscall.SysProcAttr{Ptrace: true},
+	})
+	if err != nil {
+		return initStatus{}, fmt.Errorf("exec %s: %w", cfg.Path, err)
+	}
+	st, err := waitProgram(pid, filtered)
+	if err == nil && filtered && !st.execed {
+		return initStatus{}, fmt.Errorf("exec %s: seccomp helper exited with status %d", cfg.Path, st.ExitCode)
+	}
+	return st, err
+}
+
+// waitProgram drives the traced program until it exits. As pid 1 every
+// orphan is reparented here too, so those are reaped along the way; the rest
+// of the namespace dies with this process.
+//
+// A filtered program is started through the seccomp helper, so its exec is
+// awaited as an event, and so is any later one, which kills it. Its threads
+// are traced as well: a blocked syscall stops whichever thread made it, and
+// one with no tracer would just fail with ENOSYS instead of being reported.
+func waitProgram(pid int, filtered bool) (initStatus, error) {
+	var peakKB int64
+	var restricted string
+	traced, execed := false, false
+	options := unix.PTRACE_O_TRACEEXIT | unix.PTRACE_O_EXITKILL
+	if filtered {
+		options |= unix.PTRACE_O_TRACEEXEC | unix.PTRACE_O_TRACESECCOMP | unix.PTRACE_O_TRACECLONE
+	}
+	for {
+		var ws syscall.WaitStatus
+		var ru syscall.Rusage
+		wpid, err := syscall.Wait4(-1, &ws, syscall.WALL, &ru)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return initStatus{}, fmt.Errorf("wait: %w", err)
+		}
+		if ws.Stopped() {
+			sig := ws.StopSignal()
+			switch {
+			case wpid == pid && sig == syscall.SIGTRAP && !traced:
+				// First stop is the SIGTRAP raised by execve under PTRACE_TRACEME.
+				traced = true
+				if err := syscall.PtraceSetOptions(pid, options); err != nil {
+					return initStatus{}, fmt.Errorf("ptrace options: %w", err)
+				}
+				sig = 0
+			case ws.TrapCause() == unix.PTRACE_EVENT_EXIT:
+				if wpid == pid {
+					peakKB = readVmHWM(pid)
+				}
+				sig = 0
+			case ws.TrapCause() == unix.PTRACE_EVENT_EXEC:
+				// The first exec is the seccomp helper starting the program.
+				// The filter only checks the path pointer, which the program
+				// could reuse, so any exec after that one is a blocked execve.
+				if execed {
+					if restricted == "" {
+						restricted = "execve"
+					}
+					_ = syscall.Kill(pid, syscall.SIGKILL)
+				}
+				execed = true
+				sig = 0
+			case ws.TrapCause() == unix.PTRACE_EVENT_SECCOMP:
+				if nr, err := unix.PtraceGetEventMsg(wpid); err == nil && restricted == "" {
+					restricted = syscallName(nr)
+				}
+				// With a fatal signal pending the kernel skips the syscall.
+				_ = syscall.Kill(pid, syscall.SIGKILL)
+				sig = 0
+			case ws.TrapCause() == unix.PTRACE_EVENT_CLONE:
+				sig = 0
+			case filtered && sig == syscall.SIGSTOP:
+				// A new thread's first stop; a program stopping itself would
+				// only hang until the wall clock anyway.
+				sig = 0
+			}
+			// Anything else is a signal-delivery stop; hand the signal back.
+			_ = syscall.PtraceCont(wpid, int(sig))
+			continue
+		}
+		if wpid != pid {
+			continue
+		}
+
+		if ws.Exited() || ws.Signaled() {
+			cpu := time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+			st := initStatus{ExitCode: ws.ExitStatus(), MaxRSSKB: peakKB, CPUTimeUs: cpu.Microseconds(), Syscall: restricted, execed: execed}
+			if st.MaxRSSKB == 0 {
+				st.MaxRSSKB = int64(ru.Maxrss)
+			}
+			if ws.Signaled() {
+				st.Signal = int(ws.Signal())
+				st.ExitCode = 128 + st.Signal
+			}
+			return st, nil
+		}
+	}
+}
+
+func readVmHWM(pid int) int64 {
+	raw, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(raw), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "VmHWM:" {
+			v, _ := strconv.ParseInt(fields[1], 10, 64)
+			return v
+		}
+	}
+	return 0
+}
+
+// While the sandbox root is put together the process's root is a scratch
+// tmpfs: the host's root stays reachable under hostRoot, and the new root is
+// assembled under newRoot. Both are gone once the new root is pivoted into.
+const (
+	hostRoot = "/.host"
+	newRoot  = "/.root"
+)
+
+// setupRoot gives the process a root of its own: a tmpfs holding read-only
+// binds of paths, dir writable at its own path, a private /tmp of up to
+// tmpBytes, a few device nodes and a /proc that only shows the new pid
+// namespace. Nothing else of the host, such as its secrets, its config or
+// other runs' dirs, exists in there.
+func setupRoot(dir string, paths []string, tmpBytes int64) error {
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("make mounts private: %w", err)
+	}
+	// The scratch tmpfs is mounted over dir and pivoted into, which moves it
+	// off dir again, so dir's own contents are still there under hostRoot.
+	scratch := dir
+	if scratch == "" {
+		scratch = os.TempDir()
+	}
+	if err := unix.Mount("tmpfs", scratch, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "size=64k,mode=0700"); err != nil {
+		return fmt.Errorf("mount scratch root: %w", err)
+	}
+	if err := os.Mkdir(scratch+hostRoot, 0700); err != nil {
+		return err
+	}
+	if err := unix.PivotRoot(scratch, scratch+hostRoot); err != nil {
+		return fmt.Errorf("pivot to scratch root: %w", err)
+	}
+	if err := unix.Chdir("/"); err != nil {
+		return err
+	}
+	if err := os.Mkdir(newRoot, 0755); err != nil {
+		return err
+	}
+	if err := unix.Mount("tmpfs", newRoot, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "size=1m,mode=0755"); err != nil {
+		return fmt.Errorf("mount root: %w", err)
+	}
+	if err := os.Mkdir(newRoot+"/tmp", 0755); err != nil {
+		return err
+	}
+	if err := unix.Mount("tmpfs", newRoot+"/tmp", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, fmt.Sprintf("size=%d,mode=1777", tmpBytes)); err != nil {
+		return fmt.Errorf("mount /tmp: %w", err)
+	}
+
+	b := &rootBinder{}
+	for _, p := range paths {
+		if err := b.bind(p); err != nil {
+			return err
+		}
+	}
+	for _, pattern := range systemEtc {
+		matches, _ := filepath.Glob(hostRoot + "/etc/" + pattern)
+		for _, m := range matches {
+			if err := b.bind(strings.TrimPrefix(m, hostRoot)); err != nil {
+				return err
+			}
+		}
+	}
+	if dir != "" {
+		if err := b.bind(dir); err != nil {
+			return err
+		}
+	}
+	if err := os.Mkdir(newRoot+"/dev", 0755); err != nil {
+		return err
+	}
+	for _, name := range []string{"null", "zero", "full", "random", "urandom"} {
+		if err := b.bind("/dev/" + name); err != nil {
+			return err
+		}
+	}
+	for name, target := range map[string]string{"fd": "/proc/self/fd", "stdin": "/proc/self/fd/0", "stdout": "/proc/self/fd/1", "stderr": "/proc/self/fd/2"} {
+		if err := os.Symlink(target, newRoot+"/dev/"+name); err != nil {
+			return err
+		}
+	}
+	// The host's /proc is still mounted here, which the kernel wants to see
+	// before it lets a user namespace mount a new one.
+	if err := os.Mkdir(newRoot+"/proc", 0555); err != nil {
+		return err
+	}
+	if err := unix.Mount("proc", newRoot+"/proc", "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("mount /proc: %w", err)
+	}
+
+	points, err := mountPoints(newRoot + "/proc/self/mountinfo")
+	if err != nil {
+		return err
+	}
+	for _, p := range points {
+		rel, ok := strings.CutPrefix(p, newRoot)
+		if !ok || (rel != "" && !strings.HasPrefix(rel, "/")) {
+			continue
+		}
+		if rel == "/tmp" || rel == "/proc" || strings.HasPrefix(rel, "/proc/") || (dir != "" && rel == dir) {
+			continue
+		}
+		if err := remountReadOnly(p); err != nil {
+			return fmt.Errorf("remount %s read-only: %w", rel, err)
+		}
+	}
+
+	// Stack the new root over the scratch one, then drop the scratch root
+	// and the host tree under it.
+	if err := unix.Chdir(newRoot); err != nil {
+		return err
+	}
+	if err := unix.PivotRoot(".", "."); err != nil {
+		return fmt.Errorf("pivot to sandbox root: %w", err)
+	}
+	if err := unix.Unmount(".", unix.MNT_DETACH); err != nil {
+		return fmt.Errorf("detach host root: %w", err)
+	}
+	if dir == "" {
+		return unix.Chdir("/")
+	}
+	return unix.Chdir(dir)
+}
+
+// rootBinder binds host paths into the new root at the same path.
+type rootBinder struct {
+	bound []string
+}
+
+// bind binds the host's path p, recreating a symlink rather than following
+// it. Missing paths are skipped, and so are paths already bound through a
+// parent, since creating their mount point would write to the host.
+func (b *rootBinder) bind(p string) error {
+	p = filepath.Clean(p)
+	for _, done := range b.bound {
+		if p == done || strings.HasPrefix(p, done+"/") {
+			return nil
+		}
+	}
+	src, dst := hostRoot+p, newRoot+p
+	fi, err := os.Lstat(src)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("bind %s: %w", p, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("bind %s: %w", p, err)
+	}
+	switch {
+	case fi.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(src)
+		if err != nil {
+			return fmt.Errorf("bind %s: %w", p, err)
+		}
+		b.bound = append(b.bound, p)
+		return os.Symlink(target, dst)
+	case fi.IsDir():
+		err = os.Mkdir(dst, 0755)
+	default:
+		var f *os.File
+		if f, err = os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644); err == nil {
+			f.Close()
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("bind %s: %w", p, err)
+	}
+	if err := unix.Mount(src, dst, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("bind %s: %w", p, err)
+	}
+	b.bound = append(b.bound, p)
+	return nil
+}
+
+// mountPoints lists the mount points in the mountinfo file at path.
+func mountPoints(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	points := make([]string, 0, 32)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		points = append(points, unescapeMountPath(fields[4]))
+	}
+	return points, sc.Err()
+}
+
+// unescapeMountPath decodes the octal escapes (\040 and friends) used in
+// /proc/self/mountinfo.
+func unescapeMountPath(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func remountReadOnly(path string) error {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return err
+	}
+	// Flags locked by the parent user namespace must be carried over or the
+	// kernel rejects the remount.
+	flags := uintptr(unix.MS_BIND | unix.MS_REMOUNT | unix.MS_RDONLY)
+	for stFlag, ms := range map[int64]uintptr{
+		unix.ST_NOSUID:     unix.MS_NOSUID,
+		unix.ST_NODEV:      unix.MS_NODEV,
+		unix.ST_NOEXEC:     unix.MS_NOEXEC,
+		unix.ST_NOATIME:    unix.MS_NOATIME,
+		unix.ST_NODIRATIME: unix.MS_NODIRATIME,
+		unix.ST_RELATIME:   unix.MS_RELATIME,
+	} {
+		if st.Flags&stFlag != 0 {
+			flags |= ms
+		}
+	}
+	return unix.Mount("", path, "", flags, "")
+}
+
+type rlimitValue struct {
+	resource int
+	soft     uint64
+	hard     uint64
+}
+
+func setRlimits(l Limits, data, procs bool) error {
+	cpuSec := uint64((l.CPUTime + time.Second - 1) / time.Second)
+	limits := []rlimitValue{
+		{unix.RLIMIT_CPU, cpuSec, cpuSec + 1},
+		{unix.RLIMIT_FSIZE, uint64(l.MaxFileBytes), uint64(l.MaxFileBytes)},
+		{unix.RLIMIT_NOFILE, uint64(l.MaxOpenFiles), uint64(l.MaxOpenFiles)},
+		{unix.RLIMIT_CORE, 0, 0},
+	}
+	if data {
+		limits = append(limits, rlimitValue{unix.RLIMIT_DATA, uint64(l.hardMemoryCap()), uint64(l.hardMemoryCap())})
+	}
+	if procs {
+		// Counted per user namespace, so this helper and the program's
+		// processes and threads share it, as they would share pids.max.
+		limits = append(limits, rlimitValue{unix.RLIMIT_NPROC, uint64(l.MaxProcs), uint64(l.MaxProcs)})
+	}
+	for _, rl := range limits {
+		if err := unix.Setrlimit(rl.resource, &unix.Rlimit{Cur: rl.soft, Max: rl.hard}); err != nil {
+			return fmt.Errorf("setrlimit %d: %w", rl.resource, err)
+		}
+	}
+	return nil
+}
+
+// dropPrivileges empties the capability bounding set so the program gets no
+// capabilities across execve even though it runs as uid 0 in its namespace.
+func dropPrivileges() error {
+	lastCap := 40
+	if raw, err := os.ReadFile("/proc/sys/kernel/cap_last_cap"); err == nil {
+		if v, err := strconv.Atoi(strings.TrimSpace(string(raw))); err == nil {
+			lastCap = v
+		}
+	}
+	for c := 0; c <= lastCap; c++ {
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(c), 0, 0, 0); err != nil && err != unix.EINVAL {
+			return fmt.Errorf("drop capability %d: %w", c, err)
+		}
+	}
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("set no_new_privs: %w", err)
+	}
+	return nil
+}
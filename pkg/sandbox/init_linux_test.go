@@ -0,0 +1,60 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"testing"
+)
+
+// TestWaitProgramKillsLaterExec runs sh in place of the seccomp helper: its
+// exec of the next command is the program starting, and any exec the
+// program makes after that is one a reused path pointer would have let
+// through the filter.
+func TestWaitProgramKillsLaterExec(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not found")
+	}
+	tests := []struct {
+		name       string
+		script     string
+		wantSignal syscall.Signal
+		wantCall   string
+	}{
+		{"single exec", `exec "$0" -c 'exit 0'`, 0, ""},
+		{"second exec", `exec "$0" -c 'exec "$0" -c "exit 0"' "$0"`, syscall.SIGKILL, "execve"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The tracer is the thread that forked the program.
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+
+			pid, err := syscall.ForkExec(sh, []string{"sh", "-c", tt.script, sh}, &syscall.ProcAttr{
+				Env:   os.Environ(),
+				Files: []uintptr{0, 1, 2},
+				Sys:   &syscall.SysProcAttr{Ptrace: true},
+			})
+			if err != nil {
+				t.Fatalf("start: %v", err)
+			}
+			st, err := waitProgram(pid, true)
+			if err != nil {
+				t.Fatalf("wait: %v", err)
+			}
+			if !st.execed {
+				t.Errorf("execed = false, want true")
+			}
+			if st.Syscall != tt.wantCall {
+				t.Errorf("Syscall = %q, want %q", st.Syscall, tt.wantCall)
+			}
+			if syscall.Signal(st.Signal) != tt.wantSignal {
+				t.Errorf("Signal = %v, want %v", syscall.Signal(st.Signal), tt.wantSignal)
+			}
+		})
+	}
+}
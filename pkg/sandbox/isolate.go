@@ -0,0 +1,116 @@
+package sandbox
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrUnsupported is returned by RunIsolated when the host cannot provide
+// namespace isolation (non-Linux hosts, or user namespaces disabled).
+var ErrUnsupported = errors.New("sandbox isolation is not supported on this host")
+
+// ErrSetup is returned when the sandbox could not be prepared for a run; the
+// submitted program was never executed.
+var ErrSetup = errors.New("sandbox setup failed")
+
+// ErrRestrictedSyscall is wrapped by the error of a run that was killed for
+// making a syscall its seccomp profile does not allow; the error names the
+// syscall.
+var ErrRestrictedSyscall = errors.New("restricted function")
+
+// systemPaths are bound read-only into every sandbox root: they hold the
+// toolchains and runtimes and the libraries those load. Nothing else of the
+// host filesystem exists in there. JUDGE_SANDBOX_PATHS adds more,
+// colon-separated, for toolchains installed elsewhere.
+var systemPaths = []string{"/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/libx32"}
+
+// systemEtc are the entries of /etc bound as well, as glob patterns: the
+// dynamic loader's config, the alternatives and JDK config some toolchains
+// are reached through, and user and time zone lookups.
+var systemEtc = []string{"ld.so.cache", "ld.so.conf", "ld.so.conf.d", "alternatives", "java-*", "passwd", "group", "nsswitch.conf", "localtime"}
+
+// SeccompProfile names the syscall allowlist a program runs under. Language
+// runtimes need different sets: the Go runtime polls and signals its own
+// threads, CPython lists directories to import modules. The JVM's profile is
+// a deny-list instead.
+type SeccompProfile string
+
+const (
+	// SeccompNone installs no filter.
+	SeccompNone SeccompProfile = ""
+	// SeccompNative is for C, C++ and Rust binaries linked against glibc.
+	SeccompNative SeccompProfile = "native"
+	SeccompGo     SeccompProfile = "go"
+	SeccompPython SeccompProfile = "python"
+	SeccompNode   SeccompProfile = "node"
+	SeccompJVM    SeccompProfile = "jvm"
+)
+
+// Limits bounds the resources of a single isolated run. Zero fields fall back
+// to DefaultLimits.
+type Limits struct {
+	MemoryBytes int64 `json:"memoryBytes"`
+	MaxProcs    int   `json:"maxProcs"`
+	// CPUTime is enforced through RLIMIT_CPU, rounded up to whole seconds;
+	// callers compare Result.CPUTime for the exact limit.
+	CPUTime      time.Duration `json:"cpuTime"`
+	CPUQuota     float64       `json:"cpuQuota"`
+	MaxFileBytes int64         `json:"maxFileBytes"`
+	MaxOpenFiles int           `json:"maxOpenFiles"`
+	// MaxOutputBytes caps what is kept of stdout and of stderr each; the
+	// program is killed as soon as either goes over.
+	MaxOutputBytes int64 `json:"maxOutputBytes"`
+	// Seccomp is the syscall filter of the program. It is only enforced
+	// by RunIsolated; a blocked syscall kills the run.
+	Seccomp SeccompProfile `json:"seccomp,omitempty"`
+	// ReadOnlyPaths are host paths this run alone may read, bound at the
+	// same path into its root; RunIsolated shows nothing else besides the
+	// system paths and cmd.Dir.
+	ReadOnlyPaths []string `json:"readOnlyPaths,omitempty"`
+}
+
+// hardMemoryCap is the bound the kernel enforces. It sits above MemoryBytes
+// so a program that crosses the limit keeps running long enough for its peak
+// to be measured; the verdict is taken from the peak, not from however the
+// failed allocation happened to surface.
+func (l Limits) hardMemoryCap() int64 {
+	return 2 * l.MemoryBytes
+}
+
+func DefaultLimits() Limits {
+	return Limits{
+		MemoryBytes:    256 << 20,
+		MaxProcs:       64,
+		CPUTime:        10 * time.Second,
+		CPUQuota:       1,
+		MaxFileBytes:   64 << 20,
+		MaxOpenFiles:   64,
+		MaxOutputBytes: 16 << 20,
+	}
+}
+
+func (l Limits) withDefaults() Limits {
+	def := DefaultLimits()
+	if l.MemoryBytes <= 0 {
+		l.MemoryBytes = def.MemoryBytes
+	}
+	if l.MaxProcs <= 0 {
+		l.MaxProcs = def.MaxProcs
+	}
+	if l.CPUTime <= 0 {
+		l.CPUTime = def.CPUTime
+	}
+	if l.CPUQuota <= 0 {
+		l.CPUQuota = def.CPUQuota
+	}
+	if l.MaxFileBytes <= 0 {
+		l.MaxFileBytes = def.MaxFileBytes
+	}
+	if l.MaxOpenFiles <= 0 {
+		l.MaxOpenFiles = def.MaxOpenFiles
+	}
+	if l.MaxOutputBytes <= 0 {
+		l.MaxOutputBytes = def.MaxOutputBytes
+	}
+	return l
+}
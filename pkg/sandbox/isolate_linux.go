@@ -0,0 +1,317 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	initArg0      = "judgo-sandbox-init"
+	initConfigEnv = "_JUDGO_SANDBOX_CONFIG"
+
+	// initStatusFD is where the init helper reports initStatus; it is the
+	// first of cmd.ExtraFiles.
+	initStatusFD = 3
+
+	// helperMemoryReserve covers the init helper's own charge to the run
+	// cgroup.
+	helperMemoryReserve = 32 << 20
+
+	// nobodyID is the host uid/gid sandboxed programs run as when the API
+	// itself runs as root.
+	nobodyID = 65534
+)
+
+type initConfig struct {
+	Path  string   `json:"path"`
+	Args  []string `json:"args"`
+	Dir   string   `json:"dir"`
+	Limit Limits   `json:"limits"`
+	// LimitData is set when no memory cgroup is available and RLIMIT_DATA
+	// has to stand in for memory.max. RLIMIT_AS is not usable: the Go and JVM
+	// runtimes reserve far more address space than they ever commit.
+	LimitData bool `json:"limitData"`
+	// LimitProcs is set when no pids cgroup is available and RLIMIT_NPROC
+	// has to stand in for pids.max.
+	LimitProcs bool `json:"limitProcs"`
+	Probe      bool `json:"probe"`
+	// Paths are the host paths bound read-only into the root besides the
+	// run's own ReadOnlyPaths.
+	Paths []string `json:"paths,omitempty"`
+}
+
+// initStatus is written by the init helper once the program has exited, or
+// as soon as setup fails.
+type initStatus struct {
+	Error    string `json:"error,omitempty"`
+	ExitCode int    `json:"exitCode"`
+	Signal   int    `json:"signal,omitempty"`
+	MaxRSSKB int64  `json:"maxRssKb"`
+	// CPUTimeUs is the program's user plus system time.
+	CPUTimeUs int64 `json:"cpuTimeUs"`
+	// Syscall names the syscall the program was killed for under its
+	// seccomp profile.
+	Syscall string `json:"syscall,omitempty"`
+
+	// execed is set once the seccomp helper has exec'd the program.
+	execed bool
+}
+
+var (
+	probeOnce sync.Once
+	probeErr  error
+)
+
+// Supported reports whether RunIsolated can be used on this host. The first
+// call starts a probe run of the init helper, so the result reflects what the
+// kernel actually permits rather than what the build targets.
+func Supported() bool {
+	return SupportError() == nil
+}
+
+// SupportError returns the reason isolation is unavailable, or nil.
+func SupportError() error {
+	probeOnce.Do(func() {
+		probeErr = probe()
+	})
+	return probeErr
+}
+
+func probe() error {
+	dir, err := os.MkdirTemp("", "judgo-sandbox-probe-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	if err := PrepareWorkDir(dir); err != nil {
+		return err
+	}
+	p, err := start(context.Background(), initConfig{Dir: dir, Limit: DefaultLimits(), Paths: rootPaths(), Probe: true}, nil, "")
+	if err == nil {
+		_, err = p.Wait()
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	return nil
+}
+
+// PrepareWorkDir makes dir usable from inside the sandbox. When the API runs
+// as root the sandboxed program is mapped to nobody, so the directory and its
+// contents are handed over to that user.
+func PrepareWorkDir(dir string) error {
+	if os.Geteuid() != 0 {
+		return nil
+	}
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, nobodyID, nobodyID)
+	})
+}
+
+// RunIsolated runs cmd inside fresh user, mount, pid, network, ipc and uts
+// namespaces, with cgroup v2 limits when a delegated cgroup is available and
+// rlimits otherwise. The program's root is built from scratch: the system
+// paths read-only, cmd.Dir writable at its own path, and a private /tmp.
+func RunIsolated(ctx context.Context, cmd *exec.Cmd, input string, limits Limits) (*Result, error) {
+	p, err := StartIsolated(ctx, cmd, input, limits)
+	if err != nil {
+		return nil, err
+	}
+	return p.Wait()
+}
+
+// StartIsolated starts cmd the way RunIsolated runs it. A Stdin or Stdout
+// already set on cmd is handed to the program in place of input and the
+// captured stdout; *os.File pipes are passed through without copying.
+func StartIsolated(ctx context.Context, cmd *exec.Cmd, input string, limits Limits) (*Process, error) {
+	if cmd == nil {
+		return nil, fmt.Errorf("cmd is nil")
+	}
+	if cmd.Err != nil {
+		return nil, cmd.Err
+	}
+	if err := SupportError(); err != nil {
+		return nil, err
+	}
+	cfg := initConfig{
+		Path:  cmd.Path,
+		Args:  append([]string{}, cmd.Args...),
+		Dir:   cmd.Dir,
+		Limit: limits.withDefaults(),
+		Paths: rootPaths(),
+	}
+	return start(ctx, cfg, cmd, input)
+}
+
+// start launches the init helper for cfg. cmd supplies the environment and
+// any caller-provided stdio; it is nil for the probe.
+func start(ctx context.Context, cfg initConfig, cmd *exec.Cmd, input string) (*Process, error) {
+	cg, err := newRunCgroup(cfg.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSetup, err)
+	}
+	cfg.LimitData = cg == nil || !cg.memory
+	cfg.LimitProcs = cg == nil || !cg.pids
+	cleanup := func() {
+		if cg != nil {
+			cg.close()
+		}
+	}
+
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	statusR, statusW, err := os.Pipe()
+	if err != nil {
+		cleanup()
+		return nil, fmt.Errorf("%w: %v", ErrSetup, err)
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	helper := exec.CommandContext(ctx, "/proc/self/exe")
+	helper.Args = []string{initArg0}
+	helper.Dir = cfg.Dir
+	env := DefaultEnv(cfg.Dir)
+	if cmd != nil {
+		if cmd.Env != nil {
+			env = cmd.Env
+		}
+		helper.Stdin = cmd.Stdin
+		helper.Stdout = cmd.Stdout
+	}
+	helper.Env = append(append([]string{}, env...), initConfigEnv+"="+string(raw))
+	helper.ExtraFiles = []*os.File{statusW}
+	helper.SysProcAttr = namespaceAttr()
+	if cg != nil {
+		helper.SysProcAttr.UseCgroupFD = true
+		helper.SysProcAttr.CgroupFD = cg.fd
+	}
+
+	rc, err := startCommand(helper, input, cfg.Limit.MaxOutputBytes)
+	statusW.Close()
+	if err != nil {
+		statusR.Close()
+		cleanup()
+		return nil, fmt.Errorf("%w: %v", ErrSetup, err)
+	}
+	return &Process{wait: func() (*Result, error) {
+		defer cleanup()
+		defer statusR.Close()
+		res, runErr := rc.wait()
+		rawStatus, _ := io.ReadAll(statusR)
+		return finish(cfg, cg, res, runErr, rawStatus)
+	}}, nil
+}
+
+// finish combines the helper's own exit with the status it reported for the
+// program.
+func finish(cfg initConfig, cg *runCgroup, res *Result, runErr error, rawStatus []byte) (*Result, error) {
+	var st initStatus
+	if res != nil && res.OutputLimitExceeded {
+		// The helper was killed mid-run, so there is no status to read.
+		res.MemoryPeakBytes = 0
+		return res, runErr
+	}
+	if len(rawStatus) == 0 {
+		// The helper was killed (deadline, cgroup OOM) before it could report.
+		if runErr == nil {
+			runErr = fmt.Errorf("%w: init helper exited without status", ErrSetup)
+		}
+		if res != nil {
+			res.MemoryPeakBytes = 0
+			res.MemoryLimitExceeded = cg != nil && cg.oomKilled()
+		}
+		return res, runErr
+	}
+	if err := json.Unmarshal(rawStatus, &st); err != nil {
+		return res, fmt.Errorf("%w: invalid status: %v", ErrSetup, err)
+	}
+	if st.Error != "" {
+		return res, fmt.Errorf("%w: %s", ErrSetup, st.Error)
+	}
+
+	res.ExitCode = st.ExitCode
+	res.MemoryPeakBytes = st.MaxRSSKB * 1024
+	res.CPUTime = time.Duration(st.CPUTimeUs) * time.Microsecond
+	res.MemoryLimitExceeded = res.MemoryPeakBytes > cfg.Limit.MemoryBytes || (cg != nil && cg.oomKilled())
+	if st.Syscall != "" {
+		return res, fmt.Errorf("%w: %s", ErrRestrictedSyscall, st.Syscall)
+	}
+	if st.ExitCode != 0 {
+		if st.Signal != 0 {
+			return res, fmt.Errorf("killed by signal: %v", syscall.Signal(st.Signal))
+		}
+		return res, fmt.Errorf("exit status %d", st.ExitCode)
+	}
+	return res, nil
+}
+
+// rootPaths lists the host paths every sandbox root gets.
+func rootPaths() []string {
+	paths := append([]string{}, systemPaths...)
+	for _, p := range filepath.SplitList(os.Getenv("JUDGE_SANDBOX_PATHS")) {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(p); err == nil {
+			paths = append(paths, abs)
+		}
+	}
+	return paths
+}
+
+// DefaultEnv is the environment given to sandboxed programs when the caller
+// does not set one.
+func DefaultEnv(dir string) []string {
+	path := os.Getenv("PATH")
+	if path == "" {
+		path = "/usr/local/bin:/usr/bin:/bin"
+	}
+	return []string{
+		"PATH=" + path,
+		"HOME=" + dir,
+		"TMPDIR=" + dir,
+		"LANG=C.UTF-8",
+		"PYTHONDONTWRITEBYTECODE=1",
+	}
+}
+
+func namespaceAttr() *syscall.SysProcAttr {
+	hostUID, hostGID := os.Getuid(), os.Getgid()
+	if hostUID == 0 {
+		hostUID, hostGID = nobodyID, nobodyID
+	}
+	return &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER |
+			syscall.CLONE_NEWNS |
+			syscall.CLONE_NEWPID |
+			syscall.CLONE_NEWNET |
+			syscall.CLONE_NEWIPC |
+			syscall.CLONE_NEWUTS,
+		UidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: hostUID, Size: 1}},
+		GidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: hostGID, Size: 1}},
+		GidMappingsEnableSetgroups: false,
+		// Switch to the mapped root explicitly; without it a root parent keeps
+		// its unmapped host uid and the child ends up with no capabilities.
+		Credential: &syscall.Credential{Uid: 0, Gid: 0, NoSetGroups: true},
+		Pdeathsig:  syscall.SIGKILL,
+	}
+}
@@ -0,0 +1,40 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"context"
+	"os"
+	"os/exec"
+)
+
+// MaybeInit is a no-op on hosts without namespace isolation.
+func MaybeInit() {}
+
+func Supported() bool {
+	return false
+}
+
+func SupportError() error {
+	return ErrUnsupported
+}
+
+func PrepareWorkDir(dir string) error {
+	return nil
+}
+
+func RunIsolated(ctx context.Context, cmd *exec.Cmd, input string, limits Limits) (*Result, error) {
+	return nil, ErrUnsupported
+}
+
+func StartIsolated(ctx context.Context, cmd *exec.Cmd, input string, limits Limits) (*Process, error) {
+	return nil, ErrUnsupported
+}
+
+func DefaultEnv(dir string) []string {
+	return append(os.Environ(), "PYTHONDONTWRITEBYTECODE=1")
+}
+
+func PidsCgroup() bool {
+	return false
+}
@@ -0,0 +1,260 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// seccompArg0 marks the re-exec of the binary that installs a seccomp filter
+// on itself and then execs the program, which inherits the filter. The init
+// helper starts it in place of the program when a profile is set; that keeps
+// the filter out of the helper and needs no code between fork and exec.
+const seccompArg0 = "judgo-sandbox-seccomp"
+
+// baseSyscalls are allowed under every profile: memory, reading and writing
+// open files, time, signals and threads. Names missing on the running
+// architecture are skipped.
+var baseSyscalls = []string{
+	"read", "write", "readv", "writev", "pread64", "pwrite64", "lseek", "close",
+	"fstat", "newfstatat", "statx", "stat", "lstat", "openat", "open",
+	"readlink", "readlinkat", "access", "faccessat", "faccessat2",
+	"fcntl", "ioctl", "dup", "dup2", "dup3", "getcwd", "poll", "ppoll",
+	"mmap", "munmap", "mprotect", "mremap", "madvise", "brk",
+	"rt_sigaction", "rt_sigprocmask", "rt_sigreturn", "sigaltstack",
+	"futex", "sched_yield", "sched_getaffinity", "set_tid_address", "set_robust_list", "rseq",
+	"arch_prctl", "prlimit64", "getrlimit", "getrandom", "uname",
+	"getpid", "gettid", "getppid", "getuid", "geteuid", "getgid", "getegid",
+	"clock_gettime", "clock_getres", "clock_nanosleep", "nanosleep", "gettimeofday", "time",
+	"exit", "exit_group",
+}
+
+var seccompProfiles = map[SeccompProfile][]string{
+	SeccompNative: baseSyscalls,
+	// The Go runtime parks threads in epoll, wakes them through an eventfd or
+	// a pipe, may probe memory and arm per-thread timers, and names its
+	// mappings with prctl. Without capabilities prctl cannot grant anything.
+	SeccompGo: append(append([]string{}, baseSyscalls...),
+		"epoll_create1", "epoll_ctl", "epoll_pwait", "epoll_wait", "eventfd2", "pipe2",
+		"mincore", "timer_create", "timer_settime", "timer_delete", "prctl",
+	),
+	// CPython lists directories on import and sleeps in select. A warm
+	// runtime reads its own rusage to report its start-up time.
+	SeccompPython: append(append([]string{}, baseSyscalls...),
+		"getdents64", "getdents", "select", "pselect6", "sysinfo", "getrusage",
+	),
+	// Node runs its event loop on epoll, reads its own capabilities and
+	// memory size at start-up, and V8 allocates a memory protection key.
+	SeccompNode: append(append([]string{}, baseSyscalls...),
+		"epoll_create1", "epoll_ctl", "epoll_pwait", "epoll_wait", "eventfd2", "pipe2",
+		"capget", "sysinfo", "pkey_alloc",
+	),
+}
+
+// seccompDenyProfiles are filtered the other way round: anything but the
+// listed syscalls is allowed. The JVM's syscall use is too wide and changes
+// too much between versions to list, so it is only kept from the kernel's
+// privileged and cross-process interfaces. Exec, kill and clone are
+// restricted as under every profile.
+var seccompDenyProfiles = map[SeccompProfile][]string{
+	SeccompJVM: {
+		"ptrace", "process_vm_readv", "process_vm_writev", "kcmp",
+		"pidfd_open", "pidfd_getfd", "pidfd_send_signal", "tkill", "fork", "vfork", "execveat",
+		"mount", "umount2", "pivot_root", "chroot", "unshare", "setns",
+		"open_tree", "move_mount", "fsopen", "fsmount", "mount_setattr",
+		"name_to_handle_at", "open_by_handle_at", "fanotify_init",
+		"bpf", "perf_event_open", "userfaultfd", "io_uring_setup", "io_uring_enter", "io_uring_register",
+		"keyctl", "add_key", "request_key",
+		"init_module", "finit_module", "delete_module", "kexec_load", "reboot",
+		"swapon", "swapoff", "acct", "quotactl", "syslog", "vhangup", "iopl", "ioperm",
+		"settimeofday", "clock_settime", "adjtimex", "sethostname", "setdomainname",
+	},
+}
+
+// Offsets into struct seccomp_data. Arguments are 64 bits; the low word
+// comes first on the little-endian architectures seccomp is supported on.
+const (
+	seccompNrOffset   = 0
+	seccompArchOffset = 4
+	seccompArgsOffset = 16
+)
+
+// seccompFilter builds the BPF program for profile. On top of the profile's
+// list, the program may exec only the path at execPath (the pointer the
+// helper passes to execve), signal only itself (pid) and clone only threads.
+// Any other syscall, or under a deny profile any listed one, stops the
+// process for the tracer with its number as the return data, which is how
+// the init helper learns what to report.
+func seccompFilter(profile SeccompProfile, execPath uintptr, pid int) ([]unix.SockFilter, error) {
+	names, ok := seccompProfiles[profile]
+	denied, deny := seccompDenyProfiles[profile]
+	if !ok && !deny {
+		return nil, fmt.Errorf("unknown seccomp profile %q", profile)
+	}
+	if seccompAuditArch == 0 {
+		return nil, fmt.Errorf("seccomp filtering is not supported on %s", runtime.GOARCH)
+	}
+
+	f := []unix.SockFilter{
+		bpfLoad(seccompArchOffset),
+		bpfJump(unix.BPF_JEQ, seccompAuditArch, 1, 0),
+		bpfRet(unix.SECCOMP_RET_KILL_PROCESS),
+		bpfLoad(seccompNrOffset),
+	}
+	if seccompForeignABI != 0 {
+		// Syscalls of another ABI (x32 on amd64) have their own numbers.
+		f = append(f, bpfJump(unix.BPF_JSET, seccompForeignABI, 0, 1), bpfRet(unix.SECCOMP_RET_KILL_PROCESS))
+	}
+	for _, name := range names {
+		if nr, ok := syscallNumber(name); ok {
+			f = append(f, bpfJump(unix.BPF_JEQ, uint32(nr), 0, 1), bpfRet(unix.SECCOMP_RET_ALLOW))
+		}
+	}
+	for _, name := range denied {
+		if nr, ok := syscallNumber(name); ok {
+			f = append(f, bpfJump(unix.BPF_JEQ, uint32(nr), 0, 1), bpfRet(unix.SECCOMP_RET_TRACE|uint32(nr)))
+		}
+	}
+	f = appendArgEquals(f, "execve", 0, uint64(execPath), true)
+	f = appendArgEquals(f, "kill", 0, uint64(pid), false)
+	f = appendArgEquals(f, "tgkill", 0, uint64(pid), false)
+	if nr, ok := syscallNumber("clone"); ok {
+		f = append(f,
+			bpfJump(unix.BPF_JEQ, uint32(nr), 0, 4),
+			bpfLoad(seccompArgsOffset),
+			bpfJump(unix.BPF_JSET, unix.CLONE_THREAD, 0, 1),
+			bpfRet(unix.SECCOMP_RET_ALLOW),
+			bpfRet(unix.SECCOMP_RET_TRACE|uint32(nr)),
+		)
+	}
+	if nr, ok := syscallNumber("clone3"); ok {
+		// clone3 passes its flags in memory the filter cannot read. ENOSYS
+		// makes libc fall back to clone, where they can be checked.
+		f = append(f, bpfJump(unix.BPF_JEQ, uint32(nr), 0, 1), bpfRet(unix.SECCOMP_RET_ERRNO|uint32(unix.ENOSYS)))
+	}
+	if deny {
+		return append(f, bpfRet(unix.SECCOMP_RET_ALLOW)), nil
+	}
+	// The accumulator still holds the syscall number here.
+	f = append(f,
+		unix.SockFilter{Code: unix.BPF_ALU | unix.BPF_OR | unix.BPF_K, K: unix.SECCOMP_RET_TRACE},
+		unix.SockFilter{Code: unix.BPF_RET | unix.BPF_A},
+	)
+	return f, nil
+}
+
+// appendArgEquals allows the syscall name only when argument arg equals
+// value; wide compares all 64 bits, otherwise the argument is an int and only
+// its low word is defined.
+func appendArgEquals(f []unix.SockFilter, name string, arg int, value uint64, wide bool) []unix.SockFilter {
+	nr, ok := syscallNumber(name)
+	if !ok {
+		return f
+	}
+	off := uint32(seccompArgsOffset + 8*arg)
+	if !wide {
+		return append(f,
+			bpfJump(unix.BPF_JEQ, uint32(nr), 0, 4),
+			bpfLoad(off),
+			bpfJump(unix.BPF_JEQ, uint32(value), 0, 1),
+			bpfRet(unix.SECCOMP_RET_ALLOW),
+			bpfRet(unix.SECCOMP_RET_TRACE|uint32(nr)),
+		)
+	}
+	return append(f,
+		bpfJump(unix.BPF_JEQ, uint32(nr), 0, 6),
+		bpfLoad(off),
+		bpfJump(unix.BPF_JEQ, uint32(value), 0, 3),
+		bpfLoad(off+4),
+		bpfJump(unix.BPF_JEQ, uint32(value>>32), 0, 1),
+		bpfRet(unix.SECCOMP_RET_ALLOW),
+		bpfRet(unix.SECCOMP_RET_TRACE|uint32(nr)),
+	)
+}
+
+func bpfLoad(off uint32) unix.SockFilter {
+	return unix.SockFilter{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: off}
+}
+
+func bpfJump(op uint16, k uint32, jt, jf uint8) unix.SockFilter {
+	return unix.SockFilter{Code: unix.BPF_JMP | op | unix.BPF_K, Jt: jt, Jf: jf, K: k}
+}
+
+func bpfRet(k uint32) unix.SockFilter {
+	return unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: k}
+}
+
+func syscallNumber(name string) (uintptr, bool) {
+	if nr, ok := commonSyscalls[name]; ok {
+		return nr, true
+	}
+	nr, ok := archSyscalls[name]
+	return nr, ok
+}
+
+// syscallName names syscall nr for a restricted function error.
+func syscallName(nr uint) string {
+	for _, table := range []map[string]uintptr{commonSyscalls, archSyscalls} {
+		for name, n := range table {
+			if uint(n) == nr {
+				return name
+			}
+		}
+	}
+	return fmt.Sprintf("syscall %d", nr)
+}
+
+// runSeccompExec is the body of the seccomp helper. args are the profile,
+// the program path and its argv. It only returns by exiting: if the exec
+// fails the init helper sees the program exit without having been exec'd.
+func runSeccompExec(args []string) {
+	runtime.LockOSThread()
+	if len(args) < 3 {
+		fmt.Fprintln(os.Stderr, "sandbox: seccomp helper needs a profile and a command")
+		os.Exit(127)
+	}
+	err := execFiltered(SeccompProfile(args[0]), args[1], args[2:])
+	fmt.Fprintf(os.Stderr, "sandbox: exec %s: %v\n", args[1], err)
+	os.Exit(127)
+}
+
+// execFiltered installs the profile's filter on the calling thread and execs
+// path. The filter only lets execve through for the exact path pointer built
+// here; a program that maps its own path at that address gets past it, and
+// is killed by the init helper when the exec happens.
+func execFiltered(profile SeccompProfile, path string, argv []string) error {
+	pathp, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return err
+	}
+	argvp, err := syscall.SlicePtrFromStrings(argv)
+	if err != nil {
+		return err
+	}
+	envp, err := syscall.SlicePtrFromStrings(os.Environ())
+	if err != nil {
+		return err
+	}
+	filter, err := seccompFilter(profile, uintptr(unsafe.Pointer(pathp)), os.Getpid())
+	if err != nil {
+		return err
+	}
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("set no_new_privs: %w", err)
+	}
+	prog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	if _, _, errno := unix.RawSyscall(unix.SYS_SECCOMP, unix.SECCOMP_SET_MODE_FILTER, 0, uintptr(unsafe.Pointer(&prog))); errno != 0 {
+		return fmt.Errorf("install seccomp filter: %w", errno)
+	}
+	_, _, errno := unix.RawSyscall(unix.SYS_EXECVE,
+		uintptr(unsafe.Pointer(pathp)),
+		uintptr(unsafe.Pointer(&argvp[0])),
+		uintptr(unsafe.Pointer(&envp[0])))
+	return errno
+}
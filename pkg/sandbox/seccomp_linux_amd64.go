@@ -0,0 +1,43 @@
+package sandbox
+
+import "golang.org/x/sys/unix"
+
+const (
+	seccompAuditArch = unix.AUDIT_ARCH_X86_64
+	// seccompForeignABI is __X32_SYSCALL_BIT.
+	seccompForeignABI = 0x40000000
+)
+
+// archSyscalls are the syscalls only amd64 has: mostly legacy ones next to
+// their *at and newer replacements.
+var archSyscalls = map[string]uintptr{
+	// Allowed by a profile.
+	"access":     unix.SYS_ACCESS,
+	"arch_prctl": unix.SYS_ARCH_PRCTL,
+	"dup2":       unix.SYS_DUP2,
+	"epoll_wait": unix.SYS_EPOLL_WAIT,
+	"getdents":   unix.SYS_GETDENTS,
+	"lstat":      unix.SYS_LSTAT,
+	"open":       unix.SYS_OPEN,
+	"poll":       unix.SYS_POLL,
+	"readlink":   unix.SYS_READLINK,
+	"select":     unix.SYS_SELECT,
+	"stat":       unix.SYS_STAT,
+	"time":       unix.SYS_TIME,
+
+	// Never allowed.
+	"chmod":   unix.SYS_CHMOD,
+	"chown":   unix.SYS_CHOWN,
+	"fork":    unix.SYS_FORK,
+	"ioperm":  unix.SYS_IOPERM,
+	"iopl":    unix.SYS_IOPL,
+	"link":    unix.SYS_LINK,
+	"mkdir":   unix.SYS_MKDIR,
+	"mknod":   unix.SYS_MKNOD,
+	"pipe":    unix.SYS_PIPE,
+	"rename":  unix.SYS_RENAME,
+	"rmdir":   unix.SYS_RMDIR,
+	"symlink": unix.SYS_SYMLINK,
+	"unlink":  unix.SYS_UNLINK,
+	"vfork":   unix.SYS_VFORK,
+}
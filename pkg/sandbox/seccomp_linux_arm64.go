@@ -0,0 +1,12 @@
+package sandbox
+
+import "golang.org/x/sys/unix"
+
+const (
+	seccompAuditArch  = unix.AUDIT_ARCH_AARCH64
+	seccompForeignABI = 0
+)
+
+// archSyscalls is empty: arm64 only has the *at and newer syscalls, all of
+// which are in commonSyscalls.
+var archSyscalls = map[string]uintptr{}
@@ -0,0 +1,15 @@
+//go:build linux && !amd64 && !arm64
+
+package sandbox
+
+// Seccomp profiles are only defined for amd64 and arm64; elsewhere a run
+// with a profile fails to start.
+const (
+	seccompAuditArch  = 0
+	seccompForeignABI = 0
+)
+
+var (
+	commonSyscalls = map[string]uintptr{}
+	archSyscalls   = map[string]uintptr{}
+)
@@ -0,0 +1,219 @@
+//go:build linux && (amd64 || arm64)
+
+package sandbox
+
+import "golang.org/x/sys/unix"
+
+// commonSyscalls numbers the syscalls the profiles refer to, and the ones a
+// submission is most likely to be stopped for so they can be reported by
+// name. Both supported architectures have these.
+var commonSyscalls = map[string]uintptr{
+	// Allowed by a profile, or under a condition.
+	"brk":               unix.SYS_BRK,
+	"clock_getres":      unix.SYS_CLOCK_GETRES,
+	"clock_gettime":     unix.SYS_CLOCK_GETTIME,
+	"clock_nanosleep":   unix.SYS_CLOCK_NANOSLEEP,
+	"clone":             unix.SYS_CLONE,
+	"clone3":            unix.SYS_CLONE3,
+	"close":             unix.SYS_CLOSE,
+	"dup":               unix.SYS_DUP,
+	"dup3":              unix.SYS_DUP3,
+	"epoll_create1":     unix.SYS_EPOLL_CREATE1,
+	"epoll_ctl":         unix.SYS_EPOLL_CTL,
+	"epoll_pwait":       unix.SYS_EPOLL_PWAIT,
+	"eventfd2":          unix.SYS_EVENTFD2,
+	"execve":            unix.SYS_EXECVE,
+	"exit":              unix.SYS_EXIT,
+	"exit_group":        unix.SYS_EXIT_GROUP,
+	"faccessat":         unix.SYS_FACCESSAT,
+	"faccessat2":        unix.SYS_FACCESSAT2,
+	"fcntl":             unix.SYS_FCNTL,
+	"fstat":             unix.SYS_FSTAT,
+	"futex":             unix.SYS_FUTEX,
+	"getcwd":            unix.SYS_GETCWD,
+	"getdents64":        unix.SYS_GETDENTS64,
+	"getegid":           unix.SYS_GETEGID,
+	"geteuid":           unix.SYS_GETEUID,
+	"getgid":            unix.SYS_GETGID,
+	"getpid":            unix.SYS_GETPID,
+	"getppid":           unix.SYS_GETPPID,
+	"getrandom":         unix.SYS_GETRANDOM,
+	"getrlimit":         unix.SYS_GETRLIMIT,
+	"gettid":            unix.SYS_GETTID,
+	"gettimeofday":      unix.SYS_GETTIMEOFDAY,
+	"getuid":            unix.SYS_GETUID,
+	"ioctl":             unix.SYS_IOCTL,
+	"kill":              unix.SYS_KILL,
+	"lseek":             unix.SYS_LSEEK,
+	"madvise":           unix.SYS_MADVISE,
+	"mincore":           unix.SYS_MINCORE,
+	"mmap":              unix.SYS_MMAP,
+	"mprotect":          unix.SYS_MPROTECT,
+	"mremap":            unix.SYS_MREMAP,
+	"munmap":            unix.SYS_MUNMAP,
+	"nanosleep":         unix.SYS_NANOSLEEP,
+	"newfstatat":        unix.SYS_NEWFSTATAT,
+	"openat":            unix.SYS_OPENAT,
+	"pkey_alloc":        unix.SYS_PKEY_ALLOC,
+	"pipe2":             unix.SYS_PIPE2,
+	"ppoll":             unix.SYS_PPOLL,
+	"prctl":             unix.SYS_PRCTL,
+	"pread64":           unix.SYS_PREAD64,
+	"prlimit64":         unix.SYS_PRLIMIT64,
+	"pselect6":          unix.SYS_PSELECT6,
+	"pwrite64":          unix.SYS_PWRITE64,
+	"read":              unix.SYS_READ,
+	"readlinkat":        unix.SYS_READLINKAT,
+	"readv":             unix.SYS_READV,
+	"rseq":              unix.SYS_RSEQ,
+	"rt_sigaction":      unix.SYS_RT_SIGACTION,
+	"rt_sigprocmask":    unix.SYS_RT_SIGPROCMASK,
+	"rt_sigreturn":      unix.SYS_RT_SIGRETURN,
+	"sched_getaffinity": unix.SYS_SCHED_GETAFFINITY,
+	"sched_yield":       unix.SYS_SCHED_YIELD,
+	"set_robust_list":   unix.SYS_SET_ROBUST_LIST,
+	"set_tid_address":   unix.SYS_SET_TID_ADDRESS,
+	"sigaltstack":       unix.SYS_SIGALTSTACK,
+	"statx":             unix.SYS_STATX,
+	"sysinfo":           unix.SYS_SYSINFO,
+	"tgkill":            unix.SYS_TGKILL,
+	"timer_create":      unix.SYS_TIMER_CREATE,
+	"timer_delete":      unix.SYS_TIMER_DELETE,
+	"timer_settime":     unix.SYS_TIMER_SETTIME,
+	"uname":             unix.SYS_UNAME,
+	"write":             unix.SYS_WRITE,
+	"writev":            unix.SYS_WRITEV,
+
+	// Never allowed.
+	"accept":                  unix.SYS_ACCEPT,
+	"accept4":                 unix.SYS_ACCEPT4,
+	"acct":                    unix.SYS_ACCT,
+	"add_key":                 unix.SYS_ADD_KEY,
+	"adjtimex":                unix.SYS_ADJTIMEX,
+	"bind":                    unix.SYS_BIND,
+	"bpf":                     unix.SYS_BPF,
+	"capget":                  unix.SYS_CAPGET,
+	"capset":                  unix.SYS_CAPSET,
+	"chdir":                   unix.SYS_CHDIR,
+	"chroot":                  unix.SYS_CHROOT,
+	"clock_settime":           unix.SYS_CLOCK_SETTIME,
+	"close_range":             unix.SYS_CLOSE_RANGE,
+	"connect":                 unix.SYS_CONNECT,
+	"copy_file_range":         unix.SYS_COPY_FILE_RANGE,
+	"delete_module":           unix.SYS_DELETE_MODULE,
+	"epoll_pwait2":            unix.SYS_EPOLL_PWAIT2,
+	"execveat":                unix.SYS_EXECVEAT,
+	"fanotify_init":           unix.SYS_FANOTIFY_INIT,
+	"fchdir":                  unix.SYS_FCHDIR,
+	"fchmod":                  unix.SYS_FCHMOD,
+	"fchmodat":                unix.SYS_FCHMODAT,
+	"fchown":                  unix.SYS_FCHOWN,
+	"fchownat":                unix.SYS_FCHOWNAT,
+	"fdatasync":               unix.SYS_FDATASYNC,
+	"finit_module":            unix.SYS_FINIT_MODULE,
+	"flock":                   unix.SYS_FLOCK,
+	"fsmount":                 unix.SYS_FSMOUNT,
+	"fsopen":                  unix.SYS_FSOPEN,
+	"fstatfs":                 unix.SYS_FSTATFS,
+	"fsync":                   unix.SYS_FSYNC,
+	"ftruncate":               unix.SYS_FTRUNCATE,
+	"getpeername":             unix.SYS_GETPEERNAME,
+	"getpgid":                 unix.SYS_GETPGID,
+	"getrusage":               unix.SYS_GETRUSAGE,
+	"getsid":                  unix.SYS_GETSID,
+	"getsockname":             unix.SYS_GETSOCKNAME,
+	"getsockopt":              unix.SYS_GETSOCKOPT,
+	"init_module":             unix.SYS_INIT_MODULE,
+	"inotify_add_watch":       unix.SYS_INOTIFY_ADD_WATCH,
+	"inotify_init1":           unix.SYS_INOTIFY_INIT1,
+	"io_uring_enter":          unix.SYS_IO_URING_ENTER,
+	"io_uring_register":       unix.SYS_IO_URING_REGISTER,
+	"io_uring_setup":          unix.SYS_IO_URING_SETUP,
+	"ioprio_set":              unix.SYS_IOPRIO_SET,
+	"kcmp":                    unix.SYS_KCMP,
+	"kexec_load":              unix.SYS_KEXEC_LOAD,
+	"keyctl":                  unix.SYS_KEYCTL,
+	"landlock_create_ruleset": unix.SYS_LANDLOCK_CREATE_RULESET,
+	"linkat":                  unix.SYS_LINKAT,
+	"listen":                  unix.SYS_LISTEN,
+	"mbind":                   unix.SYS_MBIND,
+	"membarrier":              unix.SYS_MEMBARRIER,
+	"memfd_create":            unix.SYS_MEMFD_CREATE,
+	"migrate_pages":           unix.SYS_MIGRATE_PAGES,
+	"mkdirat":                 unix.SYS_MKDIRAT,
+	"mknodat":                 unix.SYS_MKNODAT,
+	"mlock":                   unix.SYS_MLOCK,
+	"mlockall":                unix.SYS_MLOCKALL,
+	"mount":                   unix.SYS_MOUNT,
+	"mount_setattr":           unix.SYS_MOUNT_SETATTR,
+	"move_mount":              unix.SYS_MOVE_MOUNT,
+	"move_pages":              unix.SYS_MOVE_PAGES,
+	"mq_open":                 unix.SYS_MQ_OPEN,
+	"msgget":                  unix.SYS_MSGGET,
+	"munlock":                 unix.SYS_MUNLOCK,
+	"name_to_handle_at":       unix.SYS_NAME_TO_HANDLE_AT,
+	"open_by_handle_at":       unix.SYS_OPEN_BY_HANDLE_AT,
+	"open_tree":               unix.SYS_OPEN_TREE,
+	"perf_event_open":         unix.SYS_PERF_EVENT_OPEN,
+	"personality":             unix.SYS_PERSONALITY,
+	"pidfd_getfd":             unix.SYS_PIDFD_GETFD,
+	"pidfd_open":              unix.SYS_PIDFD_OPEN,
+	"pidfd_send_signal":       unix.SYS_PIDFD_SEND_SIGNAL,
+	"pivot_root":              unix.SYS_PIVOT_ROOT,
+	"process_madvise":         unix.SYS_PROCESS_MADVISE,
+	"process_vm_readv":        unix.SYS_PROCESS_VM_READV,
+	"process_vm_writev":       unix.SYS_PROCESS_VM_WRITEV,
+	"ptrace":                  unix.SYS_PTRACE,
+	"quotactl":                unix.SYS_QUOTACTL,
+	"reboot":                  unix.SYS_REBOOT,
+	"recvfrom":                unix.SYS_RECVFROM,
+	"recvmsg":                 unix.SYS_RECVMSG,
+	"renameat":                unix.SYS_RENAMEAT,
+	"renameat2":               unix.SYS_RENAMEAT2,
+	"request_key":             unix.SYS_REQUEST_KEY,
+	"sched_setaffinity":       unix.SYS_SCHED_SETAFFINITY,
+	"sched_setscheduler":      unix.SYS_SCHED_SETSCHEDULER,
+	"seccomp":                 unix.SYS_SECCOMP,
+	"semget":                  unix.SYS_SEMGET,
+	"sendfile":                unix.SYS_SENDFILE,
+	"sendmsg":                 unix.SYS_SENDMSG,
+	"sendto":                  unix.SYS_SENDTO,
+	"set_mempolicy":           unix.SYS_SET_MEMPOLICY,
+	"setdomainname":           unix.SYS_SETDOMAINNAME,
+	"setgid":                  unix.SYS_SETGID,
+	"sethostname":             unix.SYS_SETHOSTNAME,
+	"setns":                   unix.SYS_SETNS,
+	"setpgid":                 unix.SYS_SETPGID,
+	"setpriority":             unix.SYS_SETPRIORITY,
+	"setrlimit":               unix.SYS_SETRLIMIT,
+	"setsid":                  unix.SYS_SETSID,
+	"setsockopt":              unix.SYS_SETSOCKOPT,
+	"settimeofday":            unix.SYS_SETTIMEOFDAY,
+	"setuid":                  unix.SYS_SETUID,
+	"shmget":                  unix.SYS_SHMGET,
+	"shutdown":                unix.SYS_SHUTDOWN,
+	"signalfd4":               unix.SYS_SIGNALFD4,
+	"socket":                  unix.SYS_SOCKET,
+	"socketpair":              unix.SYS_SOCKETPAIR,
+	"splice":                  unix.SYS_SPLICE,
+	"statfs":                  unix.SYS_STATFS,
+	"swapoff":                 unix.SYS_SWAPOFF,
+	"swapon":                  unix.SYS_SWAPON,
+	"symlinkat":               unix.SYS_SYMLINKAT,
+	"syslog":                  unix.SYS_SYSLOG,
+	"tee":                     unix.SYS_TEE,
+	"timerfd_create":          unix.SYS_TIMERFD_CREATE,
+	"times":                   unix.SYS_TIMES,
+	"tkill":                   unix.SYS_TKILL,
+	"truncate":                unix.SYS_TRUNCATE,
+	"umask":                   unix.SYS_UMASK,
+	"umount2":                 unix.SYS_UMOUNT2,
+	"unlinkat":                unix.SYS_UNLINKAT,
+	"unshare":                 unix.SYS_UNSHARE,
+	"userfaultfd":             unix.SYS_USERFAULTFD,
+	"utimensat":               unix.SYS_UTIMENSAT,
+	"vhangup":                 unix.SYS_VHANGUP,
+	"vmsplice":                unix.SYS_VMSPLICE,
+	"wait4":                   unix.SYS_WAIT4,
+	"waitid":                  unix.SYS_WAITID,
+}
@@ -0,0 +1,24 @@
+//go:build !windows
+
+package sandbox
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+)
+
+func peakRSS(ps *os.ProcessState) int64 {
+	if ps == nil {
+		return 0
+	}
+	ru, ok := ps.SysUsage().(*syscall.Rusage)
+	if !ok || ru == nil {
+		return 0
+	}
+	// ru_maxrss is in bytes on darwin and kilobytes everywhere else.
+	if runtime.GOOS == "darwin" {
+		return int64(ru.Maxrss)
+	}
+	return int64(ru.Maxrss) * 1024
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package sandbox
+
+import "os"
+
+func peakRSS(ps *os.ProcessState) int64 {
+	return 0
+}